@@ -0,0 +1,100 @@
+// Package assign implements the deterministic visitor bucketing used for
+// holdouts and mutually exclusive layers. The generated hlg.js contains a
+// JavaScript port of the same hash, so both sides always agree on which
+// tests a visitor is eligible for.
+package assign
+
+import "unicode/utf16"
+
+const (
+	fnvOffset = 2166136261
+	fnvPrime  = 16777619
+)
+
+// Hash computes 32-bit FNV-1a over the UTF-16 code units of s, matching
+// the charCodeAt loop in the global script.
+func Hash(s string) uint32 {
+	h := uint32(fnvOffset)
+	for _, unit := range utf16.Encode([]rune(s)) {
+		h ^= uint32(unit)
+		h *= fnvPrime
+	}
+	return h
+}
+
+// Bucket maps a visitor to a stable position in [0, 1) for the given seed.
+func Bucket(seed, visitorID string) float64 {
+	return float64(Hash(seed+":"+visitorID)) / 4294967296
+}
+
+// InHoldout reports whether the visitor falls into the global holdout group.
+func InHoldout(visitorID string, percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+	return Bucket("holdout", visitorID) < percent/100
+}
+
+// LayerTest returns the single test in a layer the visitor is assigned to.
+// tests must be in the same order the script receives them (by name).
+func LayerTest(layer string, tests []string, visitorID string) string {
+	if len(tests) == 0 {
+		return ""
+	}
+	idx := int(Bucket("layer:"+layer, visitorID) * float64(len(tests)))
+	return tests[idx]
+}
+
+// Eligible reports whether a visitor may see the named test given the
+// current layers and holdout percentage.
+func Eligible(visitorID, testName string, layers map[string][]string, holdout float64) bool {
+	if InHoldout(visitorID, holdout) {
+		return false
+	}
+	for layer, tests := range layers {
+		for _, name := range tests {
+			if name == testName {
+				return LayerTest(layer, tests, visitorID) == testName
+			}
+		}
+	}
+	return true
+}
+
+// TrafficShare returns the fraction of all visitors exposed to a test that
+// shares its layer with layerSize tests (0 or 1 for no layer).
+func TrafficShare(holdout float64, layerSize int) float64 {
+	share := 1 - holdout/100
+	if layerSize > 1 {
+		share /= float64(layerSize)
+	}
+	return share
+}
+
+// Variant picks a variant index for the visitor deterministically. Weights
+// are honored when there is one per variant; otherwise the split is even.
+func Variant(testName, visitorID string, n int, weights []float64) int {
+	if n <= 1 {
+		return 0
+	}
+	b := Bucket("variant:"+testName, visitorID)
+
+	if len(weights) == n {
+		total := 0.0
+		for _, w := range weights {
+			total += w
+		}
+		if total > 0 {
+			acc := 0.0
+			for i, w := range weights {
+				acc += w / total
+				if b < acc {
+					return i
+				}
+			}
+			return n - 1
+		}
+	}
+
+	return int(b * float64(n))
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newAPIKeyCmd())
+}
+
+func newAPIKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage API keys for server-side conversions",
+		Long: `Manage API keys for the server-to-server conversion endpoint
+(POST /api/conversions). Keys are shown once at creation; only a hash is
+stored.
+
+Examples:
+  hlg apikey create billing
+  hlg apikey list
+  hlg apikey revoke 3f9a1c2e`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "create [name]",
+		Short: "Create an API key",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			key, entry, err := server.GenerateAPIKey(name)
+			if err != nil {
+				return err
+			}
+
+			err = updateSettingList(store.SettingAPIKeys, func(list []string) ([]string, error) {
+				return append(list, entry), nil
+			})
+			if err != nil {
+				return err
+			}
+
+			id, _ := server.ParseAPIKeyEntry(entry)
+			fmt.Printf("Created API key %s. Store it now; it cannot be shown again:\n\n", id)
+			fmt.Printf("  %s\n\n", key)
+			fmt.Println("Send it as: Authorization: Bearer <key>")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List API keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				list, err := s.GetSettingList(context.Background(), store.SettingAPIKeys)
+				if err != nil {
+					return fmt.Errorf("failed to load API keys: %w", err)
+				}
+				if len(list) == 0 {
+					fmt.Println("No API keys. Create one with 'hlg apikey create'.")
+					return nil
+				}
+				for _, entry := range list {
+					id, name := server.ParseAPIKeyEntry(entry)
+					fmt.Printf("%s  %s\n", id, name)
+				}
+				return nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := args[0]
+
+			err := updateSettingList(store.SettingAPIKeys, func(list []string) ([]string, error) {
+				for i, entry := range list {
+					if id, _ := server.ParseAPIKeyEntry(entry); id == target {
+						return append(list[:i], list[i+1:]...), nil
+					}
+				}
+				return nil, fmt.Errorf("API key %s not found. Run 'hlg apikey list' to see keys", target)
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Revoked API key %s\n", target)
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var attributionCmd = &cobra.Command{
+	Use:   "attribution [window|off]",
+	Short: "Show or set the conversion attribution window",
+	Long: `Show or set how long after a view a conversion still counts.
+
+A conversion only counts for a variant if the visitor (or linked user) was
+shown that variant before converting, and within the window when one is
+set. Other conversions are reported in results as unattributed, or as
+mismatched when the visitor was shown a different variant.
+
+The window applies to past events too. Windows take s, m, h or d units.
+
+Examples:
+  hlg attribution
+  hlg attribution 7d
+  hlg attribution 36h
+  hlg attribution off`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runAttribution,
+}
+
+func init() {
+	rootCmd.AddCommand(attributionCmd)
+}
+
+func runAttribution(cmd *cobra.Command, args []string) error {
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		if len(args) == 0 {
+			window, err := s.GetAttributionWindow(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to get attribution window: %w", err)
+			}
+			fmt.Printf("Conversions count %s\n", describeWindow(window))
+			return nil
+		}
+
+		window, err := parseWindow(args[0])
+		if err != nil {
+			return err
+		}
+		if err := s.SetAttributionWindow(ctx, window); err != nil {
+			return err
+		}
+
+		fmt.Printf("Conversions now count %s\n", describeWindow(window))
+		return nil
+	})
+}
+
+// parseWindow parses a duration that may also use days, e.g. "7d", or
+// "off" for no window
+func parseWindow(arg string) (time.Duration, error) {
+	if arg == "off" || arg == "0" {
+		return 0, nil
+	}
+
+	var window time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(arg, "d"); ok {
+		var n float64
+		n, err = strconv.ParseFloat(days, 64)
+		window = time.Duration(n * float64(24*time.Hour))
+	} else {
+		window, err = time.ParseDuration(arg)
+	}
+	if err != nil || window < time.Second {
+		return 0, fmt.Errorf("invalid window %q. Example: hlg attribution 7d", arg)
+	}
+	return window, nil
+}
+
+func describeWindow(window time.Duration) string {
+	if window == 0 {
+		return "any time after a view of the same variant"
+	}
+	if window%(24*time.Hour) == 0 {
+		return fmt.Sprintf("up to %dd after a view of the same variant", window/(24*time.Hour))
+	}
+	// "36h0m0s" reads better as "36h"
+	short := window.String()
+	if strings.HasSuffix(short, "m0s") {
+		short = strings.TrimSuffix(short, "0s")
+	}
+	if strings.HasSuffix(short, "h0m") {
+		short = strings.TrimSuffix(short, "0m")
+	}
+	return fmt.Sprintf("up to %s after a view of the same variant", short)
+}
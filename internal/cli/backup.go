@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newBackupCmd())
+	rootCmd.AddCommand(newRestoreCmd())
+}
+
+func newBackupCmd() *cobra.Command {
+	var compress bool
+
+	cmd := &cobra.Command{
+		Use:   "backup <path>",
+		Short: "Write a consistent copy of the database",
+		Long: `Write a consistent copy of the database, safe to run while the server is
+running. Don't copy hlg.db with cp instead: recent writes live in hlg.db-wal
+and a plain copy can be torn.
+
+Paths ending in .gz are gzipped. For scheduled backups, start the server
+with --backup-dir.
+
+Examples:
+  hlg backup backups/hlg.db
+  hlg backup backups/hlg-$(date +%F).db.gz`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := args[0]
+			if strings.HasSuffix(path, ".gz") {
+				compress = true
+			}
+
+			return withStore(func(s *store.SQLiteStore) error {
+				ctx := context.Background()
+				if err := s.Backup(ctx, path, compress); err != nil {
+					return err
+				}
+				if err := store.VerifyBackup(ctx, path); err != nil {
+					return fmt.Errorf("backup written but failed verification: %w", err)
+				}
+
+				info, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Backed up %s to %s (%d bytes)\n", dbPath, path, info.Size())
+				return nil
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&compress, "gzip", false, "gzip the backup")
+	return cmd
+}
+
+func newRestoreCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <backup>",
+		Short: "Replace the database with a backup",
+		Long: `Replace the database with a backup made by 'hlg backup' or --backup-dir.
+
+The backup is checked with SQLite's integrity check before anything is
+changed. The current database is kept next to it as
+hlg.db.pre-restore-<timestamp>. Stop the server first.
+
+Examples:
+  hlg restore backups/hlg-20240101-030000.db.gz
+  hlg restore backups/hlg.db --db /var/lib/hlg/hlg.db`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tokenFile := filepath.Join(filepath.Dir(dbPath), ".hlg-token")
+			if _, err := os.Stat(tokenFile); err == nil && !force {
+				return fmt.Errorf("the server appears to be running (%s exists). Stop it first, or use --force if it isn't", tokenFile)
+			}
+
+			previous, err := store.Restore(context.Background(), args[0], dbPath)
+			if err != nil {
+				return fmt.Errorf("restore failed: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Restored %s from %s\n", dbPath, args[0])
+			if previous != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "Previous database kept at %s\n", previous)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "restore even if the server looks like it is running")
+	return cmd
+}
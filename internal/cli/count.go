@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var countCmd = &cobra.Command{
+	Use:   "count <test> [unique|every|N]",
+	Short: "Show or set how a test counts repeat conversions",
+	Long: `Show or set how a test counts repeat conversions by the same visitor.
+
+  unique  count each visitor once (default)
+  every   count every conversion
+  N       count up to N conversions per visitor
+
+Every conversion is stored, so the mode can be changed at any time and
+applies to past conversions too. Conversion rates always count unique
+visitors; with every or N, results also show events per visitor.
+
+Examples:
+  hlg count cta
+  hlg count cta every
+  hlg count checkout 3
+  hlg count cta unique`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runCount,
+}
+
+func init() {
+	rootCmd.AddCommand(countCmd)
+}
+
+func runCount(cmd *cobra.Command, args []string) error {
+	testName := args[0]
+
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		if len(args) == 1 {
+			test, err := s.GetTest(ctx, testName)
+			if err == store.ErrNotFound {
+				return fmt.Errorf("test '%s' not found. Run 'hlg list' to see available tests", testName)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get test: %w", err)
+			}
+			fmt.Printf("Test '%s' counts %s\n", testName, describeCounting(test.CountMode, test.CountCap))
+			return nil
+		}
+
+		mode, cap, err := parseCounting(args[1])
+		if err != nil {
+			return err
+		}
+		if err := setCounting(ctx, s, testName, mode, cap); err != nil {
+			return err
+		}
+
+		fmt.Printf("Test '%s' now counts %s\n", testName, describeCounting(mode, cap))
+		return nil
+	})
+}
+
+// parseCounting parses "unique", "every" or a per-visitor cap
+func parseCounting(arg string) (store.CountMode, int, error) {
+	switch arg {
+	case "unique":
+		return store.CountUnique, 0, nil
+	case "every":
+		return store.CountEvery, 0, nil
+	}
+
+	cap, err := strconv.Atoi(arg)
+	if err != nil || cap < 1 {
+		return "", 0, fmt.Errorf("invalid count mode %q. Use unique, every or a number of conversions per visitor", arg)
+	}
+	if cap == 1 {
+		return store.CountUnique, 0, nil
+	}
+	return store.CountCapped, cap, nil
+}
+
+func setCounting(ctx context.Context, s *store.SQLiteStore, testName string, mode store.CountMode, cap int) error {
+	err := s.SetTestCounting(ctx, testName, mode, cap)
+	if err == store.ErrNotFound {
+		return fmt.Errorf("test '%s' not found. Run 'hlg list' to see available tests", testName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set counting: %w", err)
+	}
+	return nil
+}
+
+func describeCounting(mode store.CountMode, cap int) string {
+	switch mode {
+	case store.CountEvery:
+		return "every conversion"
+	case store.CountCapped:
+		return fmt.Sprintf("up to %d conversions per visitor", cap)
+	default:
+		return "each visitor's conversion once"
+	}
+}
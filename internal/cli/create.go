@@ -3,7 +3,9 @@ package cli
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gkobilansky/headline-goat/internal/store"
 	"github.com/spf13/cobra"
@@ -20,6 +22,10 @@ func newCreateCmd() *cobra.Command {
 		target        string
 		ctaTarget     string
 		conversionURL string
+		layer         string
+		goal          string
+		count         string
+		engagement    string
 	)
 
 	cmd := &cobra.Command{
@@ -31,7 +37,14 @@ Examples:
   hlg create hero --variants "Ship Faster,Build Better"
   hlg create cta --variants "Sign Up,Get Started,Try Free"
   hlg create hero --variants "A,B" --url "/" --target "h1"
-  hlg create hero --variants "A,B" --url "/" --target "h1" --cta-target "button.signup"`,
+  hlg create hero --variants "A,B" --url "/" --target "h1" --cta-target "button.signup"
+  hlg create hero --variants "A,B" --layer landing
+  hlg create pricing --variants "A,B" --goal checkout
+  hlg create cta --variants "A,B" --count every
+  hlg create hero --variants "A,B" --url "/" --target "h1" --engagement scroll:75
+  hlg create hero --variants "A,B" --url "/" --target "h1" --engagement dwell:30s
+  hlg create hero --variants "A,B" --url "/" --target "h1" --engagement "visible:#pricing"
+  hlg create hero --variants "A,B" --url "/" --target "h1" --engagement "submit:form.signup"`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			testName := args[0]
@@ -51,11 +64,27 @@ Examples:
 				return fmt.Errorf("use --cta-target OR --conversion-url, not both")
 			}
 
+			var engagementGoal *store.EngagementGoal
+			if engagement != "" {
+				var err error
+				if engagementGoal, err = parseEngagement(engagement); err != nil {
+					return err
+				}
+			}
+
+			countMode, countCap := store.CountUnique, 0
+			if count != "" {
+				var err error
+				if countMode, countCap, err = parseCounting(count); err != nil {
+					return err
+				}
+			}
+
 			return withStore(func(s *store.SQLiteStore) error {
 				ctx := context.Background()
 
 				// Create test
-				test, err := s.CreateTest(ctx, testName, variantList, nil, "")
+				test, err := s.CreateTest(ctx, testName, variantList, nil, goal)
 				if err != nil {
 					return fmt.Errorf("failed to create test: %w", err)
 				}
@@ -68,6 +97,24 @@ Examples:
 					}
 				}
 
+				if layer != "" {
+					if err := s.SetTestLayer(ctx, testName, layer); err != nil {
+						return fmt.Errorf("failed to set layer: %w", err)
+					}
+				}
+
+				if engagementGoal != nil {
+					if err := s.SetTestEngagement(ctx, testName, engagementGoal); err != nil {
+						return fmt.Errorf("failed to set engagement goal: %w", err)
+					}
+				}
+
+				if countMode != store.CountUnique {
+					if err := setCounting(ctx, s, testName, countMode, countCap); err != nil {
+						return err
+					}
+				}
+
 				fmt.Printf("Created test '%s' with %d variants:\n", test.Name, len(test.Variants))
 				for i, v := range test.Variants {
 					fmt.Printf("  %d: %s\n", i, v)
@@ -84,6 +131,18 @@ Examples:
 				if conversionURL != "" {
 					fmt.Printf("  Conversion URL: %s\n", conversionURL)
 				}
+				if layer != "" {
+					fmt.Printf("  Layer: %s\n", layer)
+				}
+				if goal != "" {
+					fmt.Printf("  Goal: %s\n", goal)
+				}
+				if engagementGoal != nil {
+					fmt.Printf("  Engagement: %s\n", describeEngagement(engagementGoal))
+				}
+				if countMode != store.CountUnique {
+					fmt.Printf("  Counts: %s\n", describeCounting(countMode, countCap))
+				}
 
 				return nil
 			})
@@ -95,7 +154,60 @@ Examples:
 	cmd.Flags().StringVar(&target, "target", "", "CSS selector for headline element (optional)")
 	cmd.Flags().StringVar(&ctaTarget, "cta-target", "", "CSS selector for CTA element (optional)")
 	cmd.Flags().StringVar(&conversionURL, "conversion-url", "", "URL for page-load conversion (optional)")
+	cmd.Flags().StringVar(&layer, "layer", "", "mutually exclusive layer name (optional)")
+	cmd.Flags().StringVar(&goal, "goal", "", "conversion goal name for server-side conversions (optional)")
+	cmd.Flags().StringVar(&count, "count", "", "count repeat conversions: every or a per-visitor cap (optional)")
+	cmd.Flags().StringVar(&engagement, "engagement", "", "convert on engagement: scroll:PCT, dwell:DURATION, visible:SELECTOR or submit:SELECTOR (optional)")
 	cmd.MarkFlagRequired("variants")
 
 	return cmd
 }
+
+// parseEngagement parses an engagement goal such as "scroll:75",
+// "dwell:30s", "visible:#pricing" or "submit:form.signup"
+func parseEngagement(spec string) (*store.EngagementGoal, error) {
+	kind, arg, ok := strings.Cut(spec, ":")
+	if !ok || arg == "" {
+		return nil, fmt.Errorf("invalid engagement goal %q. Use scroll:PCT, dwell:DURATION, visible:SELECTOR or submit:SELECTOR", spec)
+	}
+
+	goal := &store.EngagementGoal{Type: store.GoalType(kind)}
+	switch goal.Type {
+	case store.GoalScroll:
+		percent, err := strconv.Atoi(strings.TrimSuffix(arg, "%"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid scroll percentage %q", arg)
+		}
+		goal.Percent = percent
+	case store.GoalDwell:
+		// Plain numbers are seconds
+		if _, err := strconv.Atoi(arg); err == nil {
+			arg += "s"
+		}
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dwell time %q. Use e.g. 30s or 2m", arg)
+		}
+		goal.Seconds = int(d / time.Second)
+	default:
+		goal.Selector = arg
+	}
+
+	if err := goal.Validate(); err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func describeEngagement(goal *store.EngagementGoal) string {
+	switch goal.Type {
+	case store.GoalScroll:
+		return fmt.Sprintf("scrolled past %d%% of the page", goal.Percent)
+	case store.GoalDwell:
+		return fmt.Sprintf("%s on the page", time.Duration(goal.Seconds)*time.Second)
+	case store.GoalVisible:
+		return fmt.Sprintf("%s scrolled into view", goal.Selector)
+	default:
+		return fmt.Sprintf("%s submitted", goal.Selector)
+	}
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newDenylistCmd())
+}
+
+func newDenylistCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "denylist",
+		Short: "Manage IPs and CIDR ranges whose beacons are dropped",
+		Long: `Manage the IP/CIDR denylist. Beacons from listed addresses are
+dropped as bot traffic (e.g. your office, uptime checkers, load testers).
+
+Examples:
+  hlg denylist add 203.0.113.7
+  hlg denylist add 10.20.0.0/16
+  hlg denylist remove 203.0.113.7
+  hlg denylist list`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add <ip|cidr>",
+		Short: "Add an IP or CIDR range to the denylist",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entry := strings.TrimSpace(args[0])
+			if !validIPOrCIDR(entry) {
+				return fmt.Errorf("invalid IP or CIDR %q. Example: 203.0.113.7 or 10.0.0.0/8", entry)
+			}
+
+			err := updateSettingList(store.SettingIPDenylist, func(list []string) ([]string, error) {
+				for _, existing := range list {
+					if existing == entry {
+						return nil, fmt.Errorf("%s is already in the denylist", entry)
+					}
+				}
+				return append(list, entry), nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Added %s to the denylist\n", entry)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove <ip|cidr>",
+		Short: "Remove an IP or CIDR range from the denylist",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entry := strings.TrimSpace(args[0])
+
+			err := updateSettingList(store.SettingIPDenylist, func(list []string) ([]string, error) {
+				for i, existing := range list {
+					if existing == entry {
+						return append(list[:i], list[i+1:]...), nil
+					}
+				}
+				return nil, fmt.Errorf("%s is not in the denylist. Run 'hlg denylist list' to see entries", entry)
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Removed %s from the denylist\n", entry)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List denylisted IPs and CIDR ranges",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				list, err := s.GetSettingList(context.Background(), store.SettingIPDenylist)
+				if err != nil {
+					return fmt.Errorf("failed to load denylist: %w", err)
+				}
+				if len(list) == 0 {
+					fmt.Println("Denylist is empty.")
+					return nil
+				}
+				for _, entry := range list {
+					fmt.Println(entry)
+				}
+				return nil
+			})
+		},
+	})
+
+	return cmd
+}
+
+func validIPOrCIDR(entry string) bool {
+	if strings.Contains(entry, "/") {
+		_, _, err := net.ParseCIDR(entry)
+		return err == nil
+	}
+	return net.ParseIP(entry) != nil
+}
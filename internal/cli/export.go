@@ -19,6 +19,10 @@ var exportCmd = &cobra.Command{
 	Short: "Export raw event data",
 	Long: `Export raw event data in CSV or JSON format.
 
+Days whose raw events were removed by 'hlg retention' are exported as daily
+totals per variant: CSV rows with an empty visitor_id and the number of
+visitors in count, or the "rollups" list in JSON.
+
 Examples:
   hlg export hero --format csv > hero-data.csv
   hlg export hero --format json > hero-data.json`,
@@ -56,28 +60,50 @@ func runExport(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to get events: %w", err)
 		}
 
-		if len(events) == 0 {
+		rollups, err := s.GetRollups(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to get rollups: %w", err)
+		}
+
+		if len(events) == 0 && len(rollups) == 0 {
 			fmt.Fprintf(os.Stderr, "No events recorded yet for test '%s'.\n", name)
 			fmt.Fprintln(os.Stderr, "Events appear after visitors view your page with the headline-goat script.")
 			return nil
 		}
 
 		if exportFormat == "csv" {
-			return exportCSV(events)
+			return exportCSV(events, rollups)
 		}
-		return exportJSON(events)
+		return exportJSON(events, rollups)
 	})
 }
 
-func exportCSV(events []*store.Event) error {
+func exportCSV(events []*store.Event, rollups []store.DailyStats) error {
 	w := csv.NewWriter(os.Stdout)
 	defer w.Flush()
 
 	// Write header
-	if err := w.Write([]string{"timestamp", "variant", "event_type", "visitor_id"}); err != nil {
+	if err := w.Write([]string{"timestamp", "variant", "event_type", "visitor_id", "value", "count"}); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
+	// Rolled-up days first, as one row per variant and event type
+	for _, d := range rollups {
+		day := strconv.FormatInt(d.Day.Unix(), 10)
+		variant := strconv.Itoa(d.Variant)
+		if d.Views > 0 {
+			if err := w.Write([]string{day, variant, "view", "", "0", strconv.Itoa(d.Views)}); err != nil {
+				return fmt.Errorf("failed to write row: %w", err)
+			}
+		}
+		if d.Conversions > 0 {
+			value := strconv.FormatFloat(d.Value, 'f', -1, 64)
+			if err := w.Write([]string{day, variant, "convert", "", value, strconv.Itoa(d.Conversions)}); err != nil {
+				return fmt.Errorf("failed to write row: %w", err)
+			}
+		}
+	}
+
 	// Write rows
 	for _, e := range events {
 		row := []string{
@@ -85,6 +111,8 @@ func exportCSV(events []*store.Event) error {
 			strconv.Itoa(e.Variant),
 			e.EventType,
 			e.VisitorID,
+			strconv.FormatFloat(e.Value, 'f', -1, 64),
+			"1",
 		}
 		if err := w.Write(row); err != nil {
 			return fmt.Errorf("failed to write row: %w", err)
@@ -95,27 +123,49 @@ func exportCSV(events []*store.Event) error {
 }
 
 type jsonExport struct {
-	Events []jsonEvent `json:"events"`
+	Rollups []jsonRollup `json:"rollups,omitempty"`
+	Events  []jsonEvent  `json:"events"`
+}
+
+// jsonRollup is a day of events removed by retention
+type jsonRollup struct {
+	Date        string  `json:"date"`
+	Variant     int     `json:"variant"`
+	Views       int     `json:"views"`
+	Conversions int     `json:"conversions"`
+	Value       float64 `json:"value,omitempty"`
 }
 
 type jsonEvent struct {
-	Timestamp int64  `json:"timestamp"`
-	Variant   int    `json:"variant"`
-	EventType string `json:"event_type"`
-	VisitorID string `json:"visitor_id"`
+	Timestamp int64   `json:"timestamp"`
+	Variant   int     `json:"variant"`
+	EventType string  `json:"event_type"`
+	VisitorID string  `json:"visitor_id"`
+	Value     float64 `json:"value,omitempty"`
 }
 
-func exportJSON(events []*store.Event) error {
+func exportJSON(events []*store.Event, rollups []store.DailyStats) error {
 	export := jsonExport{
 		Events: make([]jsonEvent, len(events)),
 	}
 
+	for _, d := range rollups {
+		export.Rollups = append(export.Rollups, jsonRollup{
+			Date:        d.Day.Format("2006-01-02"),
+			Variant:     d.Variant,
+			Views:       d.Views,
+			Conversions: d.Conversions,
+			Value:       d.Value,
+		})
+	}
+
 	for i, e := range events {
 		export.Events[i] = jsonEvent{
 			Timestamp: e.CreatedAt.Unix(),
 			Variant:   e.Variant,
 			EventType: e.EventType,
 			VisitorID: e.VisitorID,
+			Value:     e.Value,
 		}
 	}
 
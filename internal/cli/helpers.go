@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/gkobilansky/headline-goat/internal/store"
@@ -16,3 +17,25 @@ func withStore(fn func(*store.SQLiteStore) error) error {
 
 	return fn(s)
 }
+
+// updateSettingList loads a list setting, applies fn and saves the result.
+func updateSettingList(key string, fn func([]string) ([]string, error)) error {
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		list, err := s.GetSettingList(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", key, err)
+		}
+
+		list, err = fn(list)
+		if err != nil {
+			return err
+		}
+
+		if err := s.SetSettingList(ctx, key, list); err != nil {
+			return fmt.Errorf("failed to save %s: %w", key, err)
+		}
+		return nil
+	})
+}
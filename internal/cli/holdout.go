@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var holdoutCmd = &cobra.Command{
+	Use:   "holdout [percent]",
+	Short: "Show or set the global holdout percentage",
+	Long: `Show or set the share of visitors that never see any test.
+
+Holdout visitors keep the original page content and send no beacons,
+giving you a clean baseline across all running tests.
+
+Examples:
+  hlg holdout
+  hlg holdout 10
+  hlg holdout 0`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runHoldout,
+}
+
+func init() {
+	rootCmd.AddCommand(holdoutCmd)
+}
+
+func runHoldout(cmd *cobra.Command, args []string) error {
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		if len(args) == 0 {
+			pct, err := s.GetHoldoutPercent(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to get holdout: %w", err)
+			}
+			fmt.Printf("Holdout: %g%% of visitors see no tests\n", pct)
+			return nil
+		}
+
+		pct, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid percent %q. Example: hlg holdout 10", args[0])
+		}
+		if err := s.SetHoldoutPercent(ctx, pct); err != nil {
+			return err
+		}
+
+		fmt.Printf("Holdout set to %g%%\n", pct)
+		return nil
+	})
+}
@@ -2,18 +2,25 @@ package cli
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/gkobilansky/headline-goat/internal/logging"
 	"github.com/gkobilansky/headline-goat/internal/server"
 	"github.com/gkobilansky/headline-goat/internal/store"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 )
 
-var port int
+var (
+	port      int
+	serverCfg = server.DefaultConfig()
+	logOpts   = logging.DefaultOptions()
+)
 
 var initCmd = &cobra.Command{
 	Use:   "init",
@@ -30,7 +37,8 @@ Tests auto-create when the first beacon arrives - no explicit setup needed.
 Examples:
   hlg
   hlg init
-  hlg init --port 3000`,
+  hlg init --port 3000
+  hlg init --listen 127.0.0.1:8080`,
 	RunE: runInit,
 }
 
@@ -43,10 +51,66 @@ func init() {
 	}
 
 	initCmd.Flags().IntVarP(&port, "port", "p", defaultPort, "port to listen on")
+	initCmd.Flags().StringVar(&serverCfg.ListenAddr, "listen", os.Getenv("HG_LISTEN"), "host:port to bind (overrides --port)")
+	initCmd.Flags().DurationVar(&serverCfg.ReadTimeout, "read-timeout", serverCfg.ReadTimeout, "maximum time to read a request")
+	initCmd.Flags().DurationVar(&serverCfg.WriteTimeout, "write-timeout", serverCfg.WriteTimeout, "maximum time to write a response")
+	initCmd.Flags().DurationVar(&serverCfg.IdleTimeout, "idle-timeout", serverCfg.IdleTimeout, "keep-alive timeout for idle connections")
+	initCmd.Flags().DurationVar(&serverCfg.ShutdownTimeout, "shutdown-timeout", serverCfg.ShutdownTimeout, "how long to wait for in-flight requests on shutdown")
+	initCmd.Flags().StringVar(&serverCfg.TLSCertFile, "tls-cert", "", "TLS certificate file (PEM); enables HTTPS")
+	initCmd.Flags().StringVar(&serverCfg.TLSKeyFile, "tls-key", "", "TLS private key file (PEM)")
+	initCmd.Flags().StringVar(&serverCfg.HTTPRedirectAddr, "http-redirect", "", "also listen on this address (e.g. :80) and redirect to HTTPS")
+	initCmd.Flags().DurationVar(&serverCfg.HSTSMaxAge, "hsts", 0, "send Strict-Transport-Security with this max-age over HTTPS (e.g. 8760h)")
+	initCmd.Flags().Float64Var(&serverCfg.RateLimit, "rate-limit", serverCfg.RateLimit, "requests per second per IP on /b and /api/tests (0 disables)")
+	initCmd.Flags().IntVar(&serverCfg.RateBurst, "rate-burst", serverCfg.RateBurst, "burst size for --rate-limit")
+	initCmd.Flags().Int64Var(&serverCfg.MaxBodyBytes, "max-body", serverCfg.MaxBodyBytes, "maximum beacon body size in bytes")
+	initCmd.Flags().IntVar(&serverCfg.MaxVariants, "max-variants", serverCfg.MaxVariants, "maximum variants for auto-created tests")
+	initCmd.Flags().IntVar(&serverCfg.MaxClientTests, "max-client-tests", serverCfg.MaxClientTests, "maximum distinct tests auto-created from data attributes")
+	initCmd.Flags().Float64Var(&serverCfg.AutoCreateRate, "auto-create-rate", serverCfg.AutoCreateRate, "auto-created tests per hour per IP")
+	initCmd.Flags().DurationVar(&serverCfg.SignatureTTL, "sign-ttl", serverCfg.SignatureTTL, "lifetime of view signatures when beacon signing is on")
+	initCmd.Flags().StringVar(&serverCfg.MetricsToken, "metrics-token", os.Getenv("HG_METRICS_TOKEN"), "require this Bearer token for /metrics")
+	initCmd.Flags().IntVar(&serverCfg.EventBufferSize, "event-buffer", serverCfg.EventBufferSize, "queue up to this many events in memory and write them in batches (0 writes each beacon immediately)")
+	initCmd.Flags().IntVar(&serverCfg.EventBatchSize, "event-batch", serverCfg.EventBatchSize, "maximum events per batched write")
+	initCmd.Flags().DurationVar(&serverCfg.EventFlushInterval, "event-flush", serverCfg.EventFlushInterval, "how often to write buffered events")
+	initCmd.Flags().DurationVar(&serverCfg.RetentionInterval, "retention-interval", serverCfg.RetentionInterval, "how often to roll up raw events past their retention (0 disables)")
+	initCmd.Flags().StringVar(&serverCfg.BackupDir, "backup-dir", os.Getenv("HG_BACKUP_DIR"), "back up the database to this directory on a schedule")
+	initCmd.Flags().DurationVar(&serverCfg.BackupInterval, "backup-interval", serverCfg.BackupInterval, "how often to back up to --backup-dir")
+	initCmd.Flags().IntVar(&serverCfg.BackupKeep, "backup-keep", serverCfg.BackupKeep, "scheduled backups to keep (0 keeps all)")
+	initCmd.Flags().BoolVar(&serverCfg.BackupGzip, "backup-gzip", false, "gzip scheduled backups")
+	initCmd.Flags().BoolVar(&serverCfg.AccessLog, "access-log", true, "log every request with status and latency")
+	initCmd.Flags().StringVar(&logOpts.Level, "log-level", getEnvOrDefault("HG_LOG_LEVEL", logOpts.Level), "log level: debug, info, warn or error")
+	initCmd.Flags().StringVar(&logOpts.Format, "log-format", getEnvOrDefault("HG_LOG_FORMAT", logOpts.Format), "log format: text or json")
+	initCmd.Flags().StringVar(&logOpts.File, "log-file", os.Getenv("HG_LOG_FILE"), "write logs to this file instead of stderr")
+	initCmd.Flags().IntVar(&logOpts.MaxSizeMB, "log-max-size", logOpts.MaxSizeMB, "rotate --log-file after this many megabytes (0 disables)")
+	initCmd.Flags().IntVar(&logOpts.MaxBackups, "log-max-backups", logOpts.MaxBackups, "rotated log files to keep")
 	rootCmd.AddCommand(initCmd)
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
+	if (serverCfg.TLSCertFile == "") != (serverCfg.TLSKeyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be used together")
+	}
+	if serverCfg.HTTPRedirectAddr != "" && serverCfg.TLSCertFile == "" {
+		return fmt.Errorf("--http-redirect requires --tls-cert and --tls-key")
+	}
+
+	if serverCfg.ListenAddr != "" {
+		_, p, err := net.SplitHostPort(serverCfg.ListenAddr)
+		if err != nil {
+			return fmt.Errorf("invalid --listen %q: must be host:port, e.g. 127.0.0.1:8080", serverCfg.ListenAddr)
+		}
+		if port, err = strconv.Atoi(p); err != nil {
+			return fmt.Errorf("invalid --listen %q: port must be a number", serverCfg.ListenAddr)
+		}
+	}
+
+	logger, logFile, err := logging.New(logOpts)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	slog.SetDefault(logger)
+	serverCfg.Logger = logger
+
 	// Open database first to check for existing settings
 	s, err := store.Open(dbPath)
 	if err != nil {
@@ -84,7 +148,10 @@ func runInit(cmd *cobra.Command, args []string) error {
 	tokenFile := filepath.Join(filepath.Dir(dbPath), ".hlg-token")
 
 	// Create server
-	srv := server.New(s, port, tokenFile)
+	cfg := serverCfg
+	cfg.Port = port
+	cfg.TokenFile = tokenFile
+	srv := server.NewWithConfig(s, cfg)
 
 	// Print startup message with instructions
 	printStartupInstructions(framework, serverURL, port, srv.Token())
@@ -93,8 +160,29 @@ func runInit(cmd *cobra.Command, args []string) error {
 	return srv.StartQuiet()
 }
 
+// localScheme is the scheme the server is reachable on locally
+func localScheme() string {
+	if serverCfg.TLSCertFile != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// localURL is the server's address on this machine: the --listen host
+// when one is given, otherwise localhost (also for 0.0.0.0 and ::, which
+// bind every interface but can't be browsed to)
+func localURL(port int) string {
+	host := "localhost"
+	if h, _, err := net.SplitHostPort(serverCfg.ListenAddr); err == nil && h != "" {
+		if ip := net.ParseIP(h); ip == nil || !ip.IsUnspecified() {
+			host = h
+		}
+	}
+	return fmt.Sprintf("%s://%s", localScheme(), net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
 func promptServerURL(existing string, port int) (string, error) {
-	defaultURL := fmt.Sprintf("http://localhost:%d", port)
+	defaultURL := localURL(port)
 	if existing != "" {
 		defaultURL = existing
 	}
@@ -182,8 +270,8 @@ func promptFramework(existing string) (string, error) {
 
 func printStartupInstructions(framework, serverURL string, port int, token string) {
 	fmt.Println()
-	fmt.Printf("Server running at http://localhost:%d\n", port)
-	fmt.Printf("Dashboard: http://localhost:%d/dashboard?token=%s\n", port, token)
+	fmt.Printf("Server running at %s\n", localURL(port))
+	fmt.Printf("Dashboard: %s/dashboard?token=%s\n", localURL(port), token)
 	fmt.Println()
 	fmt.Println(strings.Repeat("-", 60))
 	fmt.Println()
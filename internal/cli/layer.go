@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newLayerCmd())
+}
+
+func newLayerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "layer",
+		Short: "Manage mutually exclusive experiment layers",
+		Long: `Group tests into layers. A visitor is hashed into at most one running
+test per layer, so overlapping tests on the same page don't interact.
+
+Adding or removing a running test from a layer reshuffles which test
+visitors in that layer are assigned to.
+
+Examples:
+  hlg layer set hero landing
+  hlg layer set subhead landing
+  hlg layer clear subhead
+  hlg layer list`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set <test> <layer>",
+		Short: "Put a test into a layer",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setLayer(args[0], args[1])
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear <test>",
+		Short: "Remove a test from its layer",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setLayer(args[0], "")
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List layers and their running tests",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				layers, err := s.GetLayers(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to list layers: %w", err)
+				}
+
+				if len(layers) == 0 {
+					fmt.Println("No layers yet. Add a test with: hlg layer set <test> <layer>")
+					return nil
+				}
+
+				names := make([]string, 0, len(layers))
+				for name := range layers {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					tests := layers[name]
+					fmt.Printf("%s (%d tests): %s\n", name, len(tests), strings.Join(tests, ", "))
+				}
+				return nil
+			})
+		},
+	})
+
+	return cmd
+}
+
+func setLayer(testName, layer string) error {
+	return withStore(func(s *store.SQLiteStore) error {
+		err := s.SetTestLayer(context.Background(), testName, layer)
+		if err == store.ErrNotFound {
+			return fmt.Errorf("test '%s' not found. Run 'hlg list' to see available tests", testName)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set layer: %w", err)
+		}
+
+		if layer == "" {
+			fmt.Printf("Test '%s' removed from its layer\n", testName)
+		} else {
+			fmt.Printf("Test '%s' is now in layer '%s'\n", testName, layer)
+		}
+		return nil
+	})
+}
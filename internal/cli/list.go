@@ -43,12 +43,13 @@ func runList(cmd *cobra.Command, args []string) error {
 		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
 		fmt.Fprintln(w, "NAME\tSOURCE\tSTATE\tVARIANTS\tVIEWS\tCONVERSIONS\tCREATED")
 
+		allStats, err := s.GetAllVariantStats(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get stats: %w", err)
+		}
+
 		for _, test := range tests {
-			// Get stats for this test
-			stats, err := s.GetVariantStats(ctx, test.Name)
-			if err != nil {
-				return fmt.Errorf("failed to get stats for test %s: %w", test.Name, err)
-			}
+			stats := allStats[test.Name]
 
 			totalViews := 0
 			totalConversions := 0
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newOriginsCmd())
+}
+
+func newOriginsCmd() *cobra.Command {
+	var testName string
+
+	cmd := &cobra.Command{
+		Use:   "origins",
+		Short: "Manage which websites may send beacons",
+		Long: `Manage the origin allowlist for /b and /api/tests.
+
+With an empty allowlist any website may send beacons (CORS "*"). Once
+an origin is added, requests from web pages must come from a listed
+origin (checked via the Origin or Referer header). Requests with neither
+header, such as server-side beacons, are still accepted. A running
+server picks up changes within a few seconds.
+
+Use --test to bind a single test to specific origins instead.
+
+Examples:
+  hlg origins add https://example.com
+  hlg origins add https://www.example.com
+  hlg origins add https://shop.example.com --test checkout
+  hlg origins remove https://example.com
+  hlg origins list`,
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add <origin>",
+		Short: "Allow an origin",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			origin, err := server.NormalizeOrigin(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = updateOrigins(testName, func(list []string) ([]string, error) {
+				for _, existing := range list {
+					if existing == origin {
+						return nil, fmt.Errorf("%s is already allowed", origin)
+					}
+				}
+				return append(list, origin), nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Allowed %s%s\n", origin, testSuffix(testName))
+			return nil
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <origin>",
+		Short: "Remove an allowed origin",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			origin, err := server.NormalizeOrigin(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = updateOrigins(testName, func(list []string) ([]string, error) {
+				for i, existing := range list {
+					if existing == origin {
+						return append(list[:i], list[i+1:]...), nil
+					}
+				}
+				return nil, fmt.Errorf("%s is not allowed. Run 'hlg origins list' to see origins", origin)
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Removed %s%s\n", origin, testSuffix(testName))
+			return nil
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List allowed origins",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				list, err := loadOrigins(context.Background(), s, testName)
+				if err != nil {
+					return err
+				}
+
+				if len(list) == 0 {
+					if testName != "" {
+						fmt.Printf("Test '%s' is not bound to any origins.\n", testName)
+					} else {
+						fmt.Println("No origins configured: any website may send beacons.")
+					}
+					return nil
+				}
+				for _, origin := range list {
+					fmt.Println(origin)
+				}
+				return nil
+			})
+		},
+	}
+
+	for _, sub := range []*cobra.Command{addCmd, removeCmd, listCmd} {
+		sub.Flags().StringVar(&testName, "test", "", "bind origins to a single test instead of globally")
+		cmd.AddCommand(sub)
+	}
+
+	return cmd
+}
+
+// loadOrigins returns the global allowlist, or a test's bound origins
+func loadOrigins(ctx context.Context, s *store.SQLiteStore, testName string) ([]string, error) {
+	if testName == "" {
+		list, err := s.GetSettingList(ctx, store.SettingOrigins)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load origins: %w", err)
+		}
+		return list, nil
+	}
+
+	test, err := s.GetTest(ctx, testName)
+	if err == store.ErrNotFound {
+		return nil, fmt.Errorf("test '%s' not found. Run 'hlg list' to see available tests", testName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get test: %w", err)
+	}
+	return test.Origins, nil
+}
+
+// updateOrigins applies fn to the global allowlist or a test's bound origins
+func updateOrigins(testName string, fn func([]string) ([]string, error)) error {
+	if testName == "" {
+		return updateSettingList(store.SettingOrigins, fn)
+	}
+
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		list, err := loadOrigins(ctx, s, testName)
+		if err != nil {
+			return err
+		}
+
+		list, err = fn(list)
+		if err != nil {
+			return err
+		}
+
+		if err := s.SetTestOrigins(ctx, testName, list); err != nil {
+			return fmt.Errorf("failed to save origins: %w", err)
+		}
+		return nil
+	})
+}
+
+func testSuffix(testName string) string {
+	if testName == "" {
+		return ""
+	}
+	return fmt.Sprintf(" for test '%s'", testName)
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newRebuildStatsCmd())
+}
+
+func newRebuildStatsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rebuild-stats [test]",
+		Short: "Recompute result counters from raw events",
+		Long: `Recompute the per-variant, per-day counters that results are read from.
+
+Counters are kept up to date as events arrive, so this is only needed after
+editing the events table by hand or restoring events from another database.
+Without a test name, every test is rebuilt.
+
+Examples:
+  hlg rebuild-stats
+  hlg rebuild-stats hero`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			testName := ""
+			if len(args) == 1 {
+				testName = args[0]
+			}
+
+			return withStore(func(s *store.SQLiteStore) error {
+				ctx := context.Background()
+				if testName != "" {
+					if _, err := s.GetTest(ctx, testName); err != nil {
+						return fmt.Errorf("test '%s' not found. Run 'hlg list' to see available tests", testName)
+					}
+				}
+
+				if err := s.RebuildAggregates(ctx, testName); err != nil {
+					return err
+				}
+
+				if testName != "" {
+					fmt.Fprintf(cmd.OutOrStdout(), "Rebuilt counters for '%s'\n", testName)
+				} else {
+					fmt.Fprintln(cmd.OutOrStdout(), "Rebuilt counters for all tests")
+				}
+				return nil
+			})
+		},
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/gkobilansky/headline-goat/internal/assign"
 	"github.com/gkobilansky/headline-goat/internal/stats"
 	"github.com/gkobilansky/headline-goat/internal/store"
 	"github.com/spf13/cobra"
@@ -52,7 +53,13 @@ func runResults(cmd *cobra.Command, args []string) error {
 		if test.ConversionGoal != "" {
 			fmt.Printf("GOAL: %s\n", test.ConversionGoal)
 		}
+		if test.Engagement != nil {
+			fmt.Printf("ENGAGEMENT: %s\n", describeEngagement(test.Engagement))
+		}
 		fmt.Printf("CREATED: %s\n", test.CreatedAt.Format("2006-01-02"))
+		if err := printTraffic(ctx, s, test); err != nil {
+			return err
+		}
 		fmt.Println()
 
 		// Print table header
@@ -87,6 +94,12 @@ func runResults(cmd *cobra.Command, args []string) error {
 			)
 		}
 
+		printValues(result.Variants)
+		if stats.CountsRepeats(test) {
+			printEvents(test, result)
+		}
+		printAnomalies(result.Variants)
+		printChanges(test)
 		fmt.Println()
 
 		// Print significance message
@@ -107,6 +120,139 @@ func runResults(cmd *cobra.Command, args []string) error {
 	})
 }
 
+// printChanges lists the elements each variant changes when any variant
+// changes several
+func printChanges(test *store.Test) {
+	multi := false
+	for _, p := range test.Payloads {
+		if p.Type == store.PayloadMulti {
+			multi = true
+		}
+	}
+	if !multi {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("CHANGES:")
+	for i, p := range test.Payloads {
+		fmt.Printf("  %s\n", test.Variants[i])
+		changes := p.Changes
+		if p.Type != store.PayloadMulti {
+			changes = []store.ElementChange{{Selector: test.Target, VariantPayload: p}}
+		}
+		for _, c := range changes {
+			fmt.Printf("    %-16s  %s\n", c.Selector, describePayload(c.VariantPayload))
+		}
+	}
+}
+
+// printValues prints conversion value per variant when any was reported
+func printValues(variants []stats.VariantResult) {
+	hasValue := false
+	for _, v := range variants {
+		if v.Value != 0 {
+			hasValue = true
+		}
+	}
+	if !hasValue {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("VARIANT           VALUE        PER VISITOR")
+	fmt.Println(strings.Repeat("─", 60))
+	for _, v := range variants {
+		variantName := v.Name
+		if len(variantName) > 16 {
+			variantName = variantName[:13] + "..."
+		}
+		perVisitor := 0.0
+		if v.Views > 0 {
+			perVisitor = v.Value / float64(v.Views)
+		}
+		fmt.Printf("%-16s  %-11.2f  %.2f\n", variantName, v.Value, perVisitor)
+	}
+}
+
+// printEvents prints conversion events per visitor for tests counting
+// repeat conversions
+func printEvents(test *store.Test, result *stats.Result) {
+	fmt.Println()
+	fmt.Printf("Counting %s\n", describeCounting(test.CountMode, test.CountCap))
+	fmt.Println("VARIANT           EVENTS       PER VISITOR  95% CI")
+	fmt.Println(strings.Repeat("─", 60))
+	for _, v := range result.Variants {
+		variantName := v.Name
+		if len(variantName) > 16 {
+			variantName = variantName[:13] + "..."
+		}
+		ciStr := fmt.Sprintf("[%.2f, %.2f]", v.EventsCILower, v.EventsCIUpper)
+		if v.Views == 0 {
+			ciStr = "N/A"
+		}
+		fmt.Printf("%-16s  %-11d  %-11.2f  %s\n", variantName, v.Events, v.EventsPerVisitor, ciStr)
+	}
+
+	if len(result.Variants) > 1 {
+		leadingName := result.Variants[result.EventsLeadingVariant].Name
+		other := "control"
+		if result.EventsLeadingVariant == 0 {
+			other = "the best challenger"
+		}
+		fmt.Printf("Events per visitor: %.1f%% confident \"%s\" beats %s\n",
+			result.EventsConfidenceLevel*100, leadingName, other)
+	}
+}
+
+// printAnomalies prints, per variant, the conversions claiming it that the
+// attribution rules excluded
+func printAnomalies(variants []stats.VariantResult) {
+	hasAnomalies := false
+	for _, v := range variants {
+		if v.Unattributed != 0 || v.Mismatched != 0 {
+			hasAnomalies = true
+		}
+	}
+	if !hasAnomalies {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("NOT COUNTED       UNATTRIBUTED  MISMATCHED")
+	fmt.Println(strings.Repeat("─", 60))
+	for _, v := range variants {
+		variantName := v.Name
+		if len(variantName) > 16 {
+			variantName = variantName[:13] + "..."
+		}
+		fmt.Printf("%-16s  %-12d  %d\n", variantName, v.Unattributed, v.Mismatched)
+	}
+	fmt.Println("Unattributed: no view of the variant before converting, or outside the")
+	fmt.Println("attribution window. Mismatched: shown another variant. See 'hlg attribution'.")
+}
+
+// printTraffic prints the layer and the share of visitors exposed to the test
+func printTraffic(ctx context.Context, s *store.SQLiteStore, test *store.Test) error {
+	holdout, err := s.GetHoldoutPercent(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get holdout: %w", err)
+	}
+	layers, err := s.GetLayers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get layers: %w", err)
+	}
+
+	layerSize := len(layers[test.Layer])
+	if test.Layer != "" {
+		fmt.Printf("LAYER: %s (%d running tests)\n", test.Layer, layerSize)
+	}
+	if test.Layer != "" || holdout > 0 {
+		fmt.Printf("TRAFFIC: %.1f%% of visitors (%g%% holdout)\n", assign.TrafficShare(holdout, layerSize)*100, holdout)
+	}
+	return nil
+}
+
 func formatPercent(rate float64) string {
 	if rate == 0 {
 		return "0%"
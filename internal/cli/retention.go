@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newRetentionCmd())
+}
+
+func newRetentionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retention",
+		Short: "Show or change how long raw events are kept",
+		Long: `Limit how long raw events are kept. Older events are rolled up into
+daily counts per variant: results are unchanged and visitors are still
+deduplicated, but exports show daily totals instead of individual events
+for those days.
+
+The server applies the policy every hour. Use preview to see what would be
+rolled up and apply to do it now.
+
+Examples:
+  hlg retention
+  hlg retention set 90
+  hlg retention set 365 --test pricing
+  hlg retention set off --test hero
+  hlg retention clear hero
+  hlg retention preview
+  hlg retention apply --vacuum`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showRetention()
+		},
+	}
+
+	var testName string
+	setCmd := &cobra.Command{
+		Use:   "set <days|off>",
+		Short: "Set the global retention, or a test's with --test",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			days, err := parseRetentionDays(args[0])
+			if err != nil {
+				return err
+			}
+			return setRetention(testName, &days)
+		},
+	}
+	setCmd.Flags().StringVar(&testName, "test", "", "override the global retention for this test")
+	cmd.AddCommand(setCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear <test>",
+		Short: "Make a test use the global retention again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setRetention(args[0], nil)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "preview",
+		Short: "Show the raw events the next run would roll up",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRetention(true, false)
+		},
+	})
+
+	var vacuum bool
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Roll up expired raw events now",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRetention(false, vacuum)
+		},
+	}
+	applyCmd.Flags().BoolVar(&vacuum, "vacuum", false, "rewrite the database afterwards to shrink the file (blocks writes while running)")
+	cmd.AddCommand(applyCmd)
+
+	return cmd
+}
+
+func parseRetentionDays(arg string) (int, error) {
+	if arg == "off" {
+		return 0, nil
+	}
+	days, err := strconv.Atoi(arg)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("invalid days %q. Example: hlg retention set 90", arg)
+	}
+	return days, nil
+}
+
+func formatRetention(days int) string {
+	if days == 0 {
+		return "forever"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+func showRetention() error {
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		global, err := s.GetRetentionDays(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get retention: %w", err)
+		}
+		fmt.Printf("Raw events are kept %s\n", formatRetention(global))
+
+		tests, err := s.ListTests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list tests: %w", err)
+		}
+		for _, t := range tests {
+			if t.RetentionDays != nil {
+				fmt.Printf("  %s: %s\n", t.Name, formatRetention(*t.RetentionDays))
+			}
+		}
+		return nil
+	})
+}
+
+func setRetention(testName string, days *int) error {
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		if testName == "" {
+			if err := s.SetRetentionDays(ctx, *days); err != nil {
+				return err
+			}
+			fmt.Printf("Raw events are now kept %s\n", formatRetention(*days))
+			return nil
+		}
+
+		err := s.SetTestRetentionDays(ctx, testName, days)
+		if err == store.ErrNotFound {
+			return fmt.Errorf("test '%s' not found. Run 'hlg list' to see available tests", testName)
+		}
+		if err != nil {
+			return err
+		}
+
+		if days == nil {
+			fmt.Printf("Test '%s' now uses the global retention\n", testName)
+		} else {
+			fmt.Printf("Raw events for '%s' are now kept %s\n", testName, formatRetention(*days))
+		}
+		return nil
+	})
+}
+
+func runRetention(dryRun, vacuum bool) error {
+	return withStore(func(s *store.SQLiteStore) error {
+		ctx := context.Background()
+
+		results, err := s.ApplyRetention(ctx, time.Now(), dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to apply retention: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("No retention policy set. Set one with: hlg retention set <days>")
+			return nil
+		}
+
+		header := "EVENTS ROLLED UP"
+		if dryRun {
+			header = "EVENTS TO ROLL UP"
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "TEST\tKEEP\tBEFORE\t%s\n", header)
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", r.TestName, formatRetention(r.Days), r.Cutoff.Format("2006-01-02"), r.Events)
+		}
+		w.Flush()
+
+		if vacuum && !dryRun {
+			if err := s.Vacuum(ctx, true); err != nil {
+				return err
+			}
+			fmt.Println("Database vacuumed")
+		}
+		return nil
+	})
+}
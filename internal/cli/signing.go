@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newSigningCmd())
+}
+
+func newSigningCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "signing",
+		Short: "Require signed conversion beacons",
+		Long: `Turn beacon signing on or off.
+
+With signing on, the server answers each view beacon with a short-lived
+HMAC signature of the visitor's variant. hlg.js sends it back with the
+conversion, and conversions without a valid signature are rejected, so
+nobody can forge conversions for visitors who never received a view.
+
+Examples:
+  hlg signing on
+  hlg signing status
+  hlg signing rotate
+  hlg signing off`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "on",
+		Short: "Enable beacon signing",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				ctx := context.Background()
+
+				// Keep an existing secret so outstanding signatures stay valid
+				if _, err := s.GetSetting(ctx, store.SettingBeaconSecret); err == store.ErrNotFound {
+					if err := saveNewSecret(ctx, s); err != nil {
+						return err
+					}
+				} else if err != nil {
+					return fmt.Errorf("failed to load secret: %w", err)
+				}
+
+				if err := s.SetSetting(ctx, store.SettingBeaconSigning, "on"); err != nil {
+					return fmt.Errorf("failed to enable signing: %w", err)
+				}
+				fmt.Println("Beacon signing enabled. Conversions now require a signature issued with a view.")
+				fmt.Println("Visitors pick up the new hlg.js within a minute (script cache).")
+				return nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "off",
+		Short: "Disable beacon signing",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				if err := s.SetSetting(context.Background(), store.SettingBeaconSigning, "off"); err != nil {
+					return fmt.Errorf("failed to disable signing: %w", err)
+				}
+				fmt.Println("Beacon signing disabled.")
+				return nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rotate",
+		Short: "Generate a new signing secret (invalidates issued signatures)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				if err := saveNewSecret(context.Background(), s); err != nil {
+					return err
+				}
+				fmt.Println("Signing secret rotated. Visitors get new signatures on their next page view.")
+				return nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show whether beacon signing is enabled",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *store.SQLiteStore) error {
+				value, err := s.GetSetting(context.Background(), store.SettingBeaconSigning)
+				if err != nil && err != store.ErrNotFound {
+					return fmt.Errorf("failed to load setting: %w", err)
+				}
+				if value == "on" {
+					fmt.Println("Beacon signing: on")
+				} else {
+					fmt.Println("Beacon signing: off")
+				}
+				return nil
+			})
+		},
+	})
+
+	return cmd
+}
+
+func saveNewSecret(ctx context.Context, s *store.SQLiteStore) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate secret: %w", err)
+	}
+	if err := s.SetSetting(ctx, store.SettingBeaconSecret, hex.EncodeToString(secret)); err != nil {
+		return fmt.Errorf("failed to save secret: %w", err)
+	}
+	return nil
+}
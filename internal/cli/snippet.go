@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newSnippetCmd())
+}
+
+func newSnippetCmd() *cobra.Command {
+	var pageURL string
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "snippet",
+		Short: "Print an anti-flicker snippet for your page's <head>",
+		Long: `Print HTML that stops visitors seeing the original text flash before
+hlg.js swaps in their variant.
+
+The snippet hides data-attribute tests and the elements running tests
+change (--target and multi-element variants) until hlg.js has applied them, or until --timeout passes.
+Paste it at the top of <head>, replacing your hlg.js script tag.
+
+With --url, only that page's tests are hidden and hlg.js is loaded
+synchronously with their config inlined (/hlg.js?url=...), so no second
+request is needed.
+
+Examples:
+  hlg snippet
+  hlg snippet --url /pricing
+  hlg snippet --url / --timeout 500ms`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if timeout <= 0 {
+				return fmt.Errorf("--timeout must be positive, got %s", timeout)
+			}
+
+			return withStore(func(s *store.SQLiteStore) error {
+				ctx := context.Background()
+
+				serverURL := "http://localhost:8080"
+				if url, err := s.GetSetting(ctx, "server_url"); err == nil && url != "" {
+					serverURL = url
+				}
+
+				var tests []*store.Test
+				var err error
+				if pageURL != "" {
+					tests, err = s.GetTestsByURL(ctx, pageURL)
+				} else {
+					tests, err = s.ListTests(ctx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to list tests: %w", err)
+				}
+
+				var selectors []string
+				seen := map[string]bool{}
+				hide := func(selector string) {
+					if selector != "" && !seen[selector] {
+						seen[selector] = true
+						selectors = append(selectors, selector)
+					}
+				}
+				for _, t := range tests {
+					if t.State != store.StateRunning {
+						continue
+					}
+					hide(t.Target)
+					for _, p := range t.Payloads {
+						for _, c := range p.Changes {
+							hide(c.Selector)
+						}
+					}
+				}
+
+				fmt.Print(server.AntiFlickerSnippet(serverURL, pageURL, selectors, timeout))
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&pageURL, "url", "", "page path to inline tests for (e.g. \"/pricing\")")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Second, "show the original text after this long regardless")
+	return cmd
+}
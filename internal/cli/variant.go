@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(newVariantCmd())
+}
+
+func newVariantCmd() *cobra.Command {
+	var label string
+	var sets []string
+
+	cmd := &cobra.Command{
+		Use:   "variant <test> [index payload | index --set SELECTOR=PAYLOAD...]",
+		Short: "Show or set what a variant changes on the page",
+		Long: `Show a test's variants, or set what one changes on its --target element.
+
+Variants replace the target's text by default. A payload can instead
+replace its HTML, set attributes, or toggle CSS classes:
+
+  text:TEXT               replace the text
+  html:MARKUP             replace the inner HTML (inline tags only, sanitized)
+  attrs:NAME=VALUE;...    set attributes, e.g. an image src
+  class:+ADD -REMOVE ...  add and remove CSS classes
+  {"type":"html",...}     a payload as JSON
+
+To change several elements together (headline, subheadline and CTA as
+one variant), repeat --set with a selector and payload for each. They are
+applied at once, when all of the elements are on the page.
+
+Results name typed variants after their payload, or after --label.
+
+Examples:
+  hlg variant hero
+  hlg variant hero 1 "html:Ship <em>faster</em>"
+  hlg variant hero-image 1 "attrs:src=/img/hero-b.png;alt=Team at work"
+  hlg variant cta 1 "class:+btn-green -btn-blue" --label Green
+  hlg variant landing 1 --set "h1=text:Ship faster" \
+    --set ".subhead=text:Deploy in minutes" --set "a.cta=text:Start free" --label Speed`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case len(args) == 1 && len(sets) == 0, len(args) == 3 && len(sets) == 0, len(args) == 2 && len(sets) > 0:
+				return nil
+			}
+			return fmt.Errorf("expected a test name, optionally followed by a variant index and a payload or --set changes")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			testName := args[0]
+
+			return withStore(func(s *store.SQLiteStore) error {
+				ctx := context.Background()
+
+				test, err := s.GetTest(ctx, testName)
+				if err == store.ErrNotFound {
+					return fmt.Errorf("test '%s' not found. Run 'hlg list' to see available tests", testName)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to get test: %w", err)
+				}
+				payloads := test.VariantPayloads()
+
+				if len(args) == 1 {
+					for i, p := range payloads {
+						fmt.Printf("  [%d] %s\n", i, describePayload(p))
+						for _, c := range p.Changes {
+							fmt.Printf("      %s: %s\n", c.Selector, describePayload(c.VariantPayload))
+						}
+					}
+					return nil
+				}
+
+				index, err := strconv.Atoi(args[1])
+				if err != nil || index < 0 || index >= len(payloads) {
+					return fmt.Errorf("variant %s doesn't exist. Test '%s' has variants 0-%d", args[1], testName, len(payloads)-1)
+				}
+				var payload store.VariantPayload
+				if len(sets) > 0 {
+					payload, err = parseChanges(sets)
+				} else {
+					payload, err = parsePayload(args[2])
+				}
+				if err != nil {
+					return err
+				}
+				if label != "" {
+					payload.Label = label
+				}
+
+				payloads[index] = payload
+				if err := s.SetTestPayloads(ctx, testName, payloads); err != nil {
+					return err
+				}
+
+				// Show the payload as stored, with HTML sanitized
+				test, err = s.GetTest(ctx, testName)
+				if err != nil {
+					return fmt.Errorf("failed to get test: %w", err)
+				}
+				fmt.Printf("Variant %d of '%s' set to %s\n", index, testName, describePayload(test.VariantPayloads()[index]))
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&label, "label", "", "name shown in results")
+	cmd.Flags().StringArrayVar(&sets, "set", nil, "SELECTOR=PAYLOAD change of a multi-element variant (repeatable)")
+	return cmd
+}
+
+// parsePayload parses a "type:value" payload or one given as JSON
+func parsePayload(spec string) (store.VariantPayload, error) {
+	var p store.VariantPayload
+	if strings.HasPrefix(strings.TrimSpace(spec), "{") {
+		if err := json.Unmarshal([]byte(spec), &p); err != nil {
+			return p, fmt.Errorf("invalid payload JSON: %w", err)
+		}
+		return p, p.Validate()
+	}
+
+	kind, arg, ok := strings.Cut(spec, ":")
+	if !ok || arg == "" {
+		return p, fmt.Errorf("invalid payload %q. Use text:TEXT, html:MARKUP, attrs:NAME=VALUE;... or class:+ADD -REMOVE", spec)
+	}
+
+	p.Type = store.PayloadType(kind)
+	switch p.Type {
+	case store.PayloadText:
+		p.Text = arg
+	case store.PayloadHTML:
+		p.HTML = arg
+	case store.PayloadAttrs:
+		p.Attrs = map[string]string{}
+		for _, pair := range strings.Split(arg, ";") {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				return p, fmt.Errorf("invalid attribute %q. Use NAME=VALUE", pair)
+			}
+			p.Attrs[strings.TrimSpace(name)] = value
+		}
+	case store.PayloadClass:
+		for _, c := range strings.Fields(arg) {
+			if strings.HasPrefix(c, "-") {
+				p.Remove = append(p.Remove, c[1:])
+			} else {
+				p.Add = append(p.Add, strings.TrimPrefix(c, "+"))
+			}
+		}
+	}
+
+	return p, p.Validate()
+}
+
+// parseChanges parses SELECTOR=PAYLOAD changes into a multi-element
+// payload. Selectors may contain "=", so each is split where its payload
+// starts.
+func parseChanges(sets []string) (store.VariantPayload, error) {
+	p := store.VariantPayload{Type: store.PayloadMulti}
+	for _, set := range sets {
+		split := -1
+		for _, prefix := range []string{"=text:", "=html:", "=attrs:", "=class:", "={"} {
+			if i := strings.Index(set, prefix); i > 0 && (split < 0 || i < split) {
+				split = i
+			}
+		}
+		if split < 0 {
+			return p, fmt.Errorf("invalid change %q. Use SELECTOR=PAYLOAD, e.g. \"h1=text:Ship faster\"", set)
+		}
+
+		change, err := parsePayload(set[split+1:])
+		if err != nil {
+			return p, err
+		}
+		p.Changes = append(p.Changes, store.ElementChange{Selector: strings.TrimSpace(set[:split]), VariantPayload: change})
+	}
+	return p, p.Validate()
+}
+
+func describePayload(p store.VariantPayload) string {
+	label := p.Label
+	p.Label = ""
+
+	var desc string
+	switch p.Type {
+	case store.PayloadHTML:
+		desc = "html " + p.HTML
+	case store.PayloadAttrs, store.PayloadClass:
+		desc = string(p.Type) + " " + p.Name()
+	case store.PayloadMulti:
+		desc = fmt.Sprintf("%d elements", len(p.Changes))
+	default:
+		desc = fmt.Sprintf("%q", p.Text)
+	}
+	if label != "" {
+		desc += fmt.Sprintf(" (%q)", label)
+	}
+	return desc
+}
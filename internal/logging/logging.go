@@ -0,0 +1,81 @@
+// Package logging builds the server's structured logger from CLI options.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Options configures the logger
+type Options struct {
+	Level      string // debug, info, warn or error
+	Format     string // text or json
+	File       string // Log to this file instead of stderr
+	MaxSizeMB  int    // Rotate the file when it grows past this size; 0 disables rotation
+	MaxBackups int    // Rotated files to keep
+}
+
+// DefaultOptions logs info and above as text to stderr
+func DefaultOptions() Options {
+	return Options{
+		Level:      "info",
+		Format:     "text",
+		MaxSizeMB:  100,
+		MaxBackups: 5,
+	}
+}
+
+// ParseLevel converts a level name to a slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", name)
+}
+
+// New returns a logger for opts. Close the returned closer on exit to
+// flush and close the log file; it is a no-op when logging to stderr.
+func New(opts Options) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if opts.File != "" {
+		out, err = OpenRotatingFile(opts.File, int64(opts.MaxSizeMB)<<20, opts.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		out.Close()
+		return nil, nil, fmt.Errorf("invalid log format %q: must be text or json", opts.Format)
+	}
+
+	return slog.New(handler), out, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+// API keys look like hlg_<id>_<secret>. Only the id and a SHA-256 of the
+// full key are stored, as "id:hash:name" entries in the api_keys setting.
+const apiKeyPrefix = "hlg_"
+
+// GenerateAPIKey creates a new API key and the entry to store for it
+func GenerateAPIKey(name string) (key, entry string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	idHex := hex.EncodeToString(id)
+	key = apiKeyPrefix + idHex + "_" + hex.EncodeToString(secret)
+	return key, idHex + ":" + hashAPIKey(key) + ":" + name, nil
+}
+
+// ParseAPIKeyEntry splits a stored entry into its id and name
+func ParseAPIKeyEntry(entry string) (id, name string) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) == 3 {
+		name = parts[2]
+	}
+	return parts[0], name
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// validAPIKey checks a presented key against the stored entries
+func (s *Server) validAPIKey(ctx context.Context, key string) (bool, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return false, nil
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return false, nil
+	}
+
+	entries, err := s.store.GetSettingList(ctx, store.SettingAPIKeys)
+	if err != nil {
+		return false, err
+	}
+
+	hash := hashAPIKey(key)
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) >= 2 && parts[0] == id {
+			return subtle.ConstantTimeCompare([]byte(parts[1]), []byte(hash)) == 1, nil
+		}
+	}
+	return false, nil
+}
+
+// apiKeyAuth protects server-to-server endpoints with a Bearer API key
+func (s *Server) apiKeyAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Missing API key", http.StatusUnauthorized)
+			return
+		}
+
+		valid, err := s.validAPIKey(r.Context(), strings.TrimSpace(key))
+		if err != nil {
+			s.serverError(w, "Failed to verify API key", err)
+			return
+		}
+		if !valid {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
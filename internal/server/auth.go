@@ -7,9 +7,19 @@ import (
 
 const tokenCookieName = "ht_token"
 
-// authMiddleware checks for valid token in query param or cookie
+// authMiddleware checks for valid token in query param or cookie, or defers
+// to the Auth hook when one is configured
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Auth != nil {
+			if !s.cfg.Auth(r) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Check query param first
 		queryToken := r.URL.Query().Get("token")
 		if queryToken != "" {
@@ -26,6 +36,7 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 
 				// Redirect to same path without token param
 				newURL := *r.URL
+				newURL.Path = s.path(r.URL.Path)
 				q := newURL.Query()
 				q.Del("token")
 				newURL.RawQuery = q.Encode()
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+// Scheduled backups are named hlg-<UTC timestamp>.db, plus .gz when
+// compressed, so sorting by name sorts by age
+const (
+	backupPrefix     = "hlg-"
+	backupTimeFormat = "20060102-150405"
+)
+
+// backupName returns the file name of a scheduled backup taken at t
+func backupName(t time.Time, compress bool) string {
+	name := backupPrefix + t.UTC().Format(backupTimeFormat) + ".db"
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// listBackups returns the scheduled backups in dir, oldest first, with the
+// time each was taken
+func listBackups(dir string) ([]string, []time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			if _, ok := backupTime(e.Name()); ok {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+
+	times := make([]time.Time, len(names))
+	for i, name := range names {
+		times[i], _ = backupTime(name)
+	}
+	return names, times, nil
+}
+
+// backupTime parses the time from a scheduled backup's file name
+func backupTime(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, backupPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp = strings.TrimSuffix(stamp, ".gz")
+	stamp, ok = strings.CutSuffix(stamp, ".db")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(backupTimeFormat, stamp)
+	return t, err == nil
+}
+
+// runBackups backs up the database to BackupDir every BackupInterval until
+// ctx is cancelled. The first backup is taken at startup unless a recent
+// one exists.
+func (s *Server) runBackups(ctx context.Context, b store.Backuper) {
+	dir, interval := s.cfg.BackupDir, s.cfg.BackupInterval
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		s.log.Error("failed to create backup directory", "dir", dir, "error", err)
+		return
+	}
+
+	wait := time.Duration(0)
+	if _, times, err := listBackups(dir); err == nil && len(times) > 0 {
+		wait = interval - s.now().Sub(times[len(times)-1])
+	}
+	if wait < 0 {
+		wait = 0
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		s.backup(ctx, b)
+		timer.Reset(interval)
+	}
+}
+
+// backup takes a scheduled backup and deletes all but the newest
+// BackupKeep
+func (s *Server) backup(ctx context.Context, b store.Backuper) {
+	dir := s.cfg.BackupDir
+	path := filepath.Join(dir, backupName(s.now(), s.cfg.BackupGzip))
+
+	start := time.Now()
+	if err := b.Backup(ctx, path, s.cfg.BackupGzip); err != nil {
+		if ctx.Err() == nil {
+			s.log.Error("backup failed", "path", path, "error", err)
+		}
+		return
+	}
+	s.log.Info("backed up database", "path", path, "duration", time.Since(start))
+
+	if s.cfg.BackupKeep <= 0 {
+		return
+	}
+	names, _, err := listBackups(dir)
+	if err != nil {
+		s.log.Error("failed to list backups", "dir", dir, "error", err)
+		return
+	}
+	for len(names) > s.cfg.BackupKeep {
+		old := filepath.Join(dir, names[0])
+		if err := os.Remove(old); err != nil {
+			s.log.Error("failed to remove old backup", "path", old, "error", err)
+		} else {
+			s.log.Info("removed old backup", "path", old)
+		}
+		names = names[1:]
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+//go:embed bots.txt
+var botList string
+
+// botPatterns holds the lowercased User-Agent substrings from bots.txt
+var botPatterns = parseBotList(botList)
+
+// Reasons a beacon was filtered as bot traffic
+const (
+	filterBotUserAgent = "bot_user_agent"
+	filterAutomation   = "automation"
+	filterDenylist     = "ip_denylist"
+)
+
+func parseBotList(list string) []string {
+	var patterns []string
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.ToLower(line))
+	}
+	return patterns
+}
+
+// isBotUserAgent reports whether the User-Agent matches a known bot pattern
+func isBotUserAgent(ua string) bool {
+	ua = strings.ToLower(ua)
+	for _, p := range botPatterns {
+		if strings.Contains(ua, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectBot returns the reason a beacon should be filtered, or "" for
+// traffic that looks human. Server beacons (src "server") come from a
+// backend's HTTP library, so they skip the User-Agent check.
+func (s *Server) detectBot(ctx context.Context, r *http.Request, req *BeaconRequest) (string, error) {
+	if req.Source != "server" && isBotUserAgent(r.UserAgent()) {
+		return filterBotUserAgent, nil
+	}
+
+	// navigator.webdriver is set by Selenium, Puppeteer, Playwright and
+	// headless Chrome, even when the User-Agent is spoofed
+	if req.Webdriver {
+		return filterAutomation, nil
+	}
+
+	denied, err := s.isDeniedIP(ctx, clientIP(r))
+	if err != nil {
+		return "", err
+	}
+	if denied {
+		return filterDenylist, nil
+	}
+
+	return "", nil
+}
+
+// isDeniedIP checks the client IP against the IP/CIDR denylist setting
+func (s *Server) isDeniedIP(ctx context.Context, ip net.IP) (bool, error) {
+	if ip == nil {
+		return false, nil
+	}
+
+	entries, err := s.store.GetSettingList(ctx, store.SettingIPDenylist)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err == nil && network.Contains(ip) {
+				return true, nil
+			}
+			continue
+		}
+		if denied := net.ParseIP(entry); denied != nil && denied.Equal(ip) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// clientIP returns the request's client IP. X-Forwarded-For is only honored
+// when the direct peer is a loopback or private address (a local reverse
+// proxy), and then only its last entry, which the proxy itself appended.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	if ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if forwarded := net.ParseIP(strings.TrimSpace(parts[len(parts)-1])); forwarded != nil {
+				return forwarded
+			}
+		}
+	}
+
+	return ip
+}
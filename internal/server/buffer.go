@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+const rejectBufferFull = "buffer_full"
+
+// errBufferFull is returned when the write-behind buffer has no room
+var errBufferFull = errors.New("event buffer full")
+
+// Attempts to write a batch before its events are dropped
+const flushAttempts = 3
+
+// eventBuffer queues events in memory and writes them to the store in
+// batches from a background goroutine, so beacons don't wait on SQLite.
+// Deduplication still happens in the store when the batch is written.
+type eventBuffer struct {
+	store     store.Store
+	log       *slog.Logger
+	metrics   *metrics
+	batchSize int
+	interval  time.Duration
+
+	mu      sync.RWMutex // Guards closed against sends on the closed queue
+	closed  bool
+	queue   chan store.Event
+	pending atomic.Int64 // Queued plus in the batch being written
+	flushes chan chan struct{}
+	done    chan struct{}
+}
+
+// newEventBuffer starts a buffer holding up to size events, or returns nil
+// (write synchronously) if size <= 0
+func newEventBuffer(st store.Store, size, batchSize int, interval time.Duration, log *slog.Logger, m *metrics) *eventBuffer {
+	if size <= 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	b := &eventBuffer{
+		store:     st,
+		log:       log,
+		metrics:   m,
+		batchSize: batchSize,
+		interval:  interval,
+		queue:     make(chan store.Event, size),
+		flushes:   make(chan chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Enqueue adds an event without blocking. It returns errBufferFull when
+// the queue is full or the buffer has been closed.
+func (b *eventBuffer) Enqueue(e store.Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return errBufferFull
+	}
+	if b.pending.Add(1) > int64(cap(b.queue)) {
+		b.pending.Add(-1)
+		return errBufferFull
+	}
+	// pending never exceeds the queue capacity, so this doesn't block
+	b.queue <- e
+	return nil
+}
+
+// Len returns the number of events waiting to be written
+func (b *eventBuffer) Len() int {
+	return int(b.pending.Load())
+}
+
+// Cap returns the queue capacity
+func (b *eventBuffer) Cap() int {
+	return cap(b.queue)
+}
+
+// Close stops accepting events and waits until the queued ones are written
+// or ctx is done
+func (b *eventBuffer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("timed out flushing buffered events")
+	}
+}
+
+// Flush writes the events queued so far and waits until they are stored,
+// so lookups that read the store see them
+func (b *eventBuffer) Flush(ctx context.Context) error {
+	if b.Len() == 0 {
+		return nil
+	}
+
+	written := make(chan struct{})
+	select {
+	case b.flushes <- written:
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-written:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *eventBuffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]store.Event, 0, b.batchSize)
+	for {
+		select {
+		case e, ok := <-b.queue:
+			if !ok {
+				b.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= b.batchSize {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			b.flush(batch)
+			batch = batch[:0]
+		case written := <-b.flushes:
+			for n := len(b.queue); n > 0; n-- {
+				batch = append(batch, <-b.queue)
+			}
+			b.flush(batch)
+			batch = batch[:0]
+			close(written)
+		}
+	}
+}
+
+// flush writes a batch, retrying transient failures such as a locked
+// database before giving up on it
+func (b *eventBuffer) flush(batch []store.Event) {
+	if len(batch) == 0 {
+		return
+	}
+	defer b.pending.Add(-int64(len(batch)))
+
+	var err error
+	for attempt := 1; attempt <= flushAttempts; attempt++ {
+		start := time.Now()
+		err = recordEvents(context.Background(), b.store, batch)
+		b.metrics.storeWrite("record_events", start)
+		if err == nil {
+			b.metrics.flushedEvents.Add("flushed", int64(len(batch)))
+			return
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+
+	b.metrics.flushedEvents.Add("dropped", int64(len(batch)))
+	b.log.Error("dropped buffered events", "events", len(batch), "error", err)
+}
+
+// recordEvents writes a batch in one call when the store supports it,
+// otherwise one event at a time. Idempotency keys need the batch call.
+func recordEvents(ctx context.Context, st store.Store, events []store.Event) error {
+	if batcher, ok := st.(store.EventBatcher); ok {
+		return batcher.RecordEvents(ctx, events)
+	}
+	for _, e := range events {
+		if err := st.RecordEvent(ctx, e.TestName, e.Variant, e.EventType, e.VisitorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordEvent stores an event through the buffer when enabled, otherwise
+// synchronously
+func (s *Server) recordEvent(ctx context.Context, e store.Event) error {
+	e.CreatedAt = s.now()
+	if s.events != nil {
+		return s.events.Enqueue(e)
+	}
+
+	start := time.Now()
+	err := recordEvents(ctx, s.store, []store.Event{e})
+	s.metrics.storeWrite("record_event", start)
+	return err
+}
+
+// flushEvents writes buffered events before a lookup that must see the
+// visitor's latest views
+func (s *Server) flushEvents(ctx context.Context) error {
+	if s.events == nil {
+		return nil
+	}
+	return s.events.Flush(ctx)
+}
+
+// Close writes any buffered events to the store. Run calls it on shutdown;
+// call it yourself before closing the store when mounting Handler directly.
+func (s *Server) Close(ctx context.Context) error {
+	if s.events == nil {
+		return nil
+	}
+	return s.events.Close(ctx)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+const (
+	maxConversionBody  = 1 << 20 // 1 MB
+	maxConversionBatch = 1000
+)
+
+// Conversion result statuses
+const (
+	ConversionRecorded   = "recorded"
+	ConversionDuplicate  = "duplicate"
+	ConversionNotExposed = "not_exposed"
+	ConversionError      = "error"
+)
+
+// ConversionRequest is one conversion reported by a backend. It identifies
+// the visitor by vid or by a user_id previously linked to one, and the test
+// directly or by conversion goal.
+type ConversionRequest struct {
+	VisitorID      string  `json:"vid,omitempty"`
+	UserID         string  `json:"user_id,omitempty"`
+	TestName       string  `json:"test,omitempty"`
+	Goal           string  `json:"goal,omitempty"`
+	Value          float64 `json:"value,omitempty"`
+	IdempotencyKey string  `json:"idempotency_key,omitempty"`
+	Timestamp      int64   `json:"timestamp,omitempty"` // Unix seconds; defaults to now
+}
+
+// conversionBody accepts either a single conversion or a batch
+type conversionBody struct {
+	Conversions []ConversionRequest `json:"conversions"`
+	ConversionRequest
+}
+
+// ConversionResult reports what happened to one submitted conversion
+type ConversionResult struct {
+	Index  int      `json:"index"`
+	Status string   `json:"status"`
+	Tests  []string `json:"tests,omitempty"` // Tests the conversion was recorded for
+	Error  string   `json:"error,omitempty"`
+}
+
+type ConversionResponse struct {
+	Recorded   int                `json:"recorded"`
+	Duplicates int                `json:"duplicates"`
+	Errors     int                `json:"errors"`
+	Results    []ConversionResult `json:"results"`
+}
+
+func (s *Server) handleConversions(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxConversionBody)
+	var body conversionBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	items := body.Conversions
+	if items == nil {
+		items = []ConversionRequest{body.ConversionRequest}
+	}
+	if len(items) == 0 {
+		http.Error(w, "No conversions", http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxConversionBatch {
+		http.Error(w, fmt.Sprintf("Too many conversions (max %d per request)", maxConversionBatch), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	resp := ConversionResponse{Results: make([]ConversionResult, len(items))}
+	for i := range items {
+		result, err := s.recordConversion(ctx, &items[i])
+		if err != nil {
+			result = ConversionResult{Status: ConversionError, Error: err.Error()}
+		}
+		result.Index = i
+
+		switch result.Status {
+		case ConversionRecorded:
+			resp.Recorded++
+		case ConversionDuplicate:
+			resp.Duplicates++
+		case ConversionError:
+			resp.Errors++
+		}
+		resp.Results[i] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// recordConversion resolves the visitor, tests and variants for one
+// conversion and records it. Errors are reported per item.
+func (s *Server) recordConversion(ctx context.Context, req *ConversionRequest) (ConversionResult, error) {
+	if req.VisitorID == "" && req.UserID == "" {
+		return ConversionResult{}, errors.New("vid or user_id is required")
+	}
+	if (req.TestName == "") == (req.Goal == "") {
+		return ConversionResult{}, errors.New("exactly one of test or goal is required")
+	}
+	if math.IsNaN(req.Value) || math.IsInf(req.Value, 0) {
+		return ConversionResult{}, errors.New("invalid value")
+	}
+	if len(req.VisitorID) > maxVisitorIDLen || len(req.UserID) > maxVisitorIDLen || len(req.IdempotencyKey) > maxVisitorIDLen {
+		return ConversionResult{}, errors.New("field too long")
+	}
+
+	var timestamp time.Time
+	if req.Timestamp > 0 {
+		timestamp = time.Unix(req.Timestamp, 0)
+		if timestamp.After(s.now().Add(5 * time.Minute)) {
+			return ConversionResult{}, errors.New("timestamp is in the future")
+		}
+	}
+
+	visitorIDs, err := s.resolveVisitors(ctx, req)
+	if err != nil {
+		return ConversionResult{}, err
+	}
+	if len(visitorIDs) == 0 {
+		return ConversionResult{}, fmt.Errorf("unknown user_id %q", req.UserID)
+	}
+
+	var tests []*store.Test
+	if req.TestName != "" {
+		test, err := s.store.GetTest(ctx, req.TestName)
+		if err == store.ErrNotFound {
+			return ConversionResult{}, fmt.Errorf("test %q not found", req.TestName)
+		}
+		if err != nil {
+			return ConversionResult{}, err
+		}
+		tests = []*store.Test{test}
+	} else {
+		tests, err = s.store.GetTestsByGoal(ctx, req.Goal)
+		if err != nil {
+			return ConversionResult{}, err
+		}
+		if len(tests) == 0 {
+			return ConversionResult{}, fmt.Errorf("no running tests with goal %q", req.Goal)
+		}
+	}
+
+	result := ConversionResult{Status: ConversionNotExposed}
+	for _, test := range tests {
+		// Credit the variant the visitor was actually shown
+		visitorID, variant, err := s.exposure(ctx, test.Name, visitorIDs)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return ConversionResult{}, err
+		}
+
+		start := time.Now()
+		recorded, err := s.store.RecordConversion(ctx, store.Conversion{
+			TestName:       test.Name,
+			Variant:        variant,
+			VisitorID:      visitorID,
+			Value:          req.Value,
+			IdempotencyKey: req.IdempotencyKey,
+			Timestamp:      timestamp,
+		})
+		s.metrics.storeWrite("record_conversion", start)
+		if err != nil {
+			return ConversionResult{}, err
+		}
+
+		if recorded {
+			result.Status = ConversionRecorded
+			result.Tests = append(result.Tests, test.Name)
+		} else if result.Status == ConversionNotExposed {
+			result.Status = ConversionDuplicate
+		}
+	}
+
+	return result, nil
+}
+
+// resolveVisitors returns the visitor IDs a conversion applies to. When both
+// vid and user_id are given the two are linked for later conversions.
+func (s *Server) resolveVisitors(ctx context.Context, req *ConversionRequest) ([]string, error) {
+	if req.VisitorID == "" {
+		return s.store.GetVisitorIDs(ctx, req.UserID)
+	}
+	if req.UserID != "" {
+		if err := s.store.LinkIdentity(ctx, req.VisitorID, req.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return []string{req.VisitorID}, nil
+}
+
+// exposure finds the first of the visitor IDs that viewed the test and the
+// variant it saw
+func (s *Server) exposure(ctx context.Context, testName string, visitorIDs []string) (string, int, error) {
+	if err := s.flushEvents(ctx); err != nil {
+		return "", 0, err
+	}
+	for _, vid := range visitorIDs {
+		variant, err := s.store.GetVisitorVariant(ctx, testName, vid)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		return vid, variant, nil
+	}
+	return "", 0, store.ErrNotFound
+}
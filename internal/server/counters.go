@@ -0,0 +1,51 @@
+package server
+
+import "sync"
+
+// counters is a set of named counters safe for concurrent use
+type counters struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newCounters() *counters {
+	return &counters{counts: make(map[string]int64)}
+}
+
+// Inc increments the named counter
+func (c *counters) Inc(name string) {
+	c.mu.Lock()
+	c.counts[name]++
+	c.mu.Unlock()
+}
+
+// Snapshot returns a copy of all counters
+func (c *counters) Snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]int64, len(c.counts))
+	for k, v := range c.counts {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// Total returns the sum of all counters
+func (c *counters) Total() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var total int64
+	for _, v := range c.counts {
+		total += v
+	}
+	return total
+}
+
+// Add adds n to the named counter
+func (c *counters) Add(name string, n int64) {
+	c.mu.Lock()
+	c.counts[name] += n
+	c.mu.Unlock()
+}
@@ -7,9 +7,13 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/gkobilansky/headline-goat/internal/assign"
 	"github.com/gkobilansky/headline-goat/internal/dashboard"
 	"github.com/gkobilansky/headline-goat/internal/stats"
+	"github.com/gkobilansky/headline-goat/internal/store"
 )
 
 // Dashboard template data structures
@@ -20,7 +24,9 @@ type layoutData struct {
 }
 
 type listData struct {
-	Tests []testListItem
+	Tests            []testListItem
+	FilteredBeacons  int64
+	RejectedRequests int64
 }
 
 type testListItem struct {
@@ -39,6 +45,9 @@ type detailData struct {
 	Result             *detailResult
 	ConfidencePercent  float64
 	LeadingVariantName string
+	EditPayloads       bool   // The store can save variant payloads
+	Payloads           string // Variant payloads JSON for the editor
+	PayloadsError      string
 }
 
 type testDetailItem struct {
@@ -48,22 +57,36 @@ type testDetailItem struct {
 	CreatedAt         string
 	Source            string
 	HasSourceConflict bool
+	Layer             string
+	URL               string
+	Target            string
+	TrafficPercent    float64
+	HoldoutPercent    float64
 }
 
 type detailResult struct {
 	Variants       []detailVariant
 	Confident      bool
 	LeadingVariant int
+	CountsRepeats  bool
 }
 
 type detailVariant struct {
 	Index          int
 	Name           string
+	Changes        []string // Elements a multi-element variant changes
 	Views          int
 	Conversions    int
 	RatePercent    float64
 	CILowerPercent float64
 	CIUpperPercent float64
+	Unattributed   int
+	Mismatched     int
+
+	Events           int
+	EventsPerVisitor float64
+	EventsCILower    float64
+	EventsCIUpper    float64
 }
 
 func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
@@ -75,7 +98,7 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 			Path:   "/",
 			MaxAge: -1,
 		})
-		http.Redirect(w, r, "/dashboard", http.StatusFound)
+		http.Redirect(w, r, s.path("/dashboard"), http.StatusFound)
 		return
 	}
 
@@ -83,14 +106,20 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
 	tests, err := s.store.ListTests(ctx)
 	if err != nil {
-		http.Error(w, "Failed to load tests", http.StatusInternalServerError)
+		s.serverError(w, "Failed to load tests", err)
+		return
+	}
+
+	allStats, err := s.allVariantStats(ctx, tests)
+	if err != nil {
+		s.serverError(w, "Failed to load stats", err)
 		return
 	}
 
 	// Build list items
 	items := make([]testListItem, len(tests))
 	for i, t := range tests {
-		variantStats, _ := s.store.GetVariantStats(ctx, t.Name)
+		variantStats := allStats[t.Name]
 
 		totalViews := 0
 		totalConversions := 0
@@ -116,7 +145,11 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	s.renderDashboard(w, "Dashboard", "list.html", listData{Tests: items})
+	s.renderDashboard(w, "Dashboard", "list.html", listData{
+		Tests:            items,
+		FilteredBeacons:  s.filtered.Total(),
+		RejectedRequests: s.rejected.Total(),
+	})
 }
 
 func (s *Server) handleDashboardTest(w http.ResponseWriter, r *http.Request) {
@@ -127,22 +160,92 @@ func (s *Server) handleDashboardTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	if name, ok := strings.CutSuffix(name, "/variants"); ok {
+		s.handleDashboardVariants(w, r, name)
+		return
+	}
+
+	test, err := s.store.GetTest(context.Background(), name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.renderTestDetail(w, test, "", "")
+}
+
+// handleDashboardVariants saves the variant payloads edited on a test's
+// detail page, showing the page again with the error if they're invalid
+func (s *Server) handleDashboardVariants(w http.ResponseWriter, r *http.Request, name string) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
+	ctx := context.Background()
 	test, err := s.store.GetTest(ctx, name)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
+	text := r.FormValue("payloads")
+	var payloads []store.VariantPayload
+	if err := json.Unmarshal([]byte(text), &payloads); err != nil {
+		s.renderTestDetail(w, test, text, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	editor, ok := s.store.(store.PayloadEditor)
+	if !ok {
+		http.Error(w, "Editing variants is not supported by this store", http.StatusNotImplemented)
+		return
+	}
+	if err := editor.SetTestPayloads(ctx, name, payloads); err != nil {
+		s.renderTestDetail(w, test, text, err.Error())
+		return
+	}
+
+	s.log.Info("variant payloads updated", "test", name)
+	http.Redirect(w, r, s.path("/dashboard/test/"+url.PathEscape(name)), http.StatusSeeOther)
+}
+
+// sameOrigin rejects form posts from other sites. Browsers send Origin
+// with every POST; requests without it aren't from a cross-site form.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host || u.Host == r.Header.Get("X-Forwarded-Host")
+}
+
+// renderTestDetail renders a test's detail page. payloads and payloadsErr
+// refill the variant editor after a failed save.
+func (s *Server) renderTestDetail(w http.ResponseWriter, test *store.Test, payloads, payloadsErr string) {
+	ctx := context.Background()
+	name := test.Name
+
 	variantStats, err := s.store.GetVariantStats(ctx, name)
 	if err != nil {
-		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		s.serverError(w, "Failed to load stats", err)
 		return
 	}
 
 	result := stats.Analyze(test, variantStats)
 
+	holdout, layerSize, err := s.trafficInfo(ctx, test)
+	if err != nil {
+		s.serverError(w, "Failed to load layers", err)
+		return
+	}
+
 	// Build detail variants
 	variants := make([]detailVariant, len(result.Variants))
 	for i, v := range result.Variants {
@@ -154,6 +257,18 @@ func (s *Server) handleDashboardTest(w http.ResponseWriter, r *http.Request) {
 			RatePercent:    v.Rate * 100,
 			CILowerPercent: v.CILower * 100,
 			CIUpperPercent: v.CIUpper * 100,
+			Unattributed:   v.Unattributed,
+			Mismatched:     v.Mismatched,
+
+			Events:           v.Events,
+			EventsPerVisitor: v.EventsPerVisitor,
+			EventsCILower:    v.EventsCILower,
+			EventsCIUpper:    v.EventsCIUpper,
+		}
+		if i < len(test.Payloads) {
+			for _, c := range test.Payloads[i].Changes {
+				variants[i].Changes = append(variants[i].Changes, c.Selector+": "+c.VariantPayload.Name())
+			}
 		}
 	}
 
@@ -170,25 +285,60 @@ func (s *Server) handleDashboardTest(w http.ResponseWriter, r *http.Request) {
 			CreatedAt:         test.CreatedAt.Format("Jan 2, 2006"),
 			Source:            test.Source,
 			HasSourceConflict: test.HasSourceConflict,
+			Layer:             test.Layer,
+			URL:               test.URL,
+			Target:            test.Target,
+			TrafficPercent:    assign.TrafficShare(holdout, layerSize) * 100,
+			HoldoutPercent:    holdout,
 		},
 		Result: &detailResult{
 			Variants:       variants,
 			Confident:      result.Confident,
 			LeadingVariant: result.LeadingVariant,
+			CountsRepeats:  stats.CountsRepeats(test),
 		},
 		ConfidencePercent:  result.ConfidenceLevel * 100,
 		LeadingVariantName: leadingName,
+		Payloads:           payloads,
+		PayloadsError:      payloadsErr,
+	}
+	_, data.EditPayloads = s.store.(store.PayloadEditor)
+	if payloads == "" {
+		indented, err := json.MarshalIndent(test.VariantPayloads(), "", "  ")
+		if err != nil {
+			s.serverError(w, "Failed to encode variants", err)
+			return
+		}
+		data.Payloads = string(indented)
 	}
 
 	s.renderDashboard(w, test.Name, "detail.html", data)
 }
 
+// allVariantStats returns the variant stats of the given tests, in one
+// call when the store supports it
+func (s *Server) allVariantStats(ctx context.Context, tests []*store.Test) (map[string][]store.VariantStats, error) {
+	if reader, ok := s.store.(store.AllStatsReader); ok {
+		return reader.GetAllVariantStats(ctx)
+	}
+
+	all := make(map[string][]store.VariantStats, len(tests))
+	for _, t := range tests {
+		stats, err := s.store.GetVariantStats(ctx, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		all[t.Name] = stats
+	}
+	return all, nil
+}
+
 func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 
 	tests, err := s.store.ListTests(ctx)
 	if err != nil {
-		http.Error(w, "Failed to load tests", http.StatusInternalServerError)
+		s.serverError(w, "Failed to load tests", err)
 		return
 	}
 
@@ -197,9 +347,21 @@ func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
 		VariantName string  `json:"variant_name"`
 		Views       int     `json:"views"`
 		Conversions int     `json:"conversions"`
+		Value       float64 `json:"value"`
 		Rate        float64 `json:"rate"`
 		CILower     float64 `json:"ci_lower"`
 		CIUpper     float64 `json:"ci_upper"`
+
+		// Conversions not counted: no prior view within the attribution
+		// window, or from visitors shown another variant
+		Unattributed int `json:"unattributed"`
+		Mismatched   int `json:"mismatched"`
+
+		// Conversion events per visitor, for tests counting repeats
+		Events           int     `json:"events,omitempty"`
+		EventsPerVisitor float64 `json:"events_per_visitor,omitempty"`
+		EventsCILower    float64 `json:"events_ci_lower,omitempty"`
+		EventsCIUpper    float64 `json:"events_ci_upper,omitempty"`
 	}
 
 	type apiSignificance struct {
@@ -210,18 +372,40 @@ func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type apiTest struct {
-		Name           string             `json:"name"`
-		State          string             `json:"state"`
-		Variants       []string           `json:"variants"`
-		ConversionGoal string             `json:"conversion_goal,omitempty"`
-		CreatedAt      string             `json:"created_at"`
-		Results        []apiVariantResult `json:"results"`
-		Significance   apiSignificance    `json:"significance"`
+		Name           string                 `json:"name"`
+		State          string                 `json:"state"`
+		Variants       []string               `json:"variants"`
+		Payloads       []store.VariantPayload `json:"payloads,omitempty"`
+		ConversionGoal string                 `json:"conversion_goal,omitempty"`
+		CountMode      string                 `json:"count_mode"`
+		CountCap       int                    `json:"count_cap,omitempty"`
+		Layer          string                 `json:"layer,omitempty"`
+		TrafficShare   float64                `json:"traffic_share"`
+		CreatedAt      string                 `json:"created_at"`
+		Results        []apiVariantResult     `json:"results"`
+		Significance   apiSignificance        `json:"significance"`
+	}
+
+	holdout, err := s.store.GetHoldoutPercent(ctx)
+	if err != nil {
+		s.serverError(w, "Failed to load holdout", err)
+		return
+	}
+	layers, err := s.store.GetLayers(ctx)
+	if err != nil {
+		s.serverError(w, "Failed to load layers", err)
+		return
+	}
+
+	allStats, err := s.allVariantStats(ctx, tests)
+	if err != nil {
+		s.serverError(w, "Failed to load stats", err)
+		return
 	}
 
 	apiTests := make([]apiTest, len(tests))
 	for i, t := range tests {
-		variantStats, _ := s.store.GetVariantStats(ctx, t.Name)
+		variantStats := allStats[t.Name]
 		result := stats.Analyze(t, variantStats)
 
 		results := make([]apiVariantResult, len(result.Variants))
@@ -231,9 +415,18 @@ func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
 				VariantName: v.Name,
 				Views:       v.Views,
 				Conversions: v.Conversions,
+				Value:       v.Value,
 				Rate:        v.Rate,
 				CILower:     v.CILower,
 				CIUpper:     v.CIUpper,
+
+				Unattributed: v.Unattributed,
+				Mismatched:   v.Mismatched,
+
+				Events:           v.Events,
+				EventsPerVisitor: v.EventsPerVisitor,
+				EventsCILower:    v.EventsCILower,
+				EventsCIUpper:    v.EventsCIUpper,
 			}
 		}
 
@@ -246,7 +439,12 @@ func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
 			Name:           t.Name,
 			State:          string(t.State),
 			Variants:       t.Variants,
+			Payloads:       t.Payloads,
 			ConversionGoal: t.ConversionGoal,
+			CountMode:      string(t.CountMode),
+			CountCap:       t.CountCap,
+			Layer:          t.Layer,
+			TrafficShare:   assign.TrafficShare(holdout, len(layers[t.Layer])),
 			CreatedAt:      t.CreatedAt.Format("2006-01-02T15:04:05Z"),
 			Results:        results,
 			Significance: apiSignificance{
@@ -264,43 +462,57 @@ func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// trafficInfo returns the holdout percentage and the number of running tests
+// sharing the test's layer
+func (s *Server) trafficInfo(ctx context.Context, test *store.Test) (float64, int, error) {
+	holdout, err := s.store.GetHoldoutPercent(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	layers, err := s.store.GetLayers(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return holdout, len(layers[test.Layer]), nil
+}
+
 func (s *Server) renderDashboard(w http.ResponseWriter, title, contentTemplate string, data interface{}) {
 	// Load CSS
 	cssBytes, err := dashboard.Assets.ReadFile("assets/style.css")
 	if err != nil {
-		http.Error(w, "Failed to load styles", http.StatusInternalServerError)
+		s.serverError(w, "Failed to load styles", err)
 		return
 	}
 
 	// Load and execute content template
 	contentTmplBytes, err := dashboard.Templates.ReadFile("templates/" + contentTemplate)
 	if err != nil {
-		http.Error(w, "Failed to load template", http.StatusInternalServerError)
+		s.serverError(w, "Failed to load template", err)
 		return
 	}
 
-	contentTmpl, err := template.New("content").Parse(string(contentTmplBytes))
+	contentTmpl, err := template.New("content").Funcs(s.templateFuncs()).Parse(string(contentTmplBytes))
 	if err != nil {
-		http.Error(w, "Failed to parse template", http.StatusInternalServerError)
+		s.serverError(w, "Failed to parse template", err)
 		return
 	}
 
 	var contentBuf bytes.Buffer
 	if err := contentTmpl.Execute(&contentBuf, data); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to render template: %v", err), http.StatusInternalServerError)
+		s.serverError(w, "Failed to render template", err)
 		return
 	}
 
 	// Load and execute layout template
 	layoutTmplBytes, err := dashboard.Templates.ReadFile("templates/layout.html")
 	if err != nil {
-		http.Error(w, "Failed to load layout", http.StatusInternalServerError)
+		s.serverError(w, "Failed to load layout", err)
 		return
 	}
 
-	layoutTmpl, err := template.New("layout").Parse(string(layoutTmplBytes))
+	layoutTmpl, err := template.New("layout").Funcs(s.templateFuncs()).Parse(string(layoutTmplBytes))
 	if err != nil {
-		http.Error(w, "Failed to parse layout", http.StatusInternalServerError)
+		s.serverError(w, "Failed to parse layout", err)
 		return
 	}
 
@@ -312,11 +524,17 @@ func (s *Server) renderDashboard(w http.ResponseWriter, title, contentTemplate s
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := layoutTmpl.Execute(w, layoutData); err != nil {
-		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		s.serverError(w, "Failed to render page", err)
 		return
 	}
 }
 
+// templateFuncs provides "path", which prefixes dashboard links with the
+// configured PathPrefix
+func (s *Server) templateFuncs() template.FuncMap {
+	return template.FuncMap{"path": s.path}
+}
+
 func formatPercentage(p float64) string {
 	if p < 0.01 {
 		return "0%"
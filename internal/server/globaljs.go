@@ -1,10 +1,28 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// ScriptConfig is embedded into hlg.js so eligibility can be decided
+// synchronously, before any text is swapped.
+type ScriptConfig struct {
+	Holdout float64             `json:"holdout"`
+	Layers  map[string][]string `json:"layers"`
+	Sign    bool                `json:"sign"` // Beacon signing: keep view signatures for conversions
+
+	// Tests inlined for one page (/hlg.js?url=), so it needs no /api/tests request
+	URL   string     `json:"url,omitempty"`
+	Tests []PageTest `json:"tests,omitempty"`
+}
+
 // handleGlobalJS serves the global headline-goat script
 func (s *Server) handleGlobalJS(w http.ResponseWriter, r *http.Request) {
 	if !requireMethod(w, r, http.MethodGet) {
@@ -12,23 +30,90 @@ func (s *Server) handleGlobalJS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Determine server URL from request
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
+	serverURL := fmt.Sprintf("%s://%s%s", requestScheme(r), r.Host, s.cfg.PathPrefix)
+
+	ctx := context.Background()
+	cfg, err := s.scriptConfig(ctx)
+	if err != nil {
+		s.serverError(w, "Failed to load script config", err)
+		return
+	}
+
+	// Synchronous-config mode: inline the page's tests. Eligibility is left
+	// to the script, which knows the visitor.
+	if page := r.URL.Query().Get("url"); page != "" {
+		tests, err := s.store.GetTestsByURL(ctx, page)
+		if err != nil {
+			s.serverError(w, "Failed to fetch tests", err)
+			return
+		}
+		cfg.URL = page
+		for _, t := range tests {
+			if testAllowsOrigin(t, r) {
+				cfg.Tests = append(cfg.Tests, newPageTest(t))
+			}
+		}
 	}
-	serverURL := fmt.Sprintf("%s://%s", scheme, r.Host)
 
-	script := GenerateGlobalScript(serverURL)
+	script := GenerateGlobalScriptWithConfig(serverURL, cfg)
 
 	w.Header().Set("Content-Type", "application/javascript")
 	w.Header().Set("Cache-Control", "public, max-age=60")
 	w.Write([]byte(script))
 }
 
+// scriptConfig loads the holdout and layer settings for the global script
+func (s *Server) scriptConfig(ctx context.Context) (ScriptConfig, error) {
+	holdout, err := s.store.GetHoldoutPercent(ctx)
+	if err != nil {
+		return ScriptConfig{}, err
+	}
+	layers, err := s.store.GetLayers(ctx)
+	if err != nil {
+		return ScriptConfig{}, err
+	}
+	_, signing, err := s.signingSecret(ctx)
+	if err != nil {
+		return ScriptConfig{}, err
+	}
+	return ScriptConfig{Holdout: holdout, Layers: layers, Sign: signing}, nil
+}
+
+// AntiFlickerSnippet returns HTML for the top of a page's <head> that hides
+// the elements tests swap until hlg.js has applied them, or until timeout.
+// With a pageURL, hlg.js is loaded synchronously with that page's tests
+// inlined; otherwise it is deferred and fetches them.
+func AntiFlickerSnippet(serverURL, pageURL string, selectors []string, timeout time.Duration) string {
+	hidden := append([]string{"[data-hlg-name]", "[data-hlg-convert-variants]"}, selectors...)
+	src := serverURL + "/hlg.js"
+	load := " defer"
+	if pageURL != "" {
+		src += "?url=" + url.QueryEscape(pageURL)
+		load = ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<style id=\"hlg-hide\">%s{visibility:hidden !important}</style>\n", strings.Join(hidden, ","))
+	fmt.Fprintf(&b, "<script>setTimeout(function(){var s=document.getElementById('hlg-hide');if(s)s.parentNode.removeChild(s)},%d)</script>\n", timeout.Milliseconds())
+	fmt.Fprintf(&b, "<script src=\"%s\"%s></script>\n", html.EscapeString(src), load)
+	return b.String()
+}
+
 // GenerateGlobalScript generates the global hlg.js script with the given server URL
 func GenerateGlobalScript(serverURL string) string {
+	return GenerateGlobalScriptWithConfig(serverURL, ScriptConfig{})
+}
+
+// GenerateGlobalScriptWithConfig generates hlg.js with holdout and layer config embedded
+func GenerateGlobalScriptWithConfig(serverURL string, cfg ScriptConfig) string {
+	if cfg.Layers == nil {
+		cfg.Layers = map[string][]string{}
+	}
+	cfgJSON, _ := json.Marshal(cfg)
+
 	return fmt.Sprintf(`(function(){
   var S='%s';
+  var C=%s;
 
   // Get or create visitor ID
   var vid=localStorage.getItem('hlg_vid');
@@ -37,63 +122,284 @@ func GenerateGlobalScript(serverURL string) string {
     localStorage.setItem('hlg_vid',vid);
   }
 
-  // Process all data-attribute test elements (client-side tests)
-  document.querySelectorAll('[data-hlg-name]').forEach(function(el){
-    var name=el.dataset.hlgName;
-    var variants=JSON.parse(el.dataset.hlgVariants||'[]');
-    if(!variants.length)return;
+  // Deterministic bucketing (FNV-1a, mirrors internal/assign)
+  function bucket(seed){
+    var s=seed+':'+vid,h=2166136261;
+    for(var i=0;i<s.length;i++){
+      h^=s.charCodeAt(i);
+      h=Math.imul(h,16777619)>>>0;
+    }
+    return h/4294967296;
+  }
 
-    // Check for SSR-selected variant
-    if(el.dataset.hlgSelected!==undefined){
-      var selected=parseInt(el.dataset.hlgSelected);
-      beacon(name,selected,'view',variants,'client');
-      return;
+  // Holdout visitors see no tests; layers allow at most one test per visitor.
+  // Forced variants (QA) bypass both.
+  function eligible(name){
+    if(forced(name)!==null)return true;
+    if(C.holdout>0&&bucket('holdout')<C.holdout/100)return false;
+    for(var l in C.layers){
+      var ts=C.layers[l];
+      if(ts.indexOf(name)>=0)return ts[Math.floor(bucket('layer:'+l)*ts.length)]===name;
     }
+    return true;
+  }
 
-    // Get or assign variant
+  // Variants forced with hlg.forceVariant, by test
+  function forcedVariants(){
+    try{return JSON.parse(localStorage.getItem('hlg_force')||'{}')||{};}catch(e){return {};}
+  }
+  function forced(name){
+    var f=forcedVariants();
+    return f.hasOwnProperty(name)?f[name]:null;
+  }
+
+  // Get or assign the visitor's variant of a test
+  function assign(name,count){
+    var f=forced(name);
+    if(f!==null)return f;
     var key='hlg_'+name;
     var v=localStorage.getItem(key);
     if(v===null){
-      v=Math.floor(Math.random()*variants.length);
+      v=Math.floor(Math.random()*count);
       localStorage.setItem(key,v);
     }else{
       v=parseInt(v);
     }
+    return v;
+  }
 
-    // Swap text
-    el.textContent=variants[v];
+  // Public API. Pages can queue calls before the script loads with
+  //   window.hlg=window.hlg||[]; hlg.push(['track','signup',49]);
+  // Queued calls run here, before variants are applied, so a queued
+  // forceVariant takes effect on the same page.
+  var queued=Array.isArray(window.hlg)?window.hlg:[];
+  var ready=false,readyQ=[];
+  window.hlg={};
 
-    // Send view beacon with variants for auto-creation
-    beacon(name,v,'view',variants,'client');
-  });
+  // Record a conversion for every test with this goal (hlg create --goal),
+  // or for the test of that name, crediting the variant the visitor saw
+  window.hlg.track=function(goal,value){
+    if(goal===undefined||goal===null||goal==='')return;
+    if(Object.keys(forcedVariants()).length)return;
+    var payload={g:String(goal),e:'convert',vid:vid};
+    if(typeof value==='number'&&isFinite(value))payload.val=value;
+    if(navigator.webdriver)payload.wd=true;
+    if(C.sign){
+      payload.sigs={};
+      for(var i=0;i<localStorage.length;i++){
+        var k=localStorage.key(i);
+        if(k.indexOf('hlg_sig_')!==0)continue;
+        try{payload.sigs[k.slice(8)]=JSON.parse(localStorage.getItem(k));}catch(e){}
+      }
+    }
+    navigator.sendBeacon(S+'/b',JSON.stringify(payload));
+  };
+
+  // The variant index the visitor sees in a test, or null if none yet
+  window.hlg.getVariant=function(test){
+    var f=forced(test);
+    if(f!==null)return f;
+    if(!eligible(test))return null;
+    var v=localStorage.getItem('hlg_'+test);
+    return v===null?null:parseInt(v);
+  };
+
+  // Call cb once the page's tests have been applied
+  window.hlg.onReady=function(cb){
+    if(typeof cb!=='function')return;
+    if(ready)cb(window.hlg);
+    else readyQ.push(cb);
+  };
+
+  // QA: always show this browser a variant (null stops forcing). Forcing
+  // any variant stops this browser sending beacons, so QA visits aren't
+  // counted. Takes effect for tests applied afterwards.
+  window.hlg.forceVariant=function(test,variant){
+    var f=forcedVariants();
+    if(variant===undefined||variant===null)delete f[test];
+    else f[test]=parseInt(variant);
+    localStorage.setItem('hlg_force',JSON.stringify(f));
+  };
 
-  // Process convert elements
-  document.querySelectorAll('[data-hlg-convert]').forEach(function(el){
-    var name=el.dataset.hlgConvert;
-    var v=parseInt(localStorage.getItem('hlg_'+name)||'0');
+  // Link this visitor to a logged-in user. Variants the user was first
+  // assigned on any device replace this device's, from the next page view.
+  window.hlg.identify=function(uid){
+    if(uid===undefined||uid===null||uid==='')return;
+    fetch(S+'/identify',{method:'POST',body:JSON.stringify({vid:vid,uid:String(uid)})})
+      .then(function(r){return r.ok?r.json():null})
+      .then(function(res){
+        if(!res||!res.assignments)return;
+        for(var t in res.assignments)localStorage.setItem('hlg_'+t,res.assignments[t]);
+      })
+      .catch(function(){});
+  };
 
-    // Swap text if variants provided
-    var variants=el.dataset.hlgConvertVariants;
-    if(variants){
-      variants=JSON.parse(variants);
-      if(variants[v])el.textContent=variants[v];
+  // Commands are [method, args...] or a function called with the API
+  function run(cmd){
+    if(typeof cmd==='function')return cmd(window.hlg);
+    if(Array.isArray(cmd)&&cmd[0]!=='push'&&typeof window.hlg[cmd[0]]==='function'){
+      window.hlg[cmd[0]].apply(window.hlg,cmd.slice(1));
     }
+  }
+  window.hlg.push=function(){
+    for(var i=0;i<arguments.length;i++)run(arguments[i]);
+  };
+  queued.forEach(run);
 
-    // URL type: beacon on load
-    if(el.dataset.hlgConvertType==='url'){
-      beacon(name,v,'convert',null,'client');
-      return;
+  function markReady(){
+    if(ready)return;
+    ready=true;
+    readyQ.splice(0).forEach(function(cb){cb(window.hlg);});
+    reveal();
+  }
+
+  // Anti-flicker: the snippet's hlg-hide style hides test targets until the
+  // first route's tests are applied, or targets still missing once the
+  // page has loaded are known not to be coming
+  function reveal(){
+    if(!ready||(pending.length&&document.readyState==='loading'))return;
+    var style=document.getElementById('hlg-hide');
+    if(style)style.parentNode.removeChild(style);
+  }
+  document.addEventListener('DOMContentLoaded',reveal);
+
+  // Views are sent once per test per page load, however often a route is
+  // visited or re-rendered. Swapped elements are remembered so text a
+  // framework renders over them can be swapped back.
+  var viewed={};
+  var applied=[];
+  var seen={};    // Server tests shown in this page load: {test,v} by name
+  var active=[];  // Server tests applied on the current route
+  var pending=[]; // Server tests on the current route whose target isn't rendered yet
+  var routeId=0,routePath=null,routeConverted={};
+  var loading=false; // The current route's tests are still being fetched
+  var teardown=[]; // Removes the current route's engagement listeners
+
+  function view(name,v,variants,src){
+    if(viewed[name])return;
+    viewed[name]=true;
+    beacon(name,v,'view',variants,src);
+  }
+
+  // Apply a variant to an element. Plain strings replace the text; typed
+  // payloads replace sanitized HTML, set attributes or toggle classes.
+  // Only what differs is written, so re-applying after a framework
+  // re-render can't loop with the observer.
+  function render(el,p){
+    if(p.type==='html'){
+      if(el.innerHTML!==el.hlgHTML){
+        el.innerHTML=p.html;
+        el.hlgHTML=el.innerHTML;
+      }
+    }else if(p.type==='attrs'){
+      for(var k in p.attrs){
+        if(el.getAttribute(k)!==p.attrs[k])el.setAttribute(k,p.attrs[k]);
+      }
+    }else if(p.type==='class'){
+      (p.add||[]).forEach(function(c){if(!el.classList.contains(c))el.classList.add(c);});
+      (p.remove||[]).forEach(function(c){if(el.classList.contains(c))el.classList.remove(c);});
+    }else if(el.textContent!==p.text){
+      el.textContent=p.text;
     }
+  }
+
+  function swap(el,p){
+    if(typeof p==='string')p={type:'text',text:p};
+    render(el,p);
+    applied.push({el:el,p:p});
+  }
 
-    // Click handler
-    el.addEventListener('click',function(){
-      beacon(name,v,'convert',null,'client');
+  // Conversion URLs count once per visit to the route
+  function convertURL(name,v){
+    if(routeConverted[name])return;
+    routeConverted[name]=true;
+    beacon(name,v,'convert',null,'server');
+  }
+
+  // Process data-attribute test elements (client-side tests), including
+  // ones rendered after load
+  function scan(){
+    document.querySelectorAll('[data-hlg-name]').forEach(function(el){
+      if(el.hlgDone)return;
+      el.hlgDone=true;
+      var name=el.dataset.hlgName;
+      var variants=JSON.parse(el.dataset.hlgVariants||'[]');
+      if(!variants.length||!eligible(name))return;
+
+      // Check for SSR-selected variant
+      if(el.dataset.hlgSelected!==undefined&&forced(name)===null){
+        var selected=parseInt(el.dataset.hlgSelected);
+        view(name,selected,variants,'client');
+        return;
+      }
+
+      // Get or assign variant
+      var v=assign(name,variants.length);
+
+      // Swap text
+      swap(el,variants[v]);
+
+      // Send view beacon with variants for auto-creation
+      view(name,v,variants,'client');
     });
-  });
 
-  // Server-side test handling with cache
-  (function(){
+    // Process convert elements
+    document.querySelectorAll('[data-hlg-convert]').forEach(function(el){
+      if(el.hlgDone)return;
+      el.hlgDone=true;
+      var name=el.dataset.hlgConvert;
+      if(!eligible(name))return;
+      var v=forced(name);
+      if(v===null)v=parseInt(localStorage.getItem('hlg_'+name)||'0');
+
+      // Swap text if variants provided
+      var variants=el.dataset.hlgConvertVariants;
+      if(variants){
+        variants=JSON.parse(variants);
+        if(variants[v])swap(el,variants[v]);
+      }
+
+      // URL type: beacon on load
+      if(el.dataset.hlgConvertType==='url'){
+        beacon(name,v,'convert',null,'client');
+        return;
+      }
+
+      // Click handler
+      el.addEventListener('click',function(){
+        beacon(name,v,'convert',null,'client');
+      });
+    });
+  }
+
+  // Server-side tests for the current route, with cache
+  function route(){
     var path=location.pathname;
+    if(path===routePath)return;
+    routePath=path;
+    var id=++routeId;
+    active=[];
+    pending=[];
+    routeConverted={};
+    teardown.forEach(function(f){f();});
+    teardown=[];
+    applied=applied.filter(function(a){return a.el.isConnected;});
+    watch();
+
+    // Tests inlined into the script (/hlg.js?url=) need no request
+    if(id===1&&C.url===path){
+      applyServerTests(C.tests);
+      markReady();
+      unwatch();
+      return;
+    }
+
+    // Tests shown on an earlier route convert when the app navigates to
+    // their conversion URL
+    for(var name in seen){
+      if(seen[name].test.conversion_url===path)convertURL(name,seen[name].v);
+    }
+
     var cacheKey='hlg_tests_'+path;
     var cached=localStorage.getItem(cacheKey);
 
@@ -102,64 +408,244 @@ func GenerateGlobalScript(serverURL string) string {
       try{
         applyServerTests(JSON.parse(cached));
       }catch(e){}
+      markReady();
     }
 
     // Fetch fresh config in background, update cache
-    fetch(S+'/api/tests?url='+encodeURIComponent(path))
+    loading=true;
+    fetch(S+'/api/tests?url='+encodeURIComponent(path)+'&vid='+encodeURIComponent(vid))
       .then(function(r){return r.json()})
       .then(function(tests){
         // Update cache for next visit
         localStorage.setItem(cacheKey,JSON.stringify(tests));
-        // Apply if not already applied from cache
-        if(!cached)applyServerTests(tests);
+        // Apply if not already applied from cache, and still on this route
+        if(!cached&&id===routeId)applyServerTests(tests);
       })
-      .catch(function(){});
-  })();
+      .catch(function(){})
+      .then(function(){
+        markReady();
+        if(id!==routeId)return;
+        loading=false;
+        unwatch();
+      });
+  }
 
   function applyServerTests(tests){
     if(!tests||!tests.length)return;
     tests.forEach(function(test){
       // Skip if already processed via data attributes
       if(document.querySelector('[data-hlg-name="'+test.name+'"]'))return;
+      if(!eligible(test.name)||!(test.target||test.payloads))return;
+      pending.push(test);
+    });
+    applyPending();
+  }
 
-      // Find target element
-      if(!test.target)return;
-      var el=document.querySelector(test.target);
-      if(!el)return;
+  // The elements a variant changes, each with its change, or null until
+  // all of them are rendered so multi-element variants apply all at once
+  function changes(test,v){
+    var p=test.payloads?test.payloads[v]:test.variants[v];
+    var found=[];
+    if(p&&p.type==='multi'){
+      for(var i=0;i<p.changes.length;i++){
+        var el=document.querySelector(p.changes[i].selector);
+        if(!el)return null;
+        found.push([el,p.changes[i]]);
+      }
+      return found;
+    }
+    var target=test.target&&document.querySelector(test.target);
+    if(!target)return null;
+    if(p)found.push([target,p]);
+    return found;
+  }
 
+  // Apply pending tests whose elements have been rendered
+  function applyPending(){
+    pending=pending.filter(function(test){
       // Assign variant (same localStorage pattern)
-      var key='hlg_'+test.name;
-      var v=localStorage.getItem(key);
-      if(v===null){
-        v=Math.floor(Math.random()*test.variants.length);
-        localStorage.setItem(key,v);
-      }else{
-        v=parseInt(v);
-      }
+      var v=assign(test.name,test.variants.length);
 
       // Apply variant
-      if(test.variants[v])el.textContent=test.variants[v];
-      beacon(test.name,v,'view',null,'server');
-
-      // Setup conversion tracking
-      if(test.cta_target){
-        var cta=document.querySelector(test.cta_target);
-        if(cta){
-          cta.addEventListener('click',function(){
-            beacon(test.name,v,'convert',null,'server');
-          });
-        }
-      }
-      if(test.conversion_url&&location.pathname===test.conversion_url){
-        beacon(test.name,v,'convert',null,'server');
+      var found=changes(test,v);
+      if(!found)return true;
+      found.forEach(function(f){swap(f[0],f[1]);});
+      view(test.name,v,null,'server');
+
+      // Setup conversion tracking. CTA clicks are delegated (below) so
+      // re-rendered buttons still count.
+      var entry={test:test,v:v};
+      active.push(entry);
+      seen[test.name]=entry;
+      if(test.conversion_url===location.pathname)convertURL(test.name,v);
+      if(test.engagement){
+        engage(test.engagement,function(){
+          beacon(test.name,v,'convert',null,'server');
+        });
       }
+      return false;
     });
+    reveal();
+  }
+
+  document.addEventListener('click',function(e){
+    active.forEach(function(a){
+      if(!a.test.cta_target)return;
+      try{
+        if(e.target.closest&&e.target.closest(a.test.cta_target))beacon(a.test.name,a.v,'convert',null,'server');
+      }catch(err){}
+    });
+  },true);
+
+  // Elements rendered after load: apply tests to them, and swap back
+  // variant text a framework re-rendered. Mutations are handled at most
+  // once a frame, and the page is only observed while a route's tests are
+  // loading, waiting for their targets or applied.
+  var observer=null,watching=false,frameQueued=false,rescan=false;
+  var testElements='[data-hlg-name],[data-hlg-convert]';
+
+  function watch(){
+    if(!observer||watching)return;
+    observer.observe(document.documentElement,{childList:true,subtree:true,characterData:true});
+    watching=true;
+  }
+
+  function unwatch(){
+    applied=applied.filter(function(a){return a.el.isConnected;});
+    if(!watching||loading||pending.length||applied.length)return;
+    observer.disconnect();
+    watching=false;
+  }
+
+  // Whether a mutation added an element scan() would process
+  function addsTestElement(record){
+    for(var i=0;i<record.addedNodes.length;i++){
+      var n=record.addedNodes[i];
+      if(n.nodeType===1&&(n.matches(testElements)||n.querySelector(testElements)))return true;
+    }
+    return false;
+  }
+
+  function flush(){
+    frameQueued=false;
+    if(rescan){rescan=false;scan();}
+    if(pending.length)applyPending();
+    applied.forEach(function(a){
+      if(a.el.isConnected)render(a.el,a.p);
+    });
+    unwatch();
+  }
+
+  if(window.MutationObserver){
+    observer=new MutationObserver(function(records){
+      if(!rescan)rescan=records.some(addsTestElement);
+      if(frameQueued)return;
+      frameQueued=true;
+      // Hidden tabs don't run animation frames
+      if(window.requestAnimationFrame&&!document.hidden)requestAnimationFrame(flush);
+      else setTimeout(flush);
+    });
+  }
+
+  // Single-page apps: re-evaluate tests after client-side navigation. Apps
+  // change the URL before rendering the new route, which the observer
+  // picks up.
+  ['pushState','replaceState'].forEach(function(m){
+    var original=history[m];
+    history[m]=function(){
+      var result=original.apply(this,arguments);
+      route();
+      return result;
+    };
+  });
+  addEventListener('popstate',route);
+
+  scan();
+  route();
+
+  // Engagement goals call fire once per page view, or route in a
+  // single-page app. Their listeners are removed when the route changes.
+  function listen(target,type,fn,opts){
+    target.addEventListener(type,fn,opts);
+    teardown.push(function(){target.removeEventListener(type,fn,opts);});
+  }
+
+  function engage(g,fire){
+    var done=false,id=routeId;
+    function once(){
+      if(!done&&id===routeId){done=true;fire();}
+    }
+
+    // Scroll depth: the bottom of the viewport passed the given share of
+    // the page. The page is first measured once it has loaded, since its
+    // height is partial before then; after that only scrolling counts.
+    if(g.type==='scroll'){
+      var onScroll=function(){
+        var h=document.documentElement.scrollHeight;
+        if(h>0&&(scrollY+innerHeight)*100/h>=g.percent)once();
+      };
+      listen(window,'scroll',onScroll,{passive:true});
+      if(document.readyState!=='complete')listen(window,'load',onScroll);
+    }
+
+    // Time on page, counting only while the page is visible
+    if(g.type==='dwell'){
+      var left=g.seconds*1000,start,timer;
+      var run=function(){start=Date.now();timer=setTimeout(once,left);};
+      listen(document,'visibilitychange',function(){
+        if(done)return;
+        if(document.hidden){clearTimeout(timer);left-=Date.now()-start;}
+        else run();
+      });
+      teardown.push(function(){clearTimeout(timer);});
+      if(!document.hidden)run();
+    }
+
+    // An element entered the viewport
+    if(g.type==='visible'&&window.IntersectionObserver){
+      var el=document.querySelector(g.selector);
+      if(!el)return;
+      var io=new IntersectionObserver(function(entries){
+        entries.forEach(function(e){
+          if(e.isIntersecting){io.disconnect();once();}
+        });
+      });
+      io.observe(el);
+      teardown.push(function(){io.disconnect();});
+    }
+
+    // A matching form was submitted; delegated so forms rendered later count
+    if(g.type==='submit'){
+      listen(document,'submit',function(e){
+        if(e.target.matches&&e.target.matches(g.selector))once();
+      },true);
+    }
   }
 
   function beacon(t,v,e,variants,src){
+    // QA browsers with forced variants send nothing
+    if(Object.keys(forcedVariants()).length)return;
     var payload={t:t,v:v,e:e,vid:vid,src:src||'client'};
     if(variants)payload.variants=variants;
+    if(navigator.webdriver)payload.wd=true;
+
+    // Signing mode: views return a signature that conversions must echo back
+    if(C.sign&&e==='view'){
+      fetch(S+'/b',{method:'POST',body:JSON.stringify(payload),keepalive:true})
+        .then(function(r){return r.status===200?r.json():null})
+        .then(function(sv){
+          if(sv)localStorage.setItem('hlg_sig_'+t,JSON.stringify({v:v,sig:sv.sig,exp:sv.exp}));
+        })
+        .catch(function(){});
+      return;
+    }
+    if(C.sign&&e==='convert'){
+      try{
+        var sv=JSON.parse(localStorage.getItem('hlg_sig_'+t)||'null');
+        if(sv&&sv.v===v){payload.sig=sv.sig;payload.exp=sv.exp;}
+      }catch(err){}
+    }
     navigator.sendBeacon(S+'/b',JSON.stringify(payload));
   }
-})();`, serverURL)
+})();`, serverURL, cfgJSON)
 }
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+// maxGoalSignatures limits the view signatures a goal beacon may carry
+const maxGoalSignatures = 100
+
+// goalSignature is a view signature hlg.track() echoes back for one test
+type goalSignature struct {
+	Variant   int    `json:"v"`
+	Signature string `json:"sig"`
+	Expires   int64  `json:"exp"`
+}
+
+// recordGoal records a conversion from hlg.track() for every running test
+// with the beacon's goal, or for the running test of that name if no test
+// has the goal. Like server-side conversions, each is credited to the
+// variant the visitor was shown, and tests the visitor never saw are
+// skipped. It returns the beacon outcome.
+func (s *Server) recordGoal(ctx context.Context, r *http.Request, req *BeaconRequest) (string, error) {
+	tests, err := s.store.GetTestsByGoal(ctx, req.Goal)
+	if err != nil {
+		return beaconError, err
+	}
+	if len(tests) == 0 {
+		test, err := s.store.GetTest(ctx, req.Goal)
+		if err == store.ErrNotFound {
+			return beaconInvalid, nil
+		}
+		if err != nil {
+			return beaconError, err
+		}
+		if test.State == store.StateRunning {
+			tests = []*store.Test{test}
+		}
+	}
+
+	secret, signing, err := s.signingSecret(ctx)
+	if err != nil {
+		return beaconError, err
+	}
+
+	outcome := beaconIneligible
+	for _, test := range tests {
+		if !testAllowsOrigin(test, r) {
+			s.rejected.Inc(rejectOriginNotAllowed)
+			continue
+		}
+		ok, err := s.eligible(ctx, req.VisitorID, test)
+		if err != nil {
+			return beaconError, err
+		}
+		if !ok {
+			continue
+		}
+
+		_, variant, err := s.exposure(ctx, test.Name, []string{req.VisitorID})
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return beaconError, err
+		}
+
+		if signing {
+			sig := req.Signatures[test.Name]
+			signed := BeaconRequest{TestName: test.Name, Variant: variant, VisitorID: req.VisitorID,
+				Signature: sig.Signature, Expires: sig.Expires}
+			if sig.Variant != variant || !verifyConversion(secret, &signed, s.now()) {
+				s.rejected.Inc(rejectInvalidSignature)
+				continue
+			}
+		}
+
+		start := time.Now()
+		_, err = s.store.RecordConversion(ctx, store.Conversion{
+			TestName:  test.Name,
+			Variant:   variant,
+			VisitorID: req.VisitorID,
+			Value:     req.Value,
+		})
+		s.metrics.storeWrite("record_conversion", start)
+		if err != nil {
+			return beaconError, err
+		}
+		outcome = beaconRecorded
+	}
+	return outcome, nil
+}
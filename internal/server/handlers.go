@@ -3,10 +3,11 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
 	"time"
 
+	"github.com/gkobilansky/headline-goat/internal/assign"
 	"github.com/gkobilansky/headline-goat/internal/store"
 )
 
@@ -37,10 +38,12 @@ func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
 }
 
 type HealthResponse struct {
-	Status        string `json:"status"`
-	TestsCount    int    `json:"tests_count"`
-	DBSizeBytes   int64  `json:"db_size_bytes"`
-	UptimeSeconds int64  `json:"uptime_seconds"`
+	Status           string           `json:"status"`
+	TestsCount       int              `json:"tests_count"`
+	DBSizeBytes      int64            `json:"db_size_bytes"`
+	UptimeSeconds    int64            `json:"uptime_seconds"`
+	FilteredBeacons  map[string]int64 `json:"filtered_beacons"`  // Bot traffic dropped since startup, by reason
+	RejectedRequests map[string]int64 `json:"rejected_requests"` // Abuse protection rejections since startup, by reason
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -53,41 +56,29 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	// Get test count
 	tests, err := s.store.ListTests(ctx)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.serverError(w, "Internal server error", err)
 		return
 	}
 
-	// Get database size
-	var dbSize int64
-	db := s.store.DB()
-	row := db.QueryRow("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()")
-	if err := row.Scan(&dbSize); err != nil {
-		// Try to get file size as fallback
-		if info, statErr := os.Stat(getDBPath(db)); statErr == nil {
-			dbSize = info.Size()
-		}
-	}
+	// Get database size (0 if the store can't tell)
+	dbSize, _ := s.store.Size(ctx)
 
 	// Calculate uptime
-	uptime := int64(time.Since(s.startTime).Seconds())
+	uptime := int64(s.now().Sub(s.startTime).Seconds())
 
 	response := HealthResponse{
-		Status:        "ok",
-		TestsCount:    len(tests),
-		DBSizeBytes:   dbSize,
-		UptimeSeconds: uptime,
+		Status:           "ok",
+		TestsCount:       len(tests),
+		DBSizeBytes:      dbSize,
+		UptimeSeconds:    uptime,
+		FilteredBeacons:  s.filtered.Snapshot(),
+		RejectedRequests: s.rejected.Snapshot(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// getDBPath attempts to get the database file path
-func getDBPath(db interface{}) string {
-	// This is a simplified version - in practice you'd track the path
-	return "./headline-goat.db"
-}
-
 // BeaconRequest represents an incoming beacon event
 type BeaconRequest struct {
 	TestName  string   `json:"t"`
@@ -96,10 +87,20 @@ type BeaconRequest struct {
 	VisitorID string   `json:"vid"`
 	Source    string   `json:"src"`      // "client" or "server"
 	Variants  []string `json:"variants"` // For auto-creation
+	Webdriver bool     `json:"wd"`       // navigator.webdriver (automation)
+	Signature string   `json:"sig"`      // Conversion signature issued with the view (signing mode)
+	Expires   int64    `json:"exp"`      // Signature expiry, unix seconds
+
+	// hlg.track(): a conversion for a goal instead of one test (see goals.go)
+	Goal       string                   `json:"g"`
+	Value      float64                  `json:"val"`
+	Signatures map[string]goalSignature `json:"sigs"` // Stored view signatures by test (signing mode)
 }
 
 func (s *Server) handleBeacon(w http.ResponseWriter, r *http.Request) {
-	setCORS(w, "POST, OPTIONS")
+	if !s.allowOrigin(w, r, "POST, OPTIONS") {
+		return
+	}
 
 	if handlePreflight(w, r) {
 		return
@@ -109,28 +110,83 @@ func (s *Server) handleBeacon(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.cfg.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+	}
+
+	// Count every beacon by outcome. The test label is only set once the
+	// test is known to exist, so junk names can't create new series.
+	outcome, testLabel, eventLabel := beaconInvalid, "", ""
+	defer func() { s.metrics.beacon(testLabel, eventLabel, outcome) }()
+
 	var req BeaconRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			outcome = beaconRejected
+			s.rejected.Inc(rejectBodyTooLarge)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	// Validate required fields
-	if req.TestName == "" || req.VisitorID == "" {
+	if (req.TestName == "" && req.Goal == "") || req.VisitorID == "" {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
+	if fieldTooLong(&req) {
+		outcome = beaconRejected
+		s.rejected.Inc(rejectFieldTooLong)
+		http.Error(w, "Field too long", http.StatusBadRequest)
+		return
+	}
+
 	if req.EventType != "view" && req.EventType != "convert" {
 		http.Error(w, "Invalid event type", http.StatusBadRequest)
 		return
 	}
+	if req.Goal != "" && (req.EventType != "convert" || req.TestName != "") {
+		http.Error(w, "Goal beacons must be conversions without a test", http.StatusBadRequest)
+		return
+	}
+	eventLabel = req.EventType
 
 	ctx := context.Background()
 
+	// Drop bot traffic before it can auto-create tests or record events
+	reason, err := s.detectBot(ctx, r, &req)
+	if err != nil {
+		outcome = beaconError
+		s.serverError(w, "Failed to check request", err)
+		return
+	}
+	if reason != "" {
+		outcome = beaconFiltered
+		s.filtered.Inc(reason)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if req.Goal != "" {
+		outcome, err = s.recordGoal(ctx, r, &req)
+		if err != nil {
+			s.serverError(w, "Failed to record goal", err)
+			return
+		}
+		if outcome == beaconInvalid {
+			http.Error(w, "Unknown goal", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	// Get or create test
 	var test *store.Test
-	var err error
 
 	// Default source to "client" if not specified
 	if req.Source == "" {
@@ -138,14 +194,40 @@ func (s *Server) handleBeacon(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(req.Variants) > 0 && req.Source == "client" {
-		// Auto-create from client data attributes
-		var created bool
-		test, created, err = s.store.GetOrCreateTest(ctx, req.TestName, req.Variants)
-		if err != nil {
-			http.Error(w, "Failed to get or create test", http.StatusInternalServerError)
+		// Auto-create from client data attributes, subject to abuse limits
+		test, err = s.store.GetTest(ctx, req.TestName)
+		if err == store.ErrNotFound {
+			reason, err = s.checkAutoCreate(ctx, r, &req)
+			if err != nil {
+				outcome = beaconError
+				s.serverError(w, "Failed to check limits", err)
+				return
+			}
+			if reason != "" {
+				outcome = beaconRejected
+				s.rejected.Inc(reason)
+				http.Error(w, "Test auto-creation limit reached", autoCreateStatus(reason))
+				return
+			}
+
+			var created bool
+			start := time.Now()
+			test, created, err = s.store.GetOrCreateTest(ctx, req.TestName, req.Variants)
+			s.metrics.storeWrite("create_test", start)
+			if err != nil {
+				outcome = beaconError
+				s.serverError(w, "Failed to get or create test", err)
+				return
+			}
+			if created {
+				s.metrics.autoCreated.Inc(req.Source)
+				s.log.Info("test auto-created", "test", test.Name, "variants", len(test.Variants), "ip", clientKey(r))
+			}
+		} else if err != nil {
+			outcome = beaconError
+			s.serverError(w, "Failed to get or create test", err)
 			return
 		}
-		_ = created // Could log if needed
 	} else {
 		// Existing behavior - test must exist
 		test, err = s.store.GetTest(ctx, req.TestName)
@@ -155,30 +237,176 @@ func (s *Server) handleBeacon(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	testLabel = test.Name
+
 	// Validate variant in range
 	if req.Variant < 0 || req.Variant >= len(test.Variants) {
 		http.Error(w, "Invalid variant", http.StatusBadRequest)
 		return
 	}
 
+	// Tests bound to specific origins only accept events from those sites
+	if !testAllowsOrigin(test, r) {
+		outcome = beaconRejected
+		s.rejected.Inc(rejectOriginNotAllowed)
+		http.Error(w, "Origin not allowed for this test", http.StatusForbidden)
+		return
+	}
+
+	// Drop events from holdout visitors or visitors assigned to another test in the layer
+	ok, err := s.eligible(ctx, req.VisitorID, test)
+	if err != nil {
+		outcome = beaconError
+		s.serverError(w, "Failed to check eligibility", err)
+		return
+	}
+	if !ok {
+		outcome = beaconIneligible
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	// Check for source conflict (server-created test receiving client beacons)
 	if test.Source == "server" && req.Source == "client" && !test.HasSourceConflict {
-		// Mark conflict (ignore error, non-critical)
-		_ = s.store.SetSourceConflict(ctx, test.Name, true)
+		s.log.Warn("source conflict: server-created test received a client beacon", "test", test.Name)
+		if err := s.store.SetSourceConflict(ctx, test.Name, true); err != nil {
+			// Non-critical, the beacon is still recorded
+			s.log.Error("failed to mark source conflict", "test", test.Name, "error", err)
+		}
+	}
+
+	// With beacon signing on, conversions must carry the signature issued with a view
+	secret, signing, err := s.signingSecret(ctx)
+	if err != nil {
+		outcome = beaconError
+		s.serverError(w, "Failed to load signing config", err)
+		return
+	}
+	if signing && req.EventType == "convert" && !verifyConversion(secret, &req, s.now()) {
+		outcome = beaconRejected
+		s.rejected.Inc(rejectInvalidSignature)
+		http.Error(w, "Invalid or expired signature", http.StatusForbidden)
+		return
 	}
 
 	// Record event (deduplication handled by store)
-	if err := s.store.RecordEvent(ctx, req.TestName, req.Variant, req.EventType, req.VisitorID); err != nil {
-		http.Error(w, "Failed to record event", http.StatusInternalServerError)
+	err = s.recordEvent(ctx, store.Event{
+		TestName:  req.TestName,
+		Variant:   req.Variant,
+		EventType: req.EventType,
+		VisitorID: req.VisitorID,
+	})
+	if errors.Is(err, errBufferFull) {
+		outcome = beaconRejected
+		s.rejected.Inc(rejectBufferFull)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Server busy", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		outcome = beaconError
+		s.serverError(w, "Failed to record event", err)
+		return
+	}
+	outcome = beaconRecorded
+
+	if signing && req.EventType == "view" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.signView(secret, req.TestName, req.Variant, req.VisitorID))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Maximum lengths of client-supplied beacon fields
+const (
+	maxTestNameLen  = 100
+	maxVisitorIDLen = 128
+	maxVariantLen   = 500
+)
+
+// fieldTooLong reports whether any client-supplied field exceeds its limit
+func fieldTooLong(req *BeaconRequest) bool {
+	if len(req.TestName) > maxTestNameLen || len(req.VisitorID) > maxVisitorIDLen || len(req.Goal) > maxTestNameLen {
+		return true
+	}
+	if len(req.Signatures) > maxGoalSignatures {
+		return true
+	}
+	for _, v := range req.Variants {
+		if len(v) > maxVariantLen {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAutoCreate returns the reason a client beacon may not auto-create
+// a new test, or "" if it may.
+func (s *Server) checkAutoCreate(ctx context.Context, r *http.Request, req *BeaconRequest) (string, error) {
+	if s.cfg.MaxVariants > 0 && len(req.Variants) > s.cfg.MaxVariants {
+		return rejectTooManyVariants, nil
+	}
+
+	if s.cfg.MaxClientTests > 0 {
+		count, err := s.store.CountTestsBySource(ctx, "client")
+		if err != nil {
+			return "", err
+		}
+		if count >= s.cfg.MaxClientTests {
+			return rejectClientTestLimit, nil
+		}
+	}
+
+	if ok, _ := s.autoCreate.Allow(clientKey(r)); !ok {
+		return rejectAutoCreateLimit, nil
+	}
+
+	return "", nil
+}
+
+// autoCreateStatus maps an auto-creation rejection reason to an HTTP status
+func autoCreateStatus(reason string) int {
+	switch reason {
+	case rejectTooManyVariants:
+		return http.StatusBadRequest
+	case rejectAutoCreateLimit:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusForbidden
+	}
+}
+
+// PageTest is the minimal test data hlg.js needs to apply a test on a page
+type PageTest struct {
+	Name          string   `json:"name"`
+	Variants      []string `json:"variants"`
+	Target        string   `json:"target,omitempty"`
+	CTATarget     string   `json:"cta_target,omitempty"`
+	ConversionURL string   `json:"conversion_url,omitempty"`
+
+	Engagement *store.EngagementGoal  `json:"engagement,omitempty"`
+	Payloads   []store.VariantPayload `json:"payloads,omitempty"`
+}
+
+func newPageTest(t *store.Test) PageTest {
+	return PageTest{
+		Name:          t.Name,
+		Variants:      t.Variants,
+		Target:        t.Target,
+		CTATarget:     t.CTATarget,
+		ConversionURL: t.ConversionURL,
+		Engagement:    t.Engagement,
+		Payloads:      t.Payloads,
+	}
+}
+
 // handleTestsAPI returns tests matching a URL for the global script
 func (s *Server) handleTestsAPI(w http.ResponseWriter, r *http.Request) {
-	setCORS(w, "GET, OPTIONS")
+	if !s.allowOrigin(w, r, "GET, OPTIONS") {
+		return
+	}
 
 	if handlePreflight(w, r) {
 		return
@@ -197,36 +425,62 @@ func (s *Server) handleTestsAPI(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	tests, err := s.store.GetTestsByURL(ctx, url)
 	if err != nil {
-		http.Error(w, "Failed to fetch tests", http.StatusInternalServerError)
+		s.serverError(w, "Failed to fetch tests", err)
 		return
 	}
 
-	// Return minimal test data for client
-	type TestResponse struct {
-		Name          string   `json:"name"`
-		Variants      []string `json:"variants"`
-		Target        string   `json:"target,omitempty"`
-		CTATarget     string   `json:"cta_target,omitempty"`
-		ConversionURL string   `json:"conversion_url,omitempty"`
-	}
+	// Filter out tests the visitor is not eligible for (holdout, layers)
+	vid := r.URL.Query().Get("vid")
 
-	var response []TestResponse
+	var response []PageTest
 	for _, t := range tests {
-		response = append(response, TestResponse{
-			Name:          t.Name,
-			Variants:      t.Variants,
-			Target:        t.Target,
-			CTATarget:     t.CTATarget,
-			ConversionURL: t.ConversionURL,
-		})
+		if !testAllowsOrigin(t, r) {
+			continue
+		}
+		if vid != "" {
+			ok, err := s.eligible(ctx, vid, t)
+			if err != nil {
+				s.serverError(w, "Failed to check eligibility", err)
+				return
+			}
+			if !ok {
+				continue
+			}
+		}
+		response = append(response, newPageTest(t))
 	}
 
 	// Return empty array instead of null
 	if response == nil {
-		response = []TestResponse{}
+		response = []PageTest{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// eligible reports whether a visitor may take part in a test given the
+// global holdout and the test's layer.
+func (s *Server) eligible(ctx context.Context, visitorID string, test *store.Test) (bool, error) {
+	holdout, err := s.store.GetHoldoutPercent(ctx)
+	if err != nil {
+		return false, err
+	}
+	if assign.InHoldout(visitorID, holdout) {
+		return false, nil
+	}
+	if test.Layer == "" {
+		return true, nil
+	}
+
+	layers, err := s.store.GetLayers(ctx)
+	if err != nil {
+		return false, err
+	}
+	tests, ok := layers[test.Layer]
+	if !ok {
+		// Test is not running, so it does not occupy a slot in its layer
+		return true, nil
+	}
+	return assign.LayerTest(test.Layer, tests, visitorID) == test.Name, nil
+}
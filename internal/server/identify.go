@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// IdentifyRequest links the current visitor ID to an application user ID
+type IdentifyRequest struct {
+	VisitorID string `json:"vid"`
+	UserID    string `json:"uid"`
+}
+
+// IdentifyResponse returns the variants the user was first assigned on any
+// device, so hlg.js can show the same ones here
+type IdentifyResponse struct {
+	Assignments map[string]int `json:"assignments"`
+}
+
+func (s *Server) handleIdentify(w http.ResponseWriter, r *http.Request) {
+	if !s.allowOrigin(w, r, "POST, OPTIONS") {
+		return
+	}
+
+	if handlePreflight(w, r) {
+		return
+	}
+
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if s.cfg.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+	}
+
+	var req IdentifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			s.rejected.Inc(rejectBodyTooLarge)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.VisitorID == "" || req.UserID == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.VisitorID) > maxVisitorIDLen || len(req.UserID) > maxVisitorIDLen {
+		s.rejected.Inc(rejectFieldTooLong)
+		http.Error(w, "Field too long", http.StatusBadRequest)
+		return
+	}
+
+	if isBotUserAgent(r.UserAgent()) {
+		s.filtered.Inc(filterBotUserAgent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ctx := r.Context()
+	start := time.Now()
+	err := s.store.LinkIdentity(ctx, req.VisitorID, req.UserID)
+	s.metrics.storeWrite("link_identity", start)
+	if err != nil {
+		s.serverError(w, "Failed to link identity", err)
+		return
+	}
+
+	var assignments map[string]int
+	err = s.flushEvents(ctx)
+	if err == nil {
+		assignments, err = s.store.GetUserAssignments(ctx, req.UserID)
+	}
+	if err != nil {
+		s.serverError(w, "Failed to load assignments", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(IdentifyResponse{Assignments: assignments})
+}
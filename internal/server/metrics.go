@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+// Beacon outcomes reported in hlg_beacons_total
+const (
+	beaconRecorded   = "recorded"
+	beaconFiltered   = "filtered"   // Bot traffic
+	beaconRejected   = "rejected"   // Abuse protection, origin or signature checks
+	beaconIneligible = "ineligible" // Holdout or another test in the layer
+	beaconInvalid    = "invalid"    // Malformed request or unknown test
+	beaconError      = "error"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histograms
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics holds the counters and histograms served at /metrics. Gauges
+// (database size, running tests) are read from the store at scrape time.
+type metrics struct {
+	beacons       *counters // By test, event type and outcome, joined with "\x00"
+	autoCreated   *counters
+	requests      *counters // By route and status code, joined with "\x00"
+	latency       *histograms
+	storeWrites   *histograms
+	flushedEvents *counters // Buffered events written or dropped
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		beacons:       newCounters(),
+		autoCreated:   newCounters(),
+		requests:      newCounters(),
+		latency:       newHistograms(latencyBuckets),
+		storeWrites:   newHistograms(latencyBuckets),
+		flushedEvents: newCounters(),
+	}
+}
+
+// beacon counts a beacon by test, event type and outcome
+func (m *metrics) beacon(test, event, outcome string) {
+	m.beacons.Inc(test + "\x00" + event + "\x00" + outcome)
+}
+
+// storeWrite records the latency of a store write started at start
+func (m *metrics) storeWrite(op string, start time.Time) {
+	m.storeWrites.Observe(op, time.Since(start).Seconds())
+}
+
+// histograms is a set of latency histograms keyed by a single label value
+type histograms struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []int64 // Per bucket, not cumulative
+	count  int64
+	sum    float64
+}
+
+func newHistograms(buckets []float64) *histograms {
+	return &histograms{buckets: buckets, series: make(map[string]*histogram)}
+}
+
+// Observe adds a value to the named histogram
+func (h *histograms) Observe(name string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[name]
+	if !ok {
+		s = &histogram{counts: make([]int64, len(h.buckets))}
+		h.series[name] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// write prints the histograms in Prometheus text format
+func (h *histograms) write(w io.Writer, name, help, label string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		lv := label + "=" + quoteLabel(key)
+		var cumulative int64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, lv, strconv.FormatFloat(upper, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, lv, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, lv, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, lv, s.count)
+	}
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// instrument counts requests, observes latency and writes an access log
+// line for a route
+func (s *Server) instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		s.metrics.latency.Observe(route, elapsed.Seconds())
+		s.metrics.requests.Inc(route + "\x00" + strconv.Itoa(rec.status))
+
+		if s.cfg.AccessLog {
+			s.log.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Duration("duration", elapsed),
+				slog.String("ip", clientKey(r)),
+			)
+		}
+	})
+}
+
+// handleMetrics serves metrics in the Prometheus text exposition format.
+// With MetricsToken set, scrapers must send it as a Bearer token.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	if s.cfg.MetricsToken != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.MetricsToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	tests, err := s.store.ListTests(ctx)
+	if err != nil {
+		s.serverError(w, "Failed to list tests", err)
+		return
+	}
+	running := 0
+	for _, t := range tests {
+		if t.State == store.StateRunning {
+			running++
+		}
+	}
+	dbSize, _ := s.store.Size(ctx)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	writeCounters(w, "hlg_beacons_total", "Beacons received, by test, event type and outcome.",
+		s.metrics.beacons, "test", "event", "outcome")
+	writeCounters(w, "hlg_filtered_beacons_total", "Beacons dropped as bot traffic, by reason.",
+		s.filtered, "reason")
+	writeCounters(w, "hlg_rejected_requests_total", "Requests rejected by abuse protection, by reason.",
+		s.rejected, "reason")
+
+	fmt.Fprintf(w, "# HELP hlg_tests_auto_created_total Tests auto-created from client beacons.\n")
+	fmt.Fprintf(w, "# TYPE hlg_tests_auto_created_total counter\n")
+	fmt.Fprintf(w, "hlg_tests_auto_created_total %d\n", s.metrics.autoCreated.Total())
+
+	writeCounters(w, "hlg_http_requests_total", "HTTP requests, by route and status code.",
+		s.metrics.requests, "route", "code")
+	s.metrics.latency.write(w, "hlg_http_request_duration_seconds", "HTTP request latency, by route.", "route")
+	s.metrics.storeWrites.write(w, "hlg_store_write_duration_seconds", "Database write latency, by operation.", "op")
+
+	if s.events != nil {
+		fmt.Fprintf(w, "# HELP hlg_event_buffer_depth Events waiting in the write-behind buffer.\n")
+		fmt.Fprintf(w, "# TYPE hlg_event_buffer_depth gauge\n")
+		fmt.Fprintf(w, "hlg_event_buffer_depth %d\n", s.events.Len())
+		fmt.Fprintf(w, "# HELP hlg_event_buffer_capacity Size of the write-behind buffer.\n")
+		fmt.Fprintf(w, "# TYPE hlg_event_buffer_capacity gauge\n")
+		fmt.Fprintf(w, "hlg_event_buffer_capacity %d\n", s.events.Cap())
+		writeCounters(w, "hlg_buffered_events_total", "Buffered events written to the database or dropped after failed writes.",
+			s.metrics.flushedEvents, "result")
+	}
+
+	fmt.Fprintf(w, "# HELP hlg_db_size_bytes Size of the database file.\n")
+	fmt.Fprintf(w, "# TYPE hlg_db_size_bytes gauge\n")
+	fmt.Fprintf(w, "hlg_db_size_bytes %d\n", dbSize)
+	fmt.Fprintf(w, "# HELP hlg_tests_running Tests currently running.\n")
+	fmt.Fprintf(w, "# TYPE hlg_tests_running gauge\n")
+	fmt.Fprintf(w, "hlg_tests_running %d\n", running)
+	fmt.Fprintf(w, "# HELP hlg_uptime_seconds Seconds since the server started.\n")
+	fmt.Fprintf(w, "# TYPE hlg_uptime_seconds gauge\n")
+	fmt.Fprintf(w, "hlg_uptime_seconds %d\n", int64(s.now().Sub(s.startTime).Seconds()))
+}
+
+// writeCounters prints a counter family whose keys hold the label values
+// joined with "\x00"
+func writeCounters(w io.Writer, name, help string, c *counters, labels ...string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	snapshot := c.Snapshot()
+	for _, key := range sortedKeys(snapshot) {
+		values := strings.Split(key, "\x00")
+		pairs := make([]string, len(labels))
+		for i, label := range labels {
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			pairs[i] = label + "=" + quoteLabel(v)
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", name, strings.Join(pairs, ","), snapshot[key])
+	}
+}
+
+// quoteLabel quotes a label value, escaping backslashes, quotes and newlines
+func quoteLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return `"` + v + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
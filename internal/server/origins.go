@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+const rejectOriginNotAllowed = "origin_not_allowed"
+
+// originsTTL is how long the origin allowlist is cached. Changes made by
+// `hlg origins` in another process take effect within it.
+const originsTTL = 5 * time.Second
+
+// originCache holds the origin allowlist so requests don't each read it
+// from the store
+type originCache struct {
+	mu       sync.Mutex
+	list     []string
+	loadedAt time.Time
+}
+
+// NormalizeOrigin reduces a URL or origin to its lowercase scheme://host[:port]
+func NormalizeOrigin(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid origin %q: must look like https://example.com", raw)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// requestOrigin returns the normalized origin of the page that sent the
+// request, from the Origin header or, failing that, the Referer.
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		if normalized, err := NormalizeOrigin(origin); err == nil {
+			return normalized
+		}
+	}
+	if referer := r.Header.Get("Referer"); referer != "" {
+		if normalized, err := NormalizeOrigin(referer); err == nil {
+			return normalized
+		}
+	}
+	return ""
+}
+
+// allowedOrigins returns the cached origin allowlist, reloading it once
+// it is older than originsTTL
+func (s *Server) allowedOrigins() ([]string, error) {
+	c := &s.origins
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := s.now()
+	if !c.loadedAt.IsZero() && now.Sub(c.loadedAt) < originsTTL {
+		return c.list, nil
+	}
+	list, err := s.store.GetSettingList(context.Background(), store.SettingOrigins)
+	if err != nil {
+		return nil, err
+	}
+	c.list, c.loadedAt = list, now
+	return list, nil
+}
+
+// allowOrigin sets CORS headers and enforces the origin allowlist.
+// With no allowlist configured every origin is allowed via "*". Requests
+// with neither Origin nor Referer don't come from a web page (server-side
+// beacons, the Go client), so the allowlist doesn't apply to them. Returns
+// false if a 403 response was sent.
+func (s *Server) allowOrigin(w http.ResponseWriter, r *http.Request, methods string) bool {
+	allowed, err := s.allowedOrigins()
+	if err != nil {
+		s.serverError(w, "Failed to load origins", err)
+		return false
+	}
+
+	if len(allowed) == 0 {
+		setCORS(w, methods)
+		return true
+	}
+
+	if !fromWebPage(r) {
+		return true
+	}
+
+	origin := requestOrigin(r)
+	if origin == "" || !containsOrigin(allowed, origin) {
+		s.rejected.Inc(rejectOriginNotAllowed)
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Add("Vary", "Origin")
+	return true
+}
+
+// fromWebPage reports whether the request names the page that sent it.
+// Requests without Origin or Referer come from backends, not browsers.
+func fromWebPage(r *http.Request) bool {
+	return r.Header.Get("Origin") != "" || r.Header.Get("Referer") != ""
+}
+
+// testAllowsOrigin reports whether a test bound to specific origins accepts
+// events from this request. Like the global allowlist, it doesn't apply to
+// requests that don't come from a web page.
+func testAllowsOrigin(test *store.Test, r *http.Request) bool {
+	if len(test.Origins) == 0 || !fromWebPage(r) {
+		return true
+	}
+	origin := requestOrigin(r)
+	return origin != "" && containsOrigin(test.Origins, origin)
+}
+
+func containsOrigin(origins []string, origin string) bool {
+	for _, o := range origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
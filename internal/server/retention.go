@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+// runRetention applies the retention policies at startup and then every
+// interval until ctx is cancelled
+func (s *Server) runRetention(ctx context.Context, m store.Maintainer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.applyRetention(ctx, m)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyRetention rolls up expired raw events and releases the freed pages
+func (s *Server) applyRetention(ctx context.Context, m store.Maintainer) {
+	results, err := m.ApplyRetention(ctx, s.now(), false)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Error("retention failed", "error", err)
+		}
+		return
+	}
+
+	removed := 0
+	for _, r := range results {
+		if r.Events > 0 {
+			s.log.Info("rolled up raw events", "test", r.TestName, "events", r.Events, "before", r.Cutoff.Format("2006-01-02"))
+		}
+		removed += r.Events
+	}
+	if removed == 0 {
+		return
+	}
+
+	if err := m.Vacuum(ctx, false); err != nil {
+		s.log.Error("incremental vacuum failed", "error", err)
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+const maxEventBatch = 1000
+
+// ClientConfig is served to server-side SDKs so they can assign variants
+// locally with the same holdout and layer rules as hlg.js
+type ClientConfig struct {
+	Holdout float64             `json:"holdout"`
+	Layers  map[string][]string `json:"layers"`
+	Tests   []ClientTest        `json:"tests"`
+}
+
+// ClientTest is a running test as seen by server-side SDKs
+type ClientTest struct {
+	Name     string    `json:"name"`
+	Variants []string  `json:"variants"`
+	Weights  []float64 `json:"weights,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Target   string    `json:"target,omitempty"`
+}
+
+// EventsRequest is a batch of events sent by a server-side SDK
+type EventsRequest struct {
+	Events []EventRequest `json:"events"`
+}
+
+// EventRequest is one view or convert event in an EventsRequest
+type EventRequest struct {
+	TestName  string `json:"t"`
+	Variant   int    `json:"v"`
+	EventType string `json:"e"`
+	VisitorID string `json:"vid"`
+
+	// Optional; an event whose key was already recorded for the test is
+	// ignored, so a batch can be sent again after an ambiguous failure
+	IdempotencyKey string `json:"key,omitempty"`
+}
+
+type EventsResponse struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+func (s *Server) handleClientConfig(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	ctx := r.Context()
+	scriptCfg, err := s.scriptConfig(ctx)
+	if err != nil {
+		s.serverError(w, "Failed to load config", err)
+		return
+	}
+	tests, err := s.store.ListTests(ctx)
+	if err != nil {
+		s.serverError(w, "Failed to load tests", err)
+		return
+	}
+
+	cfg := ClientConfig{
+		Holdout: scriptCfg.Holdout,
+		Layers:  scriptCfg.Layers,
+		Tests:   []ClientTest{},
+	}
+	if cfg.Layers == nil {
+		cfg.Layers = map[string][]string{}
+	}
+	for _, t := range tests {
+		if t.State != store.StateRunning {
+			continue
+		}
+		cfg.Tests = append(cfg.Tests, ClientTest{
+			Name:     t.Name,
+			Variants: t.Variants,
+			Weights:  t.Weights,
+			URL:      t.URL,
+			Target:   t.Target,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxConversionBody)
+	var req EventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) > maxEventBatch {
+		http.Error(w, fmt.Sprintf("Too many events (max %d per request)", maxEventBatch), http.StatusBadRequest)
+		return
+	}
+
+	// Views are deduplicated by the store, and conversions by their
+	// idempotency keys, so a retried batch is safe
+	ctx := r.Context()
+	var resp EventsResponse
+	for i := range req.Events {
+		reason, err := s.recordSDKEvent(ctx, &req.Events[i])
+		if errors.Is(err, errBufferFull) {
+			// The client retries the whole batch; accepted events are deduplicated
+			s.rejected.Inc(rejectBufferFull)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server busy", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			s.serverError(w, "Failed to record events", err)
+			return
+		}
+		if reason != "" {
+			resp.Rejected++
+			resp.Errors = append(resp.Errors, fmt.Sprintf("event %d: %s", i, reason))
+			continue
+		}
+		resp.Accepted++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// recordSDKEvent validates and records one SDK event. It returns a reason
+// if the event was rejected, or an error if it could not be stored.
+func (s *Server) recordSDKEvent(ctx context.Context, e *EventRequest) (string, error) {
+	if e.TestName == "" || e.VisitorID == "" {
+		return "missing required fields", nil
+	}
+	if len(e.TestName) > maxTestNameLen || len(e.VisitorID) > maxVisitorIDLen || len(e.IdempotencyKey) > maxVisitorIDLen {
+		return "field too long", nil
+	}
+	if e.EventType != "view" && e.EventType != "convert" {
+		return "invalid event type", nil
+	}
+
+	test, err := s.store.GetTest(ctx, e.TestName)
+	if err == store.ErrNotFound {
+		return fmt.Sprintf("test %q not found", e.TestName), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if e.Variant < 0 || e.Variant >= len(test.Variants) {
+		return "invalid variant", nil
+	}
+
+	ok, err := s.eligible(ctx, e.VisitorID, test)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "visitor not eligible", nil
+	}
+
+	return "", s.recordEvent(ctx, store.Event{
+		TestName:       e.TestName,
+		Variant:        e.Variant,
+		EventType:      e.EventType,
+		VisitorID:      e.VisitorID,
+		IdempotencyKey: e.IdempotencyKey,
+	})
+}
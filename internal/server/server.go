@@ -1,33 +1,163 @@
 package server
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gkobilansky/headline-goat/internal/store"
 )
 
+// Config holds server settings. Zero values for the limits disable them.
+type Config struct {
+	Port       int
+	ListenAddr string // host:port to bind; overrides Port when set
+	TokenFile  string
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // How long to wait for in-flight requests on shutdown
+
+	TLSCertFile       string        // Serve HTTPS with this certificate (PEM)
+	TLSKeyFile        string        // Private key for TLSCertFile (PEM)
+	TLSReloadInterval time.Duration // How often to check the certificate files for changes
+	HTTPRedirectAddr  string        // Optional plain HTTP listener that redirects to HTTPS
+	HSTSMaxAge        time.Duration // Send Strict-Transport-Security over HTTPS when > 0
+
+	RateLimit      float64 // Requests per second per IP on public endpoints
+	RateBurst      int     // Burst size for RateLimit
+	MaxBodyBytes   int64   // Maximum beacon body size
+	MaxVariants    int     // Maximum variants for an auto-created test
+	MaxClientTests int     // Maximum distinct test names auto-created from clients
+	AutoCreateRate float64 // Auto-created tests per hour per IP
+
+	SignatureTTL time.Duration // Lifetime of view signatures when beacon signing is on
+
+	MetricsToken string // Bearer token required for /metrics; public when empty
+	AccessLog    bool   // Log every request at info level (hlg init turns it on)
+
+	// Write-behind buffering. With EventBufferSize > 0, beacons are queued
+	// and written in batches of up to EventBatchSize every
+	// EventFlushInterval; a full queue answers 503. Lookups of a visitor's
+	// views, such as conversions, write the queue first.
+	EventBufferSize    int
+	EventBatchSize     int
+	EventFlushInterval time.Duration
+
+	RetentionInterval time.Duration // How often to roll up expired raw events; 0 disables
+
+	// Scheduled backups. With BackupDir set, the database is copied there
+	// every BackupInterval and all but the newest BackupKeep copies are
+	// deleted (0 keeps them all).
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+	BackupGzip     bool
+
+	// Embedding options. PathPrefix mounts every route under a prefix such
+	// as "/_hlg". Auth replaces the dashboard token check when set. Logger
+	// and Now default to slog.Default() and time.Now.
+	PathPrefix string
+	Logger     *slog.Logger
+	Auth       func(r *http.Request) bool
+	Now        func() time.Time
+}
+
+// DefaultConfig returns the configuration used by New
+func DefaultConfig() Config {
+	return Config{
+		Port:               8080,
+		ReadHeaderTimeout:  5 * time.Second,
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       30 * time.Second,
+		IdleTimeout:        120 * time.Second,
+		ShutdownTimeout:    15 * time.Second,
+		TLSReloadInterval:  time.Minute,
+		RateLimit:          5,
+		RateBurst:          50,
+		MaxBodyBytes:       8 << 10,
+		MaxVariants:        10,
+		MaxClientTests:     100,
+		AutoCreateRate:     20,
+		SignatureTTL:       24 * time.Hour,
+		EventBatchSize:     500,
+		EventFlushInterval: time.Second,
+		RetentionInterval:  time.Hour,
+		BackupInterval:     24 * time.Hour,
+		BackupKeep:         7,
+	}
+}
+
 type Server struct {
-	store     *store.SQLiteStore
-	port      int
-	token     string
-	tokenFile string
-	router    *http.ServeMux
-	startTime time.Time
+	store      store.Store
+	cfg        Config
+	port       int
+	token      string
+	tokenFile  string
+	router     *http.ServeMux
+	startTime  time.Time
+	filtered   *counters // Beacons dropped as bot traffic, by reason
+	rejected   *counters // Requests rejected by abuse protection, by reason
+	metrics    *metrics
+	events     *eventBuffer // nil when events are written synchronously
+	limiter    *rateLimiter
+	autoCreate *rateLimiter
+	origins    originCache
+	log        *slog.Logger
+	now        func() time.Time
 }
 
 func New(s *store.SQLiteStore, port int, tokenFile string) *Server {
+	cfg := DefaultConfig()
+	cfg.Port = port
+	cfg.TokenFile = tokenFile
+	return NewWithConfig(s, cfg)
+}
+
+// NewWithConfig creates a server with explicit limits
+func NewWithConfig(s store.Store, cfg Config) *Server {
+	cfg.PathPrefix = strings.TrimRight(cfg.PathPrefix, "/")
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
 	srv := &Server{
-		store:     s,
-		port:      port,
-		token:     generateToken(),
-		tokenFile: tokenFile,
-		router:    http.NewServeMux(),
-		startTime: time.Now(),
+		store:      s,
+		cfg:        cfg,
+		port:       cfg.Port,
+		token:      generateToken(),
+		tokenFile:  cfg.TokenFile,
+		router:     http.NewServeMux(),
+		startTime:  cfg.Now(),
+		filtered:   newCounters(),
+		rejected:   newCounters(),
+		metrics:    newMetrics(),
+		limiter:    newRateLimiter(cfg.RateLimit, cfg.RateBurst),
+		autoCreate: newRateLimiter(cfg.AutoCreateRate/3600, int(math.Ceil(cfg.AutoCreateRate))),
+		log:        cfg.Logger,
+		now:        cfg.Now,
+	}
+	srv.events = newEventBuffer(s, cfg.EventBufferSize, cfg.EventBatchSize, cfg.EventFlushInterval, srv.log, srv.metrics)
+	if srv.limiter != nil {
+		srv.limiter.now = cfg.Now
+	}
+	if srv.autoCreate != nil {
+		srv.autoCreate.now = cfg.Now
 	}
 
 	srv.setupRoutes()
@@ -36,15 +166,27 @@ func New(s *store.SQLiteStore, port int, tokenFile string) *Server {
 
 func (s *Server) setupRoutes() {
 	// Public endpoints
-	s.router.HandleFunc("/health", s.handleHealth)
-	s.router.HandleFunc("/b", s.handleBeacon)
-	s.router.HandleFunc("/hlg.js", s.handleGlobalJS)
-	s.router.HandleFunc("/api/tests", s.handleTestsAPI)
+	s.handle("/health", http.HandlerFunc(s.handleHealth))
+	s.handle("/metrics", http.HandlerFunc(s.handleMetrics))
+	s.handle("/b", s.rateLimit(s.handleBeacon))
+	s.handle("/hlg.js", http.HandlerFunc(s.handleGlobalJS))
+	s.handle("/api/tests", s.rateLimit(s.handleTestsAPI))
+	s.handle("/identify", s.rateLimit(s.handleIdentify))
+
+	// Server-to-server endpoints (API key)
+	s.handle("/api/conversions", s.apiKeyAuth(s.handleConversions))
+	s.handle("/api/config", s.apiKeyAuth(s.handleClientConfig))
+	s.handle("/api/events", s.apiKeyAuth(s.handleEvents))
 
 	// Dashboard endpoints (protected)
-	s.router.Handle("/dashboard", s.authMiddleware(http.HandlerFunc(s.handleDashboard)))
-	s.router.Handle("/dashboard/test/", s.authMiddleware(http.HandlerFunc(s.handleDashboardTest)))
-	s.router.Handle("/dashboard/api/tests", s.authMiddleware(http.HandlerFunc(s.handleDashboardAPI)))
+	s.handle("/dashboard", s.authMiddleware(http.HandlerFunc(s.handleDashboard)))
+	s.handle("/dashboard/test/", s.authMiddleware(http.HandlerFunc(s.handleDashboardTest)))
+	s.handle("/dashboard/api/tests", s.authMiddleware(http.HandlerFunc(s.handleDashboardAPI)))
+}
+
+// handle registers a route with request metrics
+func (s *Server) handle(pattern string, h http.Handler) {
+	s.router.Handle(pattern, s.instrument(pattern, h))
 }
 
 func (s *Server) Start() error {
@@ -57,31 +199,139 @@ func (s *Server) StartQuiet() error {
 }
 
 func (s *Server) StartWithOptions(printMessages bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if printMessages {
+		fmt.Println()
+		scheme := "http"
+		if s.cfg.TLSCertFile != "" {
+			scheme = "https"
+		}
+		fmt.Printf("🐐 Headline Goat running on %s://localhost:%d\n", scheme, s.port)
+		fmt.Printf("Dashboard: %s://localhost:%d/dashboard?token=%s\n", scheme, s.port, s.token)
+		fmt.Println()
+		fmt.Println("Press Ctrl+C to stop")
+	}
+
+	return s.Run(ctx)
+}
+
+// Addr returns the address the server binds to
+func (s *Server) Addr() string {
+	if s.cfg.ListenAddr != "" {
+		return s.cfg.ListenAddr
+	}
+	return fmt.Sprintf(":%d", s.port)
+}
+
+// Run serves until ctx is cancelled, then stops accepting connections,
+// waits up to ShutdownTimeout for in-flight requests to finish and removes
+// the token file. The caller closes the store afterwards.
+func (s *Server) Run(ctx context.Context) error {
 	// Write token to file for OTP command
 	if s.tokenFile != "" {
 		if err := os.WriteFile(s.tokenFile, []byte(s.token), 0600); err != nil {
-			fmt.Printf("Warning: failed to write token file: %v\n", err)
+			s.log.Warn("failed to write token file", "path", s.tokenFile, "error", err)
 		}
+		defer os.Remove(s.tokenFile)
 	}
 
-	addr := fmt.Sprintf(":%d", s.port)
+	httpServer := &http.Server{
+		Addr:              s.Addr(),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: s.cfg.ReadHeaderTimeout,
+		ReadTimeout:       s.cfg.ReadTimeout,
+		WriteTimeout:      s.cfg.WriteTimeout,
+		IdleTimeout:       s.cfg.IdleTimeout,
+	}
+	servers := []*http.Server{httpServer}
 
-	if printMessages {
-		fmt.Println()
-		fmt.Printf("🐐 Headline Goat running on http://localhost:%d\n", s.port)
-		fmt.Printf("Dashboard: http://localhost:%d/dashboard?token=%s\n", s.port, s.token)
-		fmt.Println()
-		fmt.Println("Press Ctrl+C to stop")
+	useTLS := s.cfg.TLSCertFile != "" || s.cfg.TLSKeyFile != ""
+	if useTLS {
+		certs, err := newCertReloader(s.cfg.TLSCertFile, s.cfg.TLSKeyFile, s.log)
+		if err != nil {
+			return err
+		}
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go certs.watch(watchCtx, s.cfg.TLSReloadInterval)
+
+		httpServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+
+		if s.cfg.HTTPRedirectAddr != "" {
+			servers = append(servers, &http.Server{
+				Addr:              s.cfg.HTTPRedirectAddr,
+				Handler:           redirectToHTTPS(s.Addr()),
+				ReadHeaderTimeout: s.cfg.ReadHeaderTimeout,
+				IdleTimeout:       s.cfg.IdleTimeout,
+			})
+		}
+	}
+
+	// Stores without maintenance operations skip the scheduled jobs
+	if m, ok := s.store.(store.Maintainer); ok && s.cfg.RetentionInterval > 0 {
+		retentionCtx, stopRetention := context.WithCancel(ctx)
+		defer stopRetention()
+		go s.runRetention(retentionCtx, m, s.cfg.RetentionInterval)
+	}
+
+	if b, ok := s.store.(store.Backuper); ok && s.cfg.BackupDir != "" && s.cfg.BackupInterval > 0 {
+		backupCtx, stopBackups := context.WithCancel(ctx)
+		defer stopBackups()
+		go s.runBackups(backupCtx, b)
 	}
 
-	return http.ListenAndServe(addr, s.router)
+	s.log.Info("listening", "addr", s.Addr(), "tls", useTLS)
+	errc := make(chan error, len(servers))
+	for i, srv := range servers {
+		srv := srv
+		tlsListener := useTLS && i == 0
+		go func() {
+			if tlsListener {
+				errc <- srv.ListenAndServeTLS("", "")
+			} else {
+				errc <- srv.ListenAndServe()
+			}
+		}()
+	}
+
+	var runErr error
+	select {
+	case runErr = <-errc:
+	case <-ctx.Done():
+	}
+
+	s.log.Info("shutting down", "timeout", s.cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil && runErr == nil {
+			runErr = fmt.Errorf("failed to drain requests: %w", err)
+		}
+	}
+
+	// Requests have drained, so no more events can be queued
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancelFlush()
+	if err := s.Close(flushCtx); err != nil && (runErr == nil || runErr == http.ErrServerClosed) {
+		runErr = err
+	}
+
+	if runErr == http.ErrServerClosed {
+		return nil
+	}
+	return runErr
 }
 
 func (s *Server) Token() string {
 	return s.token
 }
 
-func (s *Server) Store() *store.SQLiteStore {
+func (s *Server) Store() store.Store {
 	return s.store
 }
 
@@ -89,8 +339,28 @@ func (s *Server) StartTime() time.Time {
 	return s.startTime
 }
 
+// Handler returns the server's routes. With a PathPrefix the handler
+// expects requests under that prefix, e.g. mux.Handle("/_hlg/", h).
 func (s *Server) Handler() http.Handler {
-	return s.router
+	var h http.Handler = s.router
+	if s.cfg.PathPrefix != "" {
+		h = http.StripPrefix(s.cfg.PathPrefix, h)
+	}
+	if s.cfg.HSTSMaxAge > 0 {
+		h = hsts(s.cfg.HSTSMaxAge, h)
+	}
+	return h
+}
+
+// path returns an absolute URL path for a route, including the PathPrefix
+func (s *Server) path(route string) string {
+	return s.cfg.PathPrefix + route
+}
+
+// serverError logs an internal error and sends a 500 response
+func (s *Server) serverError(w http.ResponseWriter, msg string, err error) {
+	s.log.Error(msg, "error", err)
+	http.Error(w, msg, http.StatusInternalServerError)
 }
 
 func generateToken() string {
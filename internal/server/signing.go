@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+const rejectInvalidSignature = "invalid_signature"
+
+// SignedView is returned for view beacons when beacon signing is enabled.
+// hlg.js stores it and echoes it back with the conversion beacon.
+type SignedView struct {
+	Signature string `json:"sig"`
+	Expires   int64  `json:"exp"`
+}
+
+// signingSecret returns the HMAC secret if beacon signing is enabled
+func (s *Server) signingSecret(ctx context.Context) ([]byte, bool, error) {
+	enabled, err := s.store.GetSetting(ctx, store.SettingBeaconSigning)
+	if err == store.ErrNotFound || (err == nil && enabled != "on") {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	secret, err := s.store.GetSetting(ctx, store.SettingBeaconSecret)
+	if err != nil {
+		return nil, false, fmt.Errorf("beacon signing is on but no secret is set: %w", err)
+	}
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid beacon secret: %w", err)
+	}
+	return key, true, nil
+}
+
+// signView issues a signature binding a visitor to the variant they viewed
+func (s *Server) signView(secret []byte, testName string, variant int, visitorID string) SignedView {
+	exp := s.now().Add(s.cfg.SignatureTTL).Unix()
+	return SignedView{
+		Signature: beaconMAC(secret, testName, variant, visitorID, exp),
+		Expires:   exp,
+	}
+}
+
+// verifyConversion checks a conversion beacon's signature and expiry
+func verifyConversion(secret []byte, req *BeaconRequest, now time.Time) bool {
+	if req.Signature == "" || req.Expires < now.Unix() {
+		return false
+	}
+	want := beaconMAC(secret, req.TestName, req.Variant, req.VisitorID, req.Expires)
+	return hmac.Equal([]byte(want), []byte(req.Signature))
+}
+
+func beaconMAC(secret []byte, testName string, variant int, visitorID string, exp int64) string {
+	mac := hmac.New(sha256.New, secret)
+	// Length-prefix the free-form fields so no two inputs collide
+	fmt.Fprintf(mac, "%d:%s|%d|%d:%s|%s", len(testName), testName, variant, len(visitorID), visitorID, strconv.FormatInt(exp, 10))
+	return hex.EncodeToString(mac.Sum(nil))
+}
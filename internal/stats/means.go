@@ -0,0 +1,61 @@
+package stats
+
+import "math"
+
+// MeanInterval calculates the mean of a per-visitor count from its sum and
+// sum of squares over n visitors, with a normal-approximation confidence
+// interval using the sample variance. The lower bound is clamped to 0.
+func MeanInterval(sum int, sumSq float64, n int, confidence float64) (mean, lower, upper float64) {
+	if n == 0 {
+		return 0, 0, 0
+	}
+
+	mean = float64(sum) / float64(n)
+	spread := ZScore(confidence) * math.Sqrt(meanVariance(sum, sumSq, n))
+
+	lower = mean - spread
+	upper = mean + spread
+	if lower < 0 {
+		lower = 0
+	}
+	return mean, lower, upper
+}
+
+// meanVariance returns the variance of the mean of a per-visitor count,
+// the sample variance divided by n
+func meanVariance(sum int, sumSq float64, n int) float64 {
+	if n < 2 {
+		return 0
+	}
+	nf := float64(n)
+	mean := float64(sum) / nf
+	variance := (sumSq - nf*mean*mean) / (nf - 1)
+	if variance < 0 {
+		variance = 0 // Rounding
+	}
+	return variance / nf
+}
+
+// MeanSignificanceTest performs a Welch z-test on the means of a
+// per-visitor count. Returns confidence level (0-1) that variant A's mean
+// is higher than variant B's.
+func MeanSignificanceTest(aSum int, aSumSq float64, aN int, bSum int, bSumSq float64, bN int) float64 {
+	if aN == 0 || bN == 0 {
+		return 0.5 // Need data from both variants
+	}
+
+	meanA := float64(aSum) / float64(aN)
+	meanB := float64(bSum) / float64(bN)
+	se := math.Sqrt(meanVariance(aSum, aSumSq, aN) + meanVariance(bSum, bSumSq, bN))
+
+	if se == 0 {
+		if meanA > meanB {
+			return 1.0
+		} else if meanA < meanB {
+			return 0.0
+		}
+		return 0.5
+	}
+
+	return normalCDF((meanA - meanB) / se)
+}
@@ -12,6 +12,12 @@ type Result struct {
 	Confident       bool    // >= 95% confidence
 	ConfidenceLevel float64 // 0-1
 	LeadingVariant  int
+
+	// Events per visitor, for tests counting repeat conversions
+	// (zero otherwise): the variant with the highest mean, and the
+	// confidence that it beats control
+	EventsConfidenceLevel float64
+	EventsLeadingVariant  int
 }
 
 // VariantResult contains statistics for a single variant
@@ -20,9 +26,22 @@ type VariantResult struct {
 	Name        string
 	Views       int
 	Conversions int
+	Value       float64 // Sum of conversion values
 	Rate        float64
-	CILower     float64
-	CIUpper     float64
+
+	// Conversions excluded by the attribution rules (see store.VariantStats)
+	Unattributed int
+	Mismatched   int
+
+	CILower float64
+	CIUpper float64
+
+	// Conversion events counted under the test's CountMode, their mean
+	// per visitor and its 95% CI. Zero unless the test counts repeats.
+	Events           int
+	EventsPerVisitor float64
+	EventsCILower    float64
+	EventsCIUpper    float64
 }
 
 // SignificanceTest performs a two-proportion z-test.
@@ -117,9 +136,13 @@ func Analyze(test *store.Test, variantStats []store.VariantStats) *Result {
 			Name:        name,
 			Views:       stat.Views,
 			Conversions: stat.Conversions,
+			Value:       stat.Value,
 			Rate:        rate,
 			CILower:     ciLower,
 			CIUpper:     ciUpper,
+
+			Unattributed: stat.Unattributed,
+			Mismatched:   stat.Mismatched,
 		}
 
 		if rate > maxRate {
@@ -155,10 +178,60 @@ func Analyze(test *store.Test, variantStats []store.VariantStats) *Result {
 		}
 	}
 
-	return &Result{
+	result := &Result{
 		Variants:        variants,
 		Confident:       confidenceLevel >= 0.95,
 		ConfidenceLevel: confidenceLevel,
 		LeadingVariant:  leadingVariant,
 	}
+	if CountsRepeats(test) {
+		analyzeEvents(result, statsMap)
+	}
+	return result
+}
+
+// CountsRepeats reports whether a test counts repeat conversions
+func CountsRepeats(test *store.Test) bool {
+	return test.CountMode == store.CountEvery || test.CountMode == store.CountCapped
+}
+
+// analyzeEvents adds events per visitor to a result, comparing the variant
+// with the highest mean against control the same way Analyze compares rates
+func analyzeEvents(result *Result, statsMap map[int]store.VariantStats) {
+	variants := result.Variants
+	maxMean := 0.0
+	leading := 0
+	for i := range variants {
+		stat := statsMap[i]
+		mean, lower, upper := MeanInterval(stat.Events, stat.EventsSumSq, stat.Views, 0.95)
+		variants[i].Events = stat.Events
+		variants[i].EventsPerVisitor = mean
+		variants[i].EventsCILower = lower
+		variants[i].EventsCIUpper = upper
+
+		if mean > maxMean {
+			maxMean = mean
+			leading = i
+		}
+	}
+	result.EventsLeadingVariant = leading
+
+	if len(variants) < 2 {
+		return
+	}
+	other := 0
+	if leading == 0 {
+		// Control is leading, compare against best challenger
+		other = 1
+		for i := 2; i < len(variants); i++ {
+			if variants[i].EventsPerVisitor > variants[other].EventsPerVisitor {
+				other = i
+			}
+		}
+	}
+	a, b := statsMap[leading], statsMap[other]
+	result.EventsConfidenceLevel = MeanSignificanceTest(
+		a.Events, a.EventsSumSq, a.Views,
+		b.Events, b.EventsSumSq, b.Views,
+	)
 }
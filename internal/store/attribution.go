@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// attributionStatus returns an SQL expression classifying a conversion as
+// 'attributed', 'unattributed' or 'mismatched'. credited is the variant the
+// converter viewed (NULL if none) and viewedAt when; window is in seconds,
+// 0 for no limit. A view with an unknown time counts as in time.
+func attributionStatus(claimed, credited, viewedAt, convertedAt string, window int64) string {
+	return attributionCase(claimed, credited, viewedAt, convertedAt, strconv.FormatInt(window, 10))
+}
+
+// windowSetting reads the attribution window inside SQL, for the triggers
+// that keep variant_daily
+const windowSetting = `COALESCE((SELECT CAST(value AS INTEGER) FROM settings
+	WHERE key = '` + SettingAttributionWindow + `'), 0)`
+
+// attributionCase is attributionStatus with the window given as an SQL
+// expression
+func attributionCase(claimed, credited, viewedAt, convertedAt, window string) string {
+	return `CASE
+		WHEN ` + credited + ` IS NULL THEN 'unattributed'
+		WHEN ` + credited + ` != ` + claimed + ` THEN 'mismatched'
+		WHEN ` + viewedAt + ` > ` + convertedAt + ` THEN 'unattributed'
+		WHEN ` + window + ` > 0 AND ` + convertedAt + ` - ` + viewedAt + ` > ` + window + ` THEN 'unattributed'
+		ELSE 'attributed' END`
+}
+
+// GetAttributionWindow returns the longest time between a view and a
+// conversion credited to it (0 means no limit)
+func (s *SQLiteStore) GetAttributionWindow(ctx context.Context) (time.Duration, error) {
+	value, err := s.GetSetting(ctx, SettingAttributionWindow)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid attribution window %q: %w", value, err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// SetAttributionWindow sets the longest time between a view and a
+// conversion credited to it, rounded down to whole seconds (0 means no
+// limit). Results apply it immediately, including to past events that
+// retention hasn't rolled up, by rebuilding the aggregates.
+func (s *SQLiteStore) SetAttributionWindow(ctx context.Context, window time.Duration) error {
+	if window < 0 {
+		return fmt.Errorf("attribution window must not be negative, got %s", window)
+	}
+	err := s.SetSetting(ctx, SettingAttributionWindow, strconv.FormatInt(int64(window/time.Second), 10))
+	if err != nil {
+		return err
+	}
+	return s.RebuildAggregates(ctx, "")
+}
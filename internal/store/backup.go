@@ -0,0 +1,281 @@
+package store
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Backup writes a consistent copy of the database to path, optionally
+// gzipped. It uses VACUUM INTO, so it is safe while the server is writing
+// and the copy is compacted. The copy appears at path only once complete,
+// and an existing file is never overwritten.
+func (s *SQLiteStore) Backup(ctx context.Context, path string, compress bool) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup %s already exists", path)
+	}
+
+	snapshot := path + ".snapshot"
+	os.Remove(snapshot) // Left behind by an interrupted backup
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", snapshot); err != nil {
+		os.Remove(snapshot)
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+
+	if !compress {
+		return os.Rename(snapshot, path)
+	}
+	defer os.Remove(snapshot)
+
+	tmp := path + ".tmp"
+	if err := gzipFile(snapshot, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// isGzip reports whether the file at path is gzip-compressed
+func isGzip(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, nil // Too short for gzip; let SQLite reject it
+	}
+	return header[0] == gzipMagic[0] && header[1] == gzipMagic[1], nil
+}
+
+// gunzipFile decompresses src into dst
+func gunzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(in))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, zr); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// VerifyDatabase checks that the file at path is an intact headline-goat
+// database, without modifying it. Errors don't include the path.
+func VerifyDatabase(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("not a valid database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	var tables int
+	err = db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('tests', 'events')`).Scan(&tables)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+	if tables != 2 {
+		return errors.New("not a headline-goat database")
+	}
+	return nil
+}
+
+// VerifyBackup checks a backup written by Backup, gzipped or not
+func VerifyBackup(ctx context.Context, path string) error {
+	return withPlainCopy(path, func(plain string) error {
+		if err := VerifyDatabase(ctx, plain); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// withPlainCopy calls fn with the path of an uncompressed copy of the
+// backup at path, or path itself if it isn't compressed
+func withPlainCopy(path string, fn func(plain string) error) error {
+	compressed, err := isGzip(path)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if !compressed {
+		return fn(path)
+	}
+
+	tmp, err := os.CreateTemp("", "hlg-restore-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := gunzipFile(path, tmp.Name()); err != nil {
+		return fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	return fn(tmp.Name())
+}
+
+// Restore replaces the database at dbPath with the backup at backupPath
+// once the backup passes VerifyDatabase. The current database is kept as
+// dbPath plus a ".pre-restore-<timestamp>" suffix, whose path is returned
+// ("" if there was none). The server must not be running.
+func Restore(ctx context.Context, backupPath, dbPath string) (string, error) {
+	// Stage the backup next to the database so the final rename is atomic
+	staged := dbPath + ".restore"
+	os.Remove(staged)
+
+	compressed, err := isGzip(backupPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	if compressed {
+		err = gunzipFile(backupPath, staged)
+	} else {
+		err = copyFile(backupPath, staged)
+	}
+	if err != nil {
+		os.Remove(staged)
+		return "", fmt.Errorf("failed to stage backup: %w", err)
+	}
+
+	if err := VerifyDatabase(ctx, staged); err != nil {
+		os.Remove(staged)
+		return "", fmt.Errorf("%s: %w", backupPath, err)
+	}
+
+	previous := ""
+	if _, err := os.Stat(dbPath); err == nil {
+		// Fold the write-ahead log into the current database so the kept
+		// copy is complete on its own
+		if err := checkpointWAL(ctx, dbPath); err != nil {
+			os.Remove(staged)
+			return "", fmt.Errorf("failed to checkpoint current database: %w", err)
+		}
+
+		previous = dbPath + ".pre-restore-" + time.Now().UTC().Format("20060102-150405")
+		if err := os.Rename(dbPath, previous); err != nil {
+			os.Remove(staged)
+			return "", fmt.Errorf("failed to move current database aside: %w", err)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", undoRestore(staged, previous, dbPath, fmt.Errorf("failed to remove %s: %w", dbPath+suffix, err))
+		}
+	}
+
+	if err := os.Rename(staged, dbPath); err != nil {
+		return "", undoRestore(staged, previous, dbPath, fmt.Errorf("failed to move backup into place: %w", err))
+	}
+	return previous, nil
+}
+
+// checkpointWAL writes the write-ahead log into the database file and
+// truncates it. The database is opened bare, without Open's migrations, so
+// nothing else about it changes.
+func checkpointWAL(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var busy, logFrames, checkpointed int
+	err = db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		return err
+	}
+	if busy != 0 {
+		return errors.New("database is in use")
+	}
+	return nil
+}
+
+// undoRestore removes the staged backup and moves the previous database
+// back after a failed restore. If that fails too, the error says where the
+// previous database was left.
+func undoRestore(staged, previous, dbPath string, err error) error {
+	os.Remove(staged)
+	if previous == "" {
+		return err
+	}
+	if rerr := os.Rename(previous, dbPath); rerr != nil {
+		return fmt.Errorf("%w; previous database left at %s", err, previous)
+	}
+	return err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
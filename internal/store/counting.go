@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SetTestCounting sets how a test counts repeat conversions. cap is the
+// most conversions counted per visitor with CountCapped and is ignored
+// otherwise. Results apply it immediately, including to past conversions.
+func (s *SQLiteStore) SetTestCounting(ctx context.Context, name string, mode CountMode, cap int) error {
+	var capValue sql.NullInt64
+	switch mode {
+	case CountUnique, CountEvery:
+	case CountCapped:
+		if cap < 1 {
+			return fmt.Errorf("count cap must be at least 1, got %d", cap)
+		}
+		capValue = sql.NullInt64{Int64: int64(cap), Valid: true}
+	default:
+		return fmt.Errorf("unknown count mode %q", mode)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE tests SET count_mode = ?, count_cap = ?, updated_at = ? WHERE name = ?`,
+		string(mode), capValue, time.Now().Unix(), name)
+	if err != nil {
+		return fmt.Errorf("failed to set counting: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// eventStatsQuery counts the conversion events of tests that count repeat
+// conversions, per resolved identity, capped as the test says. Each
+// identity is credited to the variant of its first view, and events follow
+// the same attribution rules as unique conversions. Visitor IDs not linked
+// to a user with other visitor IDs are their own identity, and their
+// attributed events are read from visitor_conversions. Users with several
+// are counted from their raw and rolled-up events. filter restricts the
+// tests read and is used five times.
+func eventStatsQuery(filter string, window int64) string {
+	return `
+		WITH stitched AS (
+			SELECT i.visitor_id, i.user_id
+			FROM identities i
+			JOIN (SELECT user_id FROM identities GROUP BY user_id HAVING COUNT(*) > 1) m
+			  ON m.user_id = i.user_id
+		),
+		views AS (
+			SELECT e.test_name, st.user_id AS identity, e.variant, e.created_at, e.id
+			FROM stitched st
+			CROSS JOIN tests t
+			JOIN events e ON e.test_name = t.name AND e.visitor_id = st.visitor_id AND e.event_type = 'view'
+			WHERE t.count_mode IN ('every', 'capped') ` + strings.ReplaceAll(filter, "{col}", "t.name") + `
+			UNION ALL
+			SELECT cv.test_name, st.user_id, cv.variant, cv.viewed_at, 0
+			FROM stitched st
+			CROSS JOIN tests t
+			JOIN compacted_visitors cv ON cv.test_name = t.name AND cv.visitor_id = st.visitor_id
+			WHERE cv.variant IS NOT NULL AND t.count_mode IN ('every', 'capped')
+			  ` + strings.ReplaceAll(filter, "{col}", "t.name") + `
+		),
+		assigned AS (
+			SELECT test_name, identity, variant, created_at AS viewed_at FROM (
+				SELECT test_name, identity, variant, created_at,
+				       ROW_NUMBER() OVER (PARTITION BY test_name, identity ORDER BY created_at, id) AS rn
+				FROM views
+			) WHERE rn = 1
+		),
+		counted (test_name, identity, variant, n) AS (
+			SELECT vc.test_name, vc.visitor_id, vc.variant, vc.events
+			FROM visitor_conversions vc
+			JOIN tests t ON t.name = vc.test_name
+			WHERE t.count_mode IN ('every', 'capped')
+			  AND vc.visitor_id NOT IN (SELECT visitor_id FROM stitched)
+			  ` + strings.ReplaceAll(filter, "{col}", "vc.test_name") + `
+			UNION ALL
+			SELECT a.test_name, a.identity, a.variant, 1
+			FROM stitched st
+			CROSS JOIN tests t
+			JOIN conversion_events c ON c.test_name = t.name AND c.visitor_id = st.visitor_id
+			JOIN assigned a ON a.test_name = c.test_name AND a.identity = st.user_id
+			WHERE ` + attributionStatus("c.variant", "a.variant", "a.viewed_at", "c.created_at", window) + ` = 'attributed'
+			  ` + strings.ReplaceAll(filter, "{col}", "c.test_name") + `
+			UNION ALL
+			SELECT a.test_name, a.identity, a.variant, cv.conversion_events
+			FROM stitched st
+			CROSS JOIN tests t
+			JOIN compacted_visitors cv ON cv.test_name = t.name AND cv.visitor_id = st.visitor_id
+			JOIN assigned a ON a.test_name = cv.test_name AND a.identity = st.user_id
+			WHERE cv.conversion_events > 0 ` + strings.ReplaceAll(filter, "{col}", "cv.test_name") + `
+		),
+		per_identity AS (
+			SELECT c.test_name, c.variant,
+			       CASE WHEN t.count_mode = 'capped' THEN MIN(SUM(c.n), t.count_cap) ELSE SUM(c.n) END AS n
+			FROM counted c
+			JOIN tests t ON t.name = c.test_name
+			GROUP BY c.test_name, c.identity, c.variant
+		)
+		SELECT test_name, variant, SUM(n), SUM(n * n)
+		FROM per_identity
+		GROUP BY test_name, variant`
+}
+
+// addEventStats fills in Events and EventsSumSq for tests that count
+// repeat conversions
+func (s *SQLiteStore) addEventStats(ctx context.Context, stats map[string][]VariantStats, query string, args ...interface{}) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get event stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var variant, events int
+		var sumSq float64
+		if err := rows.Scan(&name, &variant, &events, &sumSq); err != nil {
+			return fmt.Errorf("failed to scan event stats: %w", err)
+		}
+		for i := range stats[name] {
+			if stats[name][i].Variant == variant {
+				stats[name][i].Events = events
+				stats[name][i].EventsSumSq = sumSq
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get event stats: %w", err)
+	}
+	return nil
+}
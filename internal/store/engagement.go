@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Validate checks that the goal has the setting its type needs
+func (g *EngagementGoal) Validate() error {
+	switch g.Type {
+	case GoalScroll:
+		if g.Percent < 1 || g.Percent > 100 {
+			return fmt.Errorf("scroll goal needs a percentage from 1 to 100, got %d", g.Percent)
+		}
+	case GoalDwell:
+		if g.Seconds < 1 {
+			return fmt.Errorf("dwell goal needs at least 1 second, got %d", g.Seconds)
+		}
+	case GoalVisible, GoalSubmit:
+		if g.Selector == "" {
+			return fmt.Errorf("%s goal needs a CSS selector", g.Type)
+		}
+	default:
+		return fmt.Errorf("unknown goal type %q", g.Type)
+	}
+	return nil
+}
+
+// SetTestEngagement sets the engagement goal hlg.js converts visitors on
+// (nil clears it)
+func (s *SQLiteStore) SetTestEngagement(ctx context.Context, name string, goal *EngagementGoal) error {
+	var goalJSON []byte
+	if goal != nil {
+		if err := goal.Validate(); err != nil {
+			return err
+		}
+		var err error
+		goalJSON, err = json.Marshal(goal)
+		if err != nil {
+			return fmt.Errorf("failed to marshal engagement goal: %w", err)
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE tests SET engagement = ?, updated_at = ? WHERE name = ?`,
+		nullableString(goalJSON), time.Now().Unix(), name)
+	if err != nil {
+		return fmt.Errorf("failed to set engagement goal: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
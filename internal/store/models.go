@@ -10,35 +10,146 @@ const (
 	StateCompleted TestState = "completed"
 )
 
+// CountMode is how a test counts repeat conversions by the same visitor
+type CountMode string
+
+const (
+	CountUnique CountMode = "unique" // At most one conversion per visitor (default)
+	CountEvery  CountMode = "every"  // Every conversion
+	CountCapped CountMode = "capped" // Up to CountCap conversions per visitor
+)
+
 type Test struct {
 	ID                int64
 	Name              string
-	Variants          []string  // Decoded from JSON
-	Weights           []float64 // Optional, decoded from JSON
-	ConversionGoal    string    // Optional description of what conversion means
+	Variants          []string         // Decoded from JSON; variant names for typed payloads
+	Payloads          []VariantPayload // Typed variants aligned with Variants (nil if all are plain text)
+	Weights           []float64        // Optional, decoded from JSON
+	ConversionGoal    string           // Optional description of what conversion means
 	State             TestState
 	WinnerVariant     *int
 	Source            string // "client" or "server"
 	HasSourceConflict bool
-	URL               string // For URL-based matching
-	ConversionURL     string // URL-based conversion
-	Target            string // CSS selector for headline
-	CTATarget         string // CSS selector for CTA
+	URL               string          // For URL-based matching
+	ConversionURL     string          // URL-based conversion
+	Target            string          // CSS selector for headline
+	CTATarget         string          // CSS selector for CTA
+	Layer             string          // Mutually exclusive layer; a visitor sees at most one test per layer
+	Origins           []string        // Origins allowed to send events (empty = any allowed origin)
+	RetentionDays     *int            // Days of raw events to keep; nil uses the global setting, 0 keeps forever
+	CompactedBefore   time.Time       // Raw events before this day have been rolled up (zero if never)
+	CountMode         CountMode       // How repeat conversions are counted
+	CountCap          int             // Conversions counted per visitor with CountCapped
+	Engagement        *EngagementGoal // Optional client-side goal that converts (nil if none)
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 }
 
+// PayloadType is how hlg.js applies a variant to a test's target
+type PayloadType string
+
+const (
+	PayloadText  PayloadType = "text"  // Replace the text (plain string variants)
+	PayloadHTML  PayloadType = "html"  // Replace the inner HTML with sanitized inline markup
+	PayloadAttrs PayloadType = "attrs" // Set attributes, e.g. an image src
+	PayloadClass PayloadType = "class" // Add and remove CSS classes
+	PayloadMulti PayloadType = "multi" // Change several elements together
+)
+
+// VariantPayload is a typed variant. Text variants are stored as plain
+// strings in the variants JSON, other types as objects.
+type VariantPayload struct {
+	Type   PayloadType       `json:"type"`
+	Label  string            `json:"label,omitempty"` // Name in results (derived from the payload if empty)
+	Text   string            `json:"text,omitempty"`
+	HTML   string            `json:"html,omitempty"`
+	Attrs  map[string]string `json:"attrs,omitempty"`
+	Add    []string          `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+
+	Changes []ElementChange `json:"changes,omitempty"` // PayloadMulti: applied all at once
+}
+
+// ElementChange is one element a multi-element variant changes, and how
+type ElementChange struct {
+	Selector string `json:"selector"`
+	VariantPayload
+}
+
+// GoalType is the kind of engagement that converts a visitor in hlg.js
+type GoalType string
+
+const (
+	GoalScroll  GoalType = "scroll"  // Scrolled past Percent of the page
+	GoalDwell   GoalType = "dwell"   // Page visible for Seconds
+	GoalVisible GoalType = "visible" // Selector entered the viewport
+	GoalSubmit  GoalType = "submit"  // A form matching Selector was submitted
+)
+
+// EngagementGoal is a conversion the global script detects on the test's
+// page, in place of or alongside a click or URL conversion
+type EngagementGoal struct {
+	Type     GoalType `json:"type"`
+	Percent  int      `json:"percent,omitempty"`
+	Seconds  int      `json:"seconds,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+}
+
 type Event struct {
 	ID        int64
 	TestName  string
 	Variant   int
 	EventType string // "view" or "convert"
 	VisitorID string
+	Value     float64 // Conversion value (0 if none)
 	CreatedAt time.Time
+
+	IdempotencyKey string // Optional; repeated keys are ignored per test
+}
+
+// Conversion is a server-side conversion reported by a backend
+type Conversion struct {
+	TestName       string
+	Variant        int
+	VisitorID      string
+	Value          float64
+	IdempotencyKey string    // Optional; repeated keys are ignored per test
+	Timestamp      time.Time // Zero means now
 }
 
 type VariantStats struct {
+	Variant     int
+	Views       int
+	Conversions int     // Conversions credited under the attribution rules
+	Value       float64 // Sum of conversion values
+
+	// Conversions claiming this variant that don't count: Unattributed had
+	// no view of the variant before them or within the attribution window;
+	// Mismatched came from visitors who were shown another variant.
+	Unattributed int
+	Mismatched   int
+
+	// Conversion events counted under the test's CountMode, and the sum of
+	// the squares of each visitor's count, for the mean and variance of
+	// events per visitor. Zero with CountUnique.
+	Events      int
+	EventsSumSq float64
+}
+
+// DailyStats is one day of rolled-up counts for a variant
+type DailyStats struct {
+	Day         time.Time // UTC midnight
 	Variant     int
 	Views       int
 	Conversions int
+	Value       float64
+}
+
+// RetentionResult describes the raw events a retention run rolls up for a
+// test
+type RetentionResult struct {
+	TestName string
+	Days     int       // Days of raw events kept
+	Cutoff   time.Time // Raw events before this time are rolled up
+	Events   int       // Raw events removed, or that would be in a preview
 }
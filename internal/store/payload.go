@@ -0,0 +1,462 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Inline markup allowed in HTML payloads. Attributes allowed on every tag
+// are listed under "*".
+var (
+	allowedTags = map[string]bool{
+		"a": true, "abbr": true, "b": true, "br": true, "cite": true, "code": true,
+		"del": true, "em": true, "i": true, "ins": true, "kbd": true, "mark": true,
+		"q": true, "s": true, "small": true, "span": true, "strong": true,
+		"sub": true, "sup": true, "u": true, "wbr": true,
+	}
+	voidTags    = map[string]bool{"br": true, "wbr": true}
+	allowedAttr = map[string]map[string]bool{
+		"*": {"class": true, "title": true, "lang": true, "dir": true},
+		"a": {"href": true, "target": true, "rel": true},
+	}
+	// Attributes that load, navigate to or send requests to a URL
+	urlAttrs = map[string]bool{
+		"href": true, "src": true, "action": true, "formaction": true,
+		"poster": true, "xlink:href": true, "srcset": true, "data": true,
+		"background": true, "ping": true, "cite": true, "codebase": true,
+	}
+	// URL attributes that hold images, which may use data:image URLs
+	imageAttrs = map[string]bool{"src": true, "srcset": true, "background": true}
+
+	attrNamePattern = regexp.MustCompile(`^[a-zA-Z_:][-a-zA-Z0-9_:.]*$`)
+	tagPattern      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Validate checks that the payload has what its type needs. HTML is
+// replaced with its sanitized form.
+func (p *VariantPayload) Validate() error {
+	switch p.Type {
+	case PayloadText:
+	case PayloadHTML:
+		clean, err := sanitizeHTML(p.HTML)
+		if err != nil {
+			return fmt.Errorf("invalid html payload: %w", err)
+		}
+		p.HTML = clean
+	case PayloadAttrs:
+		if len(p.Attrs) == 0 {
+			return fmt.Errorf("attrs payload needs at least one attribute")
+		}
+		for name, value := range p.Attrs {
+			if err := checkAttr(name, value); err != nil {
+				return fmt.Errorf("invalid attrs payload: %w", err)
+			}
+		}
+	case PayloadClass:
+		if len(p.Add) == 0 && len(p.Remove) == 0 {
+			return fmt.Errorf("class payload needs classes to add or remove")
+		}
+		for _, c := range append(append([]string{}, p.Add...), p.Remove...) {
+			if c == "" || strings.ContainsAny(c, " \t\n\r\f") {
+				return fmt.Errorf("invalid class name %q", c)
+			}
+		}
+	case PayloadMulti:
+		if len(p.Changes) == 0 {
+			return fmt.Errorf("multi payload needs at least one element change")
+		}
+		for i := range p.Changes {
+			c := &p.Changes[i]
+			if strings.TrimSpace(c.Selector) == "" {
+				return fmt.Errorf("change %d needs a CSS selector", i)
+			}
+			if c.Type == PayloadMulti {
+				return fmt.Errorf("change %d: multi payloads can't be nested", i)
+			}
+			if err := c.VariantPayload.Validate(); err != nil {
+				return fmt.Errorf("change %d (%s): %w", i, c.Selector, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown payload type %q", p.Type)
+	}
+	return nil
+}
+
+// Name returns the variant name shown in results
+func (p VariantPayload) Name() string {
+	if p.Label != "" {
+		return p.Label
+	}
+	switch p.Type {
+	case PayloadHTML:
+		return html.UnescapeString(tagPattern.ReplaceAllString(p.HTML, ""))
+	case PayloadAttrs:
+		names := make([]string, 0, len(p.Attrs))
+		for name := range p.Attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = name + "=" + p.Attrs[name]
+		}
+		return strings.Join(parts, ", ")
+	case PayloadClass:
+		var parts []string
+		for _, c := range p.Add {
+			parts = append(parts, "+"+c)
+		}
+		for _, c := range p.Remove {
+			parts = append(parts, "-"+c)
+		}
+		return strings.Join(parts, " ")
+	case PayloadMulti:
+		parts := make([]string, len(p.Changes))
+		for i, c := range p.Changes {
+			parts[i] = c.VariantPayload.Name()
+		}
+		return strings.Join(parts, " / ")
+	default:
+		return p.Text
+	}
+}
+
+// VariantPayloads returns the test's variants as payloads, with plain
+// string variants as text payloads
+func (t *Test) VariantPayloads() []VariantPayload {
+	if t.Payloads != nil {
+		return t.Payloads
+	}
+	payloads := make([]VariantPayload, len(t.Variants))
+	for i, v := range t.Variants {
+		payloads[i] = VariantPayload{Type: PayloadText, Text: v}
+	}
+	return payloads
+}
+
+// SetTestPayloads replaces a test's variants with typed payloads. The
+// number of variants can't change, since results are kept by index.
+func (s *SQLiteStore) SetTestPayloads(ctx context.Context, name string, payloads []VariantPayload) error {
+	var current string
+	err := s.db.QueryRowContext(ctx, `SELECT variants FROM tests WHERE name = ?`, name).Scan(&current)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get test: %w", err)
+	}
+	names, _, err := decodeVariants([]byte(current))
+	if err != nil {
+		return err
+	}
+	if len(payloads) != len(names) {
+		return fmt.Errorf("test has %d variants, got %d payloads", len(names), len(payloads))
+	}
+
+	for i := range payloads {
+		if err := payloads[i].Validate(); err != nil {
+			return fmt.Errorf("variant %d: %w", i, err)
+		}
+	}
+	variantsJSON, err := encodeVariants(payloads)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE tests SET variants = ?, updated_at = ? WHERE name = ?`,
+		string(variantsJSON), time.Now().Unix(), name)
+	if err != nil {
+		return fmt.Errorf("failed to set payloads: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// encodeVariants stores unlabelled text payloads as plain strings and the
+// rest as objects
+func encodeVariants(payloads []VariantPayload) ([]byte, error) {
+	variants := make([]interface{}, len(payloads))
+	for i, p := range payloads {
+		if p.Type == PayloadText && p.Label == "" {
+			variants[i] = p.Text
+		} else {
+			variants[i] = p
+		}
+	}
+	data, err := json.Marshal(variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal variants: %w", err)
+	}
+	return data, nil
+}
+
+// decodeVariants reads the variants JSON into variant names and, if any
+// variant is typed, payloads for all of them
+func decodeVariants(data []byte) ([]string, []VariantPayload, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal variants: %w", err)
+	}
+
+	names := make([]string, len(raw))
+	payloads := make([]VariantPayload, len(raw))
+	typed := false
+	for i, r := range raw {
+		if bytes.HasPrefix(bytes.TrimSpace(r), []byte(`"`)) {
+			payloads[i].Type = PayloadText
+			if err := json.Unmarshal(r, &payloads[i].Text); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal variants: %w", err)
+			}
+		} else {
+			if err := json.Unmarshal(r, &payloads[i]); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal variants: %w", err)
+			}
+			typed = true
+		}
+		names[i] = payloads[i].Name()
+	}
+
+	if !typed {
+		return names, nil, nil
+	}
+	return names, payloads, nil
+}
+
+// checkAttr rejects event handlers, inline documents and script URLs
+func checkAttr(name, value string) error {
+	if !attrNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid attribute name %q", name)
+	}
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, "on") || lower == "srcdoc" {
+		return fmt.Errorf("attribute %q is not allowed", name)
+	}
+	if !urlAttrs[lower] {
+		return nil
+	}
+
+	urls := []string{value}
+	switch lower {
+	case "srcset":
+		urls = nil
+		for _, candidate := range strings.Split(value, ",") {
+			if fields := strings.Fields(candidate); len(fields) > 0 {
+				urls = append(urls, fields[0])
+			}
+		}
+	case "ping":
+		urls = strings.Fields(value)
+	}
+	for _, u := range urls {
+		if !safeURL(u, imageAttrs[lower]) {
+			return fmt.Errorf("unsafe URL %q in %s", u, name)
+		}
+	}
+	return nil
+}
+
+// safeURL allows relative URLs and http, https, mailto and tel ones.
+// Images may also use data:image URLs.
+func safeURL(u string, image bool) bool {
+	u = strings.ToLower(strings.TrimSpace(u))
+	colon := strings.Index(u, ":")
+	if colon < 0 || strings.ContainsAny(u[:colon], "/?#") {
+		return true
+	}
+	switch u[:colon] {
+	case "http", "https", "mailto", "tel":
+		return true
+	case "data":
+		return image && strings.HasPrefix(u, "data:image/")
+	}
+	return false
+}
+
+// sanitizeHTML checks that s only uses allowed inline markup and returns
+// it re-serialized, with attributes quoted and text escaped
+func sanitizeHTML(s string) (string, error) {
+	var out strings.Builder
+	var open []string
+
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt != 0 {
+			text := s
+			if lt > 0 {
+				text = s[:lt]
+			}
+			out.WriteString(html.EscapeString(html.UnescapeString(text)))
+			s = s[len(text):]
+			continue
+		}
+
+		gt := tagEnd(s)
+		if gt < 0 {
+			return "", fmt.Errorf("unterminated tag")
+		}
+		tag := s[1:gt]
+		s = s[gt+1:]
+
+		if strings.HasPrefix(tag, "/") {
+			name := strings.ToLower(strings.TrimSpace(tag[1:]))
+			if len(open) == 0 || open[len(open)-1] != name {
+				return "", fmt.Errorf("unexpected </%s>", name)
+			}
+			open = open[:len(open)-1]
+			out.WriteString("</" + name + ">")
+			continue
+		}
+		if strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "?") {
+			return "", fmt.Errorf("comments and declarations are not allowed")
+		}
+
+		tag = strings.TrimSuffix(tag, "/")
+		name, attrs, err := parseTag(tag)
+		if err != nil {
+			return "", err
+		}
+		if !allowedTags[name] {
+			return "", fmt.Errorf("<%s> is not allowed", name)
+		}
+
+		if name == "a" {
+			attrs = withNoopener(attrs)
+		}
+
+		out.WriteString("<" + name)
+		for _, a := range attrs {
+			if !allowedAttr["*"][a[0]] && !allowedAttr[name][a[0]] {
+				return "", fmt.Errorf("attribute %q is not allowed on <%s>", a[0], name)
+			}
+			if urlAttrs[a[0]] && !safeURL(a[1], false) {
+				return "", fmt.Errorf("unsafe URL %q in %s", a[1], a[0])
+			}
+			out.WriteString(" " + a[0] + `="` + html.EscapeString(a[1]) + `"`)
+		}
+		out.WriteString(">")
+		if !voidTags[name] {
+			open = append(open, name)
+		}
+	}
+
+	if len(open) > 0 {
+		return "", fmt.Errorf("unclosed <%s>", open[len(open)-1])
+	}
+	return out.String(), nil
+}
+
+// withNoopener adds noopener to the rel of a link that opens in another
+// window, so the opened page can't navigate this one
+func withNoopener(attrs [][2]string) [][2]string {
+	target, rel := false, -1
+	for i, a := range attrs {
+		switch a[0] {
+		case "target":
+			target = true
+		case "rel":
+			rel = i
+		}
+	}
+	if !target {
+		return attrs
+	}
+	if rel < 0 {
+		return append(attrs, [2]string{"rel", "noopener"})
+	}
+	for _, v := range strings.Fields(strings.ToLower(attrs[rel][1])) {
+		if v == "noopener" || v == "noreferrer" {
+			return attrs
+		}
+	}
+	attrs[rel][1] = strings.TrimSpace(attrs[rel][1] + " noopener")
+	return attrs
+}
+
+// tagEnd returns the index of the '>' closing the tag s starts with,
+// skipping quoted attribute values, or -1
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseTag splits the inside of a start tag into its lowercased name and
+// attribute name/value pairs, with values unescaped
+func parseTag(tag string) (string, [][2]string, error) {
+	end := strings.IndexAny(tag, " \t\n\r\f")
+	if end < 0 {
+		end = len(tag)
+	}
+	name := strings.ToLower(tag[:end])
+	if name == "" {
+		return "", nil, fmt.Errorf("empty tag")
+	}
+
+	var attrs [][2]string
+	rest := tag[end:]
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f")
+		if rest == "" {
+			return name, attrs, nil
+		}
+
+		n := strings.IndexAny(rest, "= \t\n\r\f")
+		if n < 0 {
+			n = len(rest)
+		}
+		attr := strings.ToLower(rest[:n])
+		if !attrNamePattern.MatchString(attr) {
+			return "", nil, fmt.Errorf("invalid attribute in <%s>", name)
+		}
+		rest = strings.TrimLeft(rest[n:], " \t\n\r\f")
+
+		value := ""
+		if strings.HasPrefix(rest, "=") {
+			rest = strings.TrimLeft(rest[1:], " \t\n\r\f")
+			if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+				close := strings.IndexByte(rest[1:], rest[0])
+				if close < 0 {
+					return "", nil, fmt.Errorf("unterminated attribute value in <%s>", name)
+				}
+				value = rest[1 : close+1]
+				rest = rest[close+2:]
+			} else {
+				n = strings.IndexAny(rest, " \t\n\r\f")
+				if n < 0 {
+					n = len(rest)
+				}
+				value = rest[:n]
+				rest = rest[n:]
+			}
+		}
+		attrs = append(attrs, [2]string{attr, html.UnescapeString(value)})
+	}
+}
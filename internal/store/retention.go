@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// GetRetentionDays returns the global number of days of raw events to keep
+// (0 keeps them forever)
+func (s *SQLiteStore) GetRetentionDays(ctx context.Context) (int, error) {
+	value, err := s.GetSetting(ctx, SettingRetentionDays)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention days %q: %w", value, err)
+	}
+	return days, nil
+}
+
+// SetRetentionDays sets the global number of days of raw events to keep
+// (0 keeps them forever)
+func (s *SQLiteStore) SetRetentionDays(ctx context.Context, days int) error {
+	if days < 0 {
+		return fmt.Errorf("retention days must not be negative, got %d", days)
+	}
+	return s.SetSetting(ctx, SettingRetentionDays, strconv.Itoa(days))
+}
+
+// SetTestRetentionDays overrides the global retention for a test. nil
+// reverts to the global setting; 0 keeps the test's raw events forever.
+func (s *SQLiteStore) SetTestRetentionDays(ctx context.Context, name string, days *int) error {
+	var value sql.NullInt64
+	if days != nil {
+		if *days < 0 {
+			return fmt.Errorf("retention days must not be negative, got %d", *days)
+		}
+		value = sql.NullInt64{Int64: int64(*days), Valid: true}
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE tests SET retention_days = ?, updated_at = ? WHERE name = ?`,
+		value, time.Now().Unix(), name)
+	if err != nil {
+		return fmt.Errorf("failed to set retention: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ApplyRetention rolls up raw events older than each test's retention
+// period. Results already count them in variant_daily, so rolling up only
+// records which visitors were seen (to keep deduplicating them) and deletes
+// the raw rows. Cutoffs fall on UTC midnight so whole days are rolled up.
+// With dryRun nothing is changed and the results preview what would be.
+func (s *SQLiteStore) ApplyRetention(ctx context.Context, now time.Time, dryRun bool) ([]RetentionResult, error) {
+	global, err := s.GetRetentionDays(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tests, err := s.ListTests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	var results []RetentionResult
+	for _, t := range tests {
+		days := global
+		if t.RetentionDays != nil {
+			days = *t.RetentionDays
+		}
+		if days <= 0 {
+			continue
+		}
+
+		result := RetentionResult{
+			TestName: t.Name,
+			Days:     days,
+			Cutoff:   today.AddDate(0, 0, -days),
+		}
+		if dryRun {
+			err = s.db.QueryRowContext(ctx,
+				`SELECT COUNT(*) FROM events WHERE test_name = ? AND created_at < ?`,
+				t.Name, result.Cutoff.Unix()).Scan(&result.Events)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count events: %w", err)
+			}
+		} else {
+			result.Events, err = s.compact(ctx, t, result.Cutoff)
+			if err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// compact deletes a test's raw events and conversion events before cutoff,
+// remembering the visitors they belonged to. variant_daily already holds
+// the attribution of those conversions; the counted conversion events are
+// kept so RebuildAggregates can restore visitor_conversions.
+func (s *SQLiteStore) compact(ctx context.Context, t *Test, cutoff time.Time) (int, error) {
+	window, err := s.GetAttributionWindow(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO compacted_visitors (test_name, visitor_id, variant, viewed_at, converted)
+		SELECT test_name, visitor_id,
+		       MAX(CASE WHEN event_type = 'view' THEN variant END),
+		       MAX(CASE WHEN event_type = 'view' THEN created_at END),
+		       MAX(event_type = 'convert')
+		FROM events
+		WHERE test_name = ? AND created_at < ?
+		GROUP BY visitor_id
+		ON CONFLICT (test_name, visitor_id) DO UPDATE SET
+			variant = COALESCE(compacted_visitors.variant, excluded.variant),
+			viewed_at = COALESCE(compacted_visitors.viewed_at, excluded.viewed_at),
+			converted = MAX(compacted_visitors.converted, excluded.converted)`,
+		t.Name, cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to record compacted visitors: %w", err)
+	}
+
+	// Keep the number of counted conversion events of each visitor
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO compacted_visitors (test_name, visitor_id, conversion_events)
+		SELECT c.test_name, c.visitor_id, COUNT(*)
+		FROM conversion_events c
+		LEFT JOIN events v ON v.test_name = c.test_name AND v.visitor_id = c.visitor_id
+		                    AND v.event_type = 'view'
+		LEFT JOIN compacted_visitors cv ON cv.test_name = c.test_name AND cv.visitor_id = c.visitor_id
+		WHERE c.test_name = ? AND c.created_at < ?
+		  AND `+attributionStatus("c.variant", "COALESCE(v.variant, cv.variant)",
+		"COALESCE(v.created_at, cv.viewed_at)", "c.created_at", int64(window.Seconds()))+` = 'attributed'
+		GROUP BY c.test_name, c.visitor_id
+		ON CONFLICT (test_name, visitor_id) DO UPDATE SET
+			conversion_events = compacted_visitors.conversion_events + excluded.conversion_events`,
+		t.Name, cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to record compacted conversion events: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM conversion_events WHERE test_name = ? AND created_at < ?`, t.Name, cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete conversion events: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM events WHERE test_name = ? AND created_at < ?`, t.Name, cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete events: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if cutoff.After(t.CompactedBefore) {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE tests SET compacted_before = ? WHERE name = ?`, cutoff.Unix(), t.Name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update test: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit retention: %w", err)
+	}
+	return int(deleted), nil
+}
+
+// GetRollups returns the daily counts of a test for days whose raw events
+// have been removed by retention, oldest first
+func (s *SQLiteStore) GetRollups(ctx context.Context, testName string) ([]DailyStats, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.day, d.variant, d.views, d.conversions, d.value
+		FROM variant_daily d
+		JOIN tests t ON t.name = d.test_name
+		WHERE d.test_name = ? AND d.day < date(t.compacted_before, 'unixepoch')
+		ORDER BY d.day, d.variant`, testName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rollups: %w", err)
+	}
+	defer rows.Close()
+
+	var rollups []DailyStats
+	for rows.Next() {
+		var d DailyStats
+		var day string
+		if err := rows.Scan(&day, &d.Variant, &d.Views, &d.Conversions, &d.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup: %w", err)
+		}
+		if d.Day, err = time.Parse("2006-01-02", day); err != nil {
+			return nil, fmt.Errorf("invalid rollup day %q: %w", day, err)
+		}
+		rollups = append(rollups, d)
+	}
+	return rollups, rows.Err()
+}
+
+// Vacuum returns free pages to the filesystem. A full vacuum rewrites the
+// whole database (and enables incremental vacuum on older databases); the
+// incremental one only releases pages freed since the last run.
+func (s *SQLiteStore) Vacuum(ctx context.Context, full bool) error {
+	stmt := "PRAGMA incremental_vacuum"
+	if full {
+		stmt = "VACUUM"
+	}
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to vacuum: %w", err)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +15,33 @@ import (
 
 var ErrNotFound = errors.New("not found")
 
+// Setting keys used by the store
+const (
+	SettingHoldoutPercent = "holdout_percent"
+	SettingIPDenylist     = "ip_denylist"
+	SettingOrigins        = "allowed_origins"
+	SettingBeaconSigning  = "beacon_signing"
+	SettingBeaconSecret   = "beacon_secret"
+	SettingAPIKeys        = "api_keys"
+	SettingRetentionDays  = "retention_days"
+
+	// SettingAttributionWindow is the longest time in seconds between a
+	// view and a conversion it is credited to; 0 or unset means no limit
+	SettingAttributionWindow = "attribution_window"
+
+	// settingAggregatesVersion records the aggregatesVersion variant_daily
+	// was last rebuilt for
+	settingAggregatesVersion = "aggregates_version"
+
+	// aggregatesVersion changes whenever aggregateTriggers count differently,
+	// so existing databases get the new triggers and a rebuild on open
+	aggregatesVersion = "2"
+
+	// settingConversionEventsVersion records that conversion_events has
+	// been backfilled from existing conversions
+	settingConversionEventsVersion = "conversion_events_version"
+)
+
 type SQLiteStore struct {
 	db *sql.DB
 }
@@ -49,18 +77,176 @@ CREATE INDEX IF NOT EXISTS idx_events_test_event ON events(test_name, event_type
 CREATE INDEX IF NOT EXISTS idx_events_visitor ON events(test_name, visitor_id, event_type);
 CREATE UNIQUE INDEX IF NOT EXISTS idx_events_dedup ON events(test_name, visitor_id, event_type);
 
+-- Every conversion, including repeats by the same visitor that the unique
+-- index on events drops. Repeat-counting tests read their results from here.
+CREATE TABLE IF NOT EXISTS conversion_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    test_name TEXT NOT NULL,
+    variant INTEGER NOT NULL,
+    visitor_id TEXT NOT NULL,
+    value REAL,
+    idempotency_key TEXT,
+    created_at INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversion_events_visitor ON conversion_events(test_name, visitor_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversion_events_idempotency
+    ON conversion_events(test_name, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
 CREATE TABLE IF NOT EXISTS settings (
     key TEXT PRIMARY KEY,
     value TEXT NOT NULL
 );
+
+CREATE TABLE IF NOT EXISTS identities (
+    visitor_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX IF NOT EXISTS idx_identities_user ON identities(user_id);
+
+-- Visitors whose raw events were removed by retention. Keeps events
+-- deduplicated and conversions credited to the viewed variant after the
+-- raw rows are gone. variant is NULL if the visitor never sent a view;
+-- viewed_at (added by a migration) is when it did.
+CREATE TABLE IF NOT EXISTS compacted_visitors (
+    test_name TEXT NOT NULL,
+    visitor_id TEXT NOT NULL,
+    variant INTEGER,
+    converted INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (test_name, visitor_id)
+) WITHOUT ROWID;
+
+CREATE TRIGGER IF NOT EXISTS events_compacted_dedup BEFORE INSERT ON events
+WHEN EXISTS (SELECT 1 FROM compacted_visitors
+             WHERE test_name = NEW.test_name AND visitor_id = NEW.visitor_id
+               AND ((NEW.event_type = 'view' AND variant IS NOT NULL)
+                 OR (NEW.event_type = 'convert' AND converted = 1)))
+BEGIN
+    SELECT RAISE(IGNORE);
+END;
+
+-- Per-visitor counts by test, variant and day, maintained by the triggers
+-- in aggregateTriggers so results don't scan events. A visitor counts
+-- towards the variant of its view. Conversions that follow the attribution
+-- rules count towards the viewed variant; the rest count as unattributed
+-- or mismatched on the variant they claimed.
+CREATE TABLE IF NOT EXISTS variant_daily (
+    test_name TEXT NOT NULL,
+    variant INTEGER NOT NULL,
+    day TEXT NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    conversions INTEGER NOT NULL DEFAULT 0,
+    value REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (test_name, variant, day)
+);
+
+-- Attributed conversion events of each visitor, repeats included, credited
+-- to the variant of its view. Maintained by the triggers so results of
+-- repeat-counting tests don't scan conversion_events.
+CREATE TABLE IF NOT EXISTS visitor_conversions (
+    test_name TEXT NOT NULL,
+    visitor_id TEXT NOT NULL,
+    variant INTEGER NOT NULL,
+    events INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (test_name, visitor_id)
+) WITHOUT ROWID;
+`
+
+// aggregateTriggers keep variant_daily and visitor_conversions up to date
+// as events arrive. They are recreated whenever aggregatesVersion changes.
+var aggregateTriggers = `
+CREATE TRIGGER IF NOT EXISTS events_aggregate_view AFTER INSERT ON events
+WHEN NEW.event_type = 'view'
+BEGIN
+    INSERT INTO variant_daily (test_name, variant, day, views)
+    VALUES (NEW.test_name, NEW.variant, date(NEW.created_at, 'unixepoch'), 1)
+    ON CONFLICT (test_name, variant, day) DO UPDATE SET views = views + 1;
+
+    -- A conversion sent before the view counted as unattributed; count it
+    -- again now that the viewed variant is known
+    UPDATE variant_daily SET unattributed = unattributed - 1
+    FROM (SELECT variant AS cvariant, created_at AS cat
+          FROM events
+          WHERE test_name = NEW.test_name AND visitor_id = NEW.visitor_id
+            AND event_type = 'convert') AS c
+    WHERE variant_daily.test_name = NEW.test_name AND variant_daily.variant = c.cvariant
+      AND variant_daily.day = date(c.cat, 'unixepoch');
+
+    INSERT INTO variant_daily (test_name, variant, day, conversions, value, unattributed, mismatched)
+    SELECT NEW.test_name, CASE WHEN status = 'attributed' THEN NEW.variant ELSE variant END,
+           day, status = 'attributed', CASE WHEN status = 'attributed' THEN value ELSE 0 END,
+           status = 'unattributed', status = 'mismatched'
+    FROM (SELECT variant, date(created_at, 'unixepoch') AS day, COALESCE(value, 0) AS value,
+                 ` + attributionCase("variant", "NEW.variant", "NEW.created_at", "created_at", windowSetting) + ` AS status
+          FROM events
+          WHERE test_name = NEW.test_name AND visitor_id = NEW.visitor_id
+            AND event_type = 'convert')
+    WHERE 1
+    ON CONFLICT (test_name, variant, day) DO UPDATE SET
+        conversions = conversions + excluded.conversions, value = value + excluded.value,
+        unattributed = unattributed + excluded.unattributed, mismatched = mismatched + excluded.mismatched;
+
+    INSERT INTO visitor_conversions (test_name, visitor_id, variant, events)
+    SELECT NEW.test_name, NEW.visitor_id, NEW.variant, COUNT(*)
+    FROM conversion_events
+    WHERE test_name = NEW.test_name AND visitor_id = NEW.visitor_id
+      AND ` + attributionCase("variant", "NEW.variant", "NEW.created_at", "created_at", windowSetting) + ` = 'attributed'
+    HAVING COUNT(*) > 0
+    ON CONFLICT (test_name, visitor_id) DO UPDATE SET events = events + excluded.events;
+END;
+
+CREATE TRIGGER IF NOT EXISTS events_aggregate_convert AFTER INSERT ON events
+WHEN NEW.event_type = 'convert'
+BEGIN
+    INSERT INTO variant_daily (test_name, variant, day, conversions, value, unattributed, mismatched)
+    SELECT NEW.test_name, CASE WHEN status = 'attributed' THEN credited ELSE NEW.variant END,
+           date(NEW.created_at, 'unixepoch'), status = 'attributed',
+           CASE WHEN status = 'attributed' THEN COALESCE(NEW.value, 0) ELSE 0 END,
+           status = 'unattributed', status = 'mismatched'
+    FROM (SELECT COALESCE(v.variant, cv.variant) AS credited,
+                 ` + attributionCase("NEW.variant", "COALESCE(v.variant, cv.variant)",
+	"COALESCE(v.created_at, cv.viewed_at)", "NEW.created_at", windowSetting) + ` AS status
+          FROM (SELECT 1)
+          LEFT JOIN events v ON v.test_name = NEW.test_name AND v.visitor_id = NEW.visitor_id
+                              AND v.event_type = 'view'
+          LEFT JOIN compacted_visitors cv ON cv.test_name = NEW.test_name AND cv.visitor_id = NEW.visitor_id)
+    WHERE 1
+    ON CONFLICT (test_name, variant, day) DO UPDATE SET
+        conversions = conversions + excluded.conversions, value = value + excluded.value,
+        unattributed = unattributed + excluded.unattributed, mismatched = mismatched + excluded.mismatched;
+END;
+
+CREATE TRIGGER IF NOT EXISTS conversion_events_aggregate AFTER INSERT ON conversion_events
+BEGIN
+    INSERT INTO visitor_conversions (test_name, visitor_id, variant, events)
+    SELECT NEW.test_name, NEW.visitor_id, COALESCE(v.variant, cv.variant), 1
+    FROM (SELECT 1)
+    LEFT JOIN events v ON v.test_name = NEW.test_name AND v.visitor_id = NEW.visitor_id
+                        AND v.event_type = 'view'
+    LEFT JOIN compacted_visitors cv ON cv.test_name = NEW.test_name AND cv.visitor_id = NEW.visitor_id
+    WHERE ` + attributionCase("NEW.variant", "COALESCE(v.variant, cv.variant)",
+	"COALESCE(v.created_at, cv.viewed_at)", "NEW.created_at", windowSetting) + ` = 'attributed'
+    ON CONFLICT (test_name, visitor_id) DO UPDATE SET events = events + 1;
+END;
 `
 
+// testColumns is the column list scanned by scanTest.
+const testColumns = `id, name, variants, weights, conversion_goal, state, winner_variant,
+	source, has_source_conflict, url, conversion_url, target, cta_target,
+	layer, origins, retention_days, compacted_before, count_mode, count_cap, engagement, created_at, updated_at`
+
 func Open(dbPath string) (*SQLiteStore, error) {
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// Let retention hand freed pages back to the filesystem. Only takes
+	// effect on new databases; existing ones switch on the next VACUUM.
+	db.Exec("PRAGMA auto_vacuum = INCREMENTAL")
+
 	// Enable WAL mode
 	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		db.Close()
@@ -81,6 +267,19 @@ func Open(dbPath string) (*SQLiteStore, error) {
 		"ALTER TABLE tests ADD COLUMN conversion_url TEXT",
 		"ALTER TABLE tests ADD COLUMN target TEXT",
 		"ALTER TABLE tests ADD COLUMN cta_target TEXT",
+		"ALTER TABLE tests ADD COLUMN layer TEXT",
+		"ALTER TABLE tests ADD COLUMN origins TEXT",
+		"ALTER TABLE events ADD COLUMN value REAL",
+		"ALTER TABLE events ADD COLUMN idempotency_key TEXT",
+		"ALTER TABLE tests ADD COLUMN retention_days INTEGER",
+		"ALTER TABLE tests ADD COLUMN compacted_before INTEGER",
+		"ALTER TABLE compacted_visitors ADD COLUMN viewed_at INTEGER",
+		"ALTER TABLE variant_daily ADD COLUMN unattributed INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE variant_daily ADD COLUMN mismatched INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tests ADD COLUMN count_mode TEXT",
+		"ALTER TABLE tests ADD COLUMN count_cap INTEGER",
+		"ALTER TABLE tests ADD COLUMN engagement TEXT",
+		"ALTER TABLE compacted_visitors ADD COLUMN conversion_events INTEGER NOT NULL DEFAULT 0",
 	}
 	for _, m := range migrations {
 		db.Exec(m) // Ignore errors - column may already exist
@@ -88,11 +287,58 @@ func Open(dbPath string) (*SQLiteStore, error) {
 
 	// Add index for URL lookups
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_tests_url ON tests(url)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_tests_layer ON tests(layer)")
+	db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_events_idempotency
+	         ON events(test_name, idempotency_key) WHERE idempotency_key IS NOT NULL`)
+
+	s := &SQLiteStore{db: db}
+
+	// Databases created before the current aggregates get new triggers and
+	// a one-time rebuild, once conversion_events is backfilled
+	version, err := s.GetSetting(context.Background(), settingAggregatesVersion)
+	if err != nil && err != ErrNotFound {
+		db.Close()
+		return nil, err
+	}
+	if version != aggregatesVersion {
+		for _, trigger := range []string{"events_aggregate_view", "events_aggregate_convert", "conversion_events_aggregate"} {
+			db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+		}
+	}
+	if _, err := db.Exec(aggregateTriggers); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create aggregate triggers: %w", err)
+	}
+
+	// Conversions recorded before conversion_events existed
+	if _, err := s.GetSetting(context.Background(), settingConversionEventsVersion); err == ErrNotFound {
+		_, err := db.Exec(`
+			INSERT INTO conversion_events (test_name, variant, visitor_id, value, idempotency_key, created_at)
+			SELECT test_name, variant, visitor_id, value, idempotency_key, created_at
+			FROM events WHERE event_type = 'convert'`)
+		if err == nil {
+			err = s.SetSetting(context.Background(), settingConversionEventsVersion, "1")
+		}
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to backfill conversion events: %w", err)
+		}
+	}
+
+	if version != aggregatesVersion {
+		if err := s.RebuildAggregates(context.Background(), ""); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
-	return &SQLiteStore{db: db}, nil
+	return s, nil
 }
 
+// Close checkpoints the write-ahead log into the main database file and
+// closes the connection
 func (s *SQLiteStore) Close() error {
+	s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)") // Best effort; Close checkpoints too
 	return s.db.Close()
 }
 
@@ -144,9 +390,7 @@ func (s *SQLiteStore) createTestWithSource(ctx context.Context, name string, var
 
 func (s *SQLiteStore) GetTest(ctx context.Context, name string) (*Test, error) {
 	row := s.db.QueryRowContext(ctx,
-		`SELECT id, name, variants, weights, conversion_goal, state, winner_variant,
-		        source, has_source_conflict, url, conversion_url, target, cta_target,
-		        created_at, updated_at
+		`SELECT `+testColumns+`
 		 FROM tests WHERE name = ?`, name,
 	)
 
@@ -163,9 +407,7 @@ func (s *SQLiteStore) GetTest(ctx context.Context, name string) (*Test, error) {
 
 func (s *SQLiteStore) ListTests(ctx context.Context) ([]*Test, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, name, variants, weights, conversion_goal, state, winner_variant,
-		        source, has_source_conflict, url, conversion_url, target, cta_target,
-		        created_at, updated_at
+		`SELECT `+testColumns+`
 		 FROM tests ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -225,6 +467,22 @@ func (s *SQLiteStore) DeleteTest(ctx context.Context, name string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete events: %w", err)
 	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM variant_daily WHERE test_name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete aggregates: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM visitor_conversions WHERE test_name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete aggregates: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM compacted_visitors WHERE test_name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete compacted visitors: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM conversion_events WHERE test_name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversion events: %w", err)
+	}
 
 	result, err := s.db.ExecContext(ctx, `DELETE FROM tests WHERE name = ?`, name)
 	if err != nil {
@@ -244,52 +502,500 @@ func (s *SQLiteStore) DeleteTest(ctx context.Context, name string) error {
 }
 
 func (s *SQLiteStore) RecordEvent(ctx context.Context, testName string, variant int, eventType string, visitorID string) error {
-	now := time.Now().Unix()
+	return s.RecordEvents(ctx, []Event{{TestName: testName, Variant: variant, EventType: eventType, VisitorID: visitorID}})
+}
 
-	// Use INSERT OR IGNORE for deduplication via unique index
-	_, err := s.db.ExecContext(ctx,
-		`INSERT OR IGNORE INTO events (test_name, variant, event_type, visitor_id, created_at)
-		 VALUES (?, ?, ?, ?, ?)`,
-		testName, variant, eventType, visitorID, now,
+// RecordEvents records a batch of events in a single transaction, with the
+// same deduplication as RecordEvent. Events keep their CreatedAt time, or
+// now if it is zero. Conversions are also kept in conversion_events,
+// repeats included, except ones whose idempotency key was already used for
+// the test, so a batch that is sent again doesn't count twice.
+func (s *SQLiteStore) RecordEvents(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT OR IGNORE INTO events (test_name, variant, event_type, visitor_id, idempotency_key, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	convStmt, err := tx.PrepareContext(ctx,
+		`INSERT OR IGNORE INTO conversion_events (test_name, variant, visitor_id, idempotency_key, created_at)
+		 VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer convStmt.Close()
+
+	now := time.Now()
+	for _, e := range events {
+		createdAt := e.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		var idemKey sql.NullString
+		if e.IdempotencyKey != "" {
+			idemKey = sql.NullString{String: e.IdempotencyKey, Valid: true}
+		}
+		if e.EventType == "convert" {
+			res, err := convStmt.ExecContext(ctx, e.TestName, e.Variant, e.VisitorID, idemKey, createdAt.Unix())
+			if err != nil {
+				return fmt.Errorf("failed to record conversion event: %w", err)
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return fmt.Errorf("failed to record conversion event: %w", err)
+			} else if n == 0 {
+				continue // Already recorded under this key
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, e.TestName, e.Variant, e.EventType, e.VisitorID, idemKey, createdAt.Unix()); err != nil {
+			return fmt.Errorf("failed to record event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit events: %w", err)
+	}
+	return nil
+}
+
+// RecordConversion records a server-side conversion. It returns false
+// without error if the idempotency key was already used for the test. A
+// repeat conversion by a visitor is recorded in conversion_events only, so
+// unique conversion counts are unchanged.
+func (s *SQLiteStore) RecordConversion(ctx context.Context, c Conversion) (bool, error) {
+	createdAt := c.Timestamp
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	var idemKey sql.NullString
+	if c.IdempotencyKey != "" {
+		idemKey = sql.NullString{String: c.IdempotencyKey, Valid: true}
+	}
+	var value sql.NullFloat64
+	if c.Value != 0 {
+		value = sql.NullFloat64{Float64: c.Value, Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT OR IGNORE INTO conversion_events (test_name, variant, visitor_id, value, idempotency_key, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		c.TestName, c.Variant, c.VisitorID, value, idemKey, createdAt.Unix(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record conversion: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record conversion: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT OR IGNORE INTO events (test_name, variant, event_type, visitor_id, value, idempotency_key, created_at)
+		 VALUES (?, ?, 'convert', ?, ?, ?, ?)`,
+		c.TestName, c.Variant, c.VisitorID, value, idemKey, createdAt.Unix(),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to record event: %w", err)
+		return false, fmt.Errorf("failed to record conversion: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit conversion: %w", err)
+	}
+	return true, nil
+}
+
+// GetVisitorVariant returns the variant a visitor was first shown in a test
+func (s *SQLiteStore) GetVisitorVariant(ctx context.Context, testName, visitorID string) (int, error) {
+	var variant int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT variant FROM (
+			SELECT variant, created_at, id FROM events
+			WHERE test_name = ? AND visitor_id = ? AND event_type = 'view'
+			UNION ALL
+			SELECT variant, 0, 0 FROM compacted_visitors
+			WHERE test_name = ? AND visitor_id = ? AND variant IS NOT NULL
+		 ) ORDER BY created_at, id LIMIT 1`,
+		testName, visitorID, testName, visitorID).Scan(&variant)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get visitor variant: %w", err)
+	}
+	return variant, nil
+}
+
+// LinkIdentity maps a visitor ID to an application user ID. The first link
+// wins: /identify is unauthenticated, so re-linking a visitor to another
+// user is ignored rather than letting anyone re-point it.
+func (s *SQLiteStore) LinkIdentity(ctx context.Context, visitorID, userID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO identities (visitor_id, user_id, created_at) VALUES (?, ?, ?)
+		 ON CONFLICT(visitor_id) DO NOTHING`,
+		visitorID, userID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
 	return nil
 }
 
-func (s *SQLiteStore) GetVariantStats(ctx context.Context, testName string) ([]VariantStats, error) {
+// GetUserAssignments returns, for each running test, the variant a user
+// was first shown on any of their linked visitor IDs
+func (s *SQLiteStore) GetUserAssignments(ctx context.Context, userID string) (map[string]int, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT
-			variant,
-			COUNT(DISTINCT CASE WHEN event_type = 'view' THEN visitor_id END) as views,
-			COUNT(DISTINCT CASE WHEN event_type = 'convert' THEN visitor_id END) as conversions
-		FROM events
-		WHERE test_name = ?
-		GROUP BY variant
-		ORDER BY variant
-	`, testName)
+		SELECT test_name, variant FROM (
+			SELECT v.test_name, v.variant,
+			       ROW_NUMBER() OVER (PARTITION BY v.test_name ORDER BY v.created_at, v.id) AS rn
+			FROM (
+				SELECT test_name, visitor_id, variant, created_at, id
+				FROM events WHERE event_type = 'view'
+				UNION ALL
+				-- Views removed by retention predate every remaining one
+				SELECT test_name, visitor_id, variant, 0, 0
+				FROM compacted_visitors WHERE variant IS NOT NULL
+			) v
+			JOIN identities i ON i.visitor_id = v.visitor_id
+			JOIN tests t ON t.name = v.test_name
+			WHERE i.user_id = ? AND t.state = 'running'
+		) WHERE rn = 1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var variant int
+		if err := rows.Scan(&name, &variant); err != nil {
+			return nil, fmt.Errorf("failed to scan assignment: %w", err)
+		}
+		assignments[name] = variant
+	}
+	return assignments, rows.Err()
+}
+
+// GetVisitorIDs returns the visitor IDs linked to a user, oldest link first
+func (s *SQLiteStore) GetVisitorIDs(ctx context.Context, userID string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT visitor_id FROM identities WHERE user_id = ? ORDER BY created_at, rowid`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get visitor ids: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan visitor id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// variantStatsQuery reads variant_daily and corrects it for identity
+// stitching. Results are counted per resolved identity (the linked user ID,
+// else the visitor ID), and each identity is credited to the variant of its
+// first view, or of its first conversion if it never sent a view.
+// variant_daily counts visitors, so for users with more than one visitor
+// in a test their per-visitor counts are swapped for per-identity counts
+// computed from their raw events. Only users linked to several visitor IDs
+// are read from events; everyone else comes from variant_daily as is.
+//
+// A conversion only counts if the identity viewed the variant it converted
+// on at or before the conversion, and no more than window seconds before
+// when window > 0. variant_daily already applies these rules per visitor.
+// filter restricts the tests read and is used twice.
+func variantStatsQuery(filter string, window int64) string {
+	attribution := func(claimed, credited, viewedAt, convertedAt string) string {
+		return attributionStatus(claimed, credited, viewedAt, convertedAt, window)
+	}
+
+	return `
+		WITH multi AS (
+			SELECT user_id FROM identities GROUP BY user_id HAVING COUNT(*) > 1
+		),
+		linked AS (
+			SELECT t.name AS test_name, i.user_id, e.visitor_id
+			FROM multi m
+			JOIN identities i ON i.user_id = m.user_id
+			CROSS JOIN tests t
+			JOIN events e ON e.test_name = t.name AND e.visitor_id = i.visitor_id
+			WHERE 1 = 1 ` + strings.ReplaceAll(filter, "{col}", "t.name") + `
+			GROUP BY t.name, e.visitor_id
+		),
+		stitched AS (
+			SELECT l.test_name, l.user_id, l.visitor_id
+			FROM linked l
+			JOIN (SELECT test_name, user_id FROM linked
+			      GROUP BY test_name, user_id HAVING COUNT(*) > 1) m
+			  ON m.test_name = l.test_name AND m.user_id = l.user_id
+		),
+		ev AS (
+			SELECT st.user_id AS identity, e.test_name, e.visitor_id,
+			       e.id, e.variant, e.event_type, COALESCE(e.value, 0) AS value, e.created_at
+			FROM stitched st
+			JOIN events e ON e.test_name = st.test_name AND e.visitor_id = st.visitor_id
+		),
+		assigned AS (
+			SELECT test_name, identity, variant FROM (
+				SELECT test_name, identity, variant,
+				       ROW_NUMBER() OVER (PARTITION BY test_name, identity
+				                          ORDER BY event_type = 'convert', created_at, id) AS rn
+				FROM ev
+			) WHERE rn = 1
+		),
+		-- Conversions of stitched users: the first one per identity decides
+		-- whether the identity converted
+		stitched_conv AS (
+			SELECT a.test_name, a.variant AS credited, c.variant AS claimed, c.value,
+			       ` + attribution("c.variant", "a.variant", "(SELECT MIN(v.created_at) FROM ev v "+
+		"WHERE v.test_name = a.test_name AND v.identity = a.identity "+
+		"AND v.event_type = 'view' AND v.variant = a.variant)", "c.created_at") + ` AS status
+			FROM assigned a
+			JOIN (SELECT test_name, identity, variant, created_at,
+			             SUM(value) OVER (PARTITION BY test_name, identity) AS value,
+			             ROW_NUMBER() OVER (PARTITION BY test_name, identity ORDER BY created_at, id) AS rn
+			      FROM ev WHERE event_type = 'convert') c
+			  ON c.test_name = a.test_name AND c.identity = a.identity AND c.rn = 1
+		),
+		-- The same conversions as counted per visitor in variant_daily
+		visitor_conv AS (
+			SELECT c.test_name, c.variant AS claimed, COALESCE(v.variant, cv.variant) AS credited, c.value,
+			       ` + attribution("c.variant", "COALESCE(v.variant, cv.variant)",
+		"COALESCE(v.created_at, cv.viewed_at)", "c.created_at") + ` AS status
+			FROM ev c
+			LEFT JOIN ev v ON v.test_name = c.test_name AND v.visitor_id = c.visitor_id
+			                AND v.event_type = 'view'
+			LEFT JOIN compacted_visitors cv ON cv.test_name = c.test_name AND cv.visitor_id = c.visitor_id
+			WHERE c.event_type = 'convert'
+		),
+		parts (test_name, variant, views, conversions, value, unattributed, mismatched) AS (
+			SELECT test_name, variant, views, conversions, value, unattributed, mismatched
+			FROM variant_daily WHERE 1 = 1 ` + strings.ReplaceAll(filter, "{col}", "test_name") + `
+			UNION ALL
+			-- Stitched users, counted once each
+			SELECT a.test_name, a.variant,
+			       COUNT(DISTINCT CASE WHEN r.event_type = 'view' THEN r.identity END), 0, 0, 0, 0
+			FROM ev r
+			JOIN assigned a ON a.test_name = r.test_name AND a.identity = r.identity
+			GROUP BY a.test_name, a.variant
+			UNION ALL
+			SELECT test_name, credited, 0, COUNT(*), SUM(value), 0, 0
+			FROM stitched_conv WHERE status = 'attributed'
+			GROUP BY test_name, credited
+			UNION ALL
+			SELECT test_name, claimed, 0, 0, 0,
+			       SUM(status = 'unattributed'), SUM(status = 'mismatched')
+			FROM stitched_conv WHERE status != 'attributed'
+			GROUP BY test_name, claimed
+			UNION ALL
+			-- less their per-visitor counts in variant_daily
+			SELECT test_name, variant, -COUNT(*), 0, 0, 0, 0
+			FROM ev WHERE event_type = 'view'
+			GROUP BY test_name, variant
+			UNION ALL
+			SELECT test_name, credited, 0, -COUNT(*), -SUM(value), 0, 0
+			FROM visitor_conv WHERE status = 'attributed'
+			GROUP BY test_name, credited
+			UNION ALL
+			SELECT test_name, claimed, 0, 0, 0,
+			       -SUM(status = 'unattributed'), -SUM(status = 'mismatched')
+			FROM visitor_conv WHERE status != 'attributed'
+			GROUP BY test_name, claimed
+		)
+		SELECT test_name, variant, SUM(views), SUM(conversions), SUM(value),
+		       SUM(unattributed), SUM(mismatched)
+		FROM parts
+		GROUP BY test_name, variant
+		HAVING SUM(views) > 0 OR SUM(conversions) > 0 OR SUM(unattributed) > 0 OR SUM(mismatched) > 0
+		ORDER BY test_name, variant`
+}
+
+func (s *SQLiteStore) GetVariantStats(ctx context.Context, testName string) ([]VariantStats, error) {
+	window, err := s.GetAttributionWindow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.queryVariantStats(ctx, variantStatsQuery("AND {col} = ?", int64(window.Seconds())),
+		testName, testName)
+	if err != nil {
+		return nil, err
+	}
+	err = s.addEventStats(ctx, all, eventStatsQuery("AND {col} = ?", int64(window.Seconds())),
+		testName, testName, testName, testName, testName)
+	if err != nil {
+		return nil, err
+	}
+	return all[testName], nil
+}
+
+// GetAllVariantStats returns the variant stats of every test in one query,
+// keyed by test name. Tests without events are omitted.
+func (s *SQLiteStore) GetAllVariantStats(ctx context.Context) (map[string][]VariantStats, error) {
+	window, err := s.GetAttributionWindow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.queryVariantStats(ctx, variantStatsQuery("", int64(window.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.addEventStats(ctx, all, eventStatsQuery("", int64(window.Seconds()))); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+func (s *SQLiteStore) queryVariantStats(ctx context.Context, query string, args ...interface{}) (map[string][]VariantStats, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get variant stats: %w", err)
 	}
 	defer rows.Close()
 
-	var stats []VariantStats
+	stats := make(map[string][]VariantStats)
 	for rows.Next() {
-		var s VariantStats
-		if err := rows.Scan(&s.Variant, &s.Views, &s.Conversions); err != nil {
+		var name string
+		var vs VariantStats
+		if err := rows.Scan(&name, &vs.Variant, &vs.Views, &vs.Conversions, &vs.Value,
+			&vs.Unattributed, &vs.Mismatched); err != nil {
 			return nil, fmt.Errorf("failed to scan stats: %w", err)
 		}
-		stats = append(stats, s)
+		stats[name] = append(stats[name], vs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get variant stats: %w", err)
 	}
 
 	return stats, nil
 }
 
+// RebuildAggregates recomputes variant_daily and visitor_conversions from
+// raw events for one test, or for all tests if testName is empty, applying
+// the current attribution window. Days already rolled up by retention have
+// no raw events left and are kept as they are.
+func (s *SQLiteStore) RebuildAggregates(ctx context.Context, testName string) error {
+	filter, args := "", []interface{}{}
+	if testName != "" {
+		filter, args = "AND test_name = ?", []interface{}{testName}
+	}
+
+	window, err := s.GetAttributionWindow(ctx)
+	if err != nil {
+		return err
+	}
+	status := attributionStatus("c.variant", "COALESCE(v.variant, cv.variant)",
+		"COALESCE(v.created_at, cv.viewed_at)", "c.created_at", int64(window.Seconds()))
+
+	// First day of a test that still has all its raw events
+	const rawFrom = `COALESCE((SELECT date(compacted_before, 'unixepoch') FROM tests
+	                           WHERE name = %s), '')`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM variant_daily WHERE day >= `+fmt.Sprintf(rawFrom, "variant_daily.test_name")+` `+filter, args...)
+	if err != nil {
+		return fmt.Errorf("failed to clear aggregates: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO variant_daily (test_name, variant, day, views, conversions, value, unattributed, mismatched)
+		SELECT test_name, variant, day, SUM(views), SUM(conversions), SUM(value),
+		       SUM(unattributed), SUM(mismatched) FROM (
+			SELECT test_name, variant, date(created_at, 'unixepoch') AS day,
+			       1 AS views, 0 AS conversions, 0 AS value, 0 AS unattributed, 0 AS mismatched
+			FROM events WHERE event_type = 'view' `+filter+`
+			UNION ALL
+			SELECT test_name, CASE WHEN status = 'attributed' THEN credited ELSE claimed END, day,
+			       0, status = 'attributed', CASE WHEN status = 'attributed' THEN value ELSE 0 END,
+			       status = 'unattributed', status = 'mismatched'
+			FROM (
+				SELECT c.test_name, c.variant AS claimed, COALESCE(v.variant, cv.variant) AS credited,
+				       date(c.created_at, 'unixepoch') AS day, COALESCE(c.value, 0) AS value,
+				       `+status+` AS status
+				FROM events c
+				LEFT JOIN events v ON v.test_name = c.test_name AND v.visitor_id = c.visitor_id
+				                    AND v.event_type = 'view'
+				LEFT JOIN compacted_visitors cv ON cv.test_name = c.test_name AND cv.visitor_id = c.visitor_id
+				WHERE c.event_type = 'convert' `+strings.ReplaceAll(filter, "test_name", "c.test_name")+`
+			)
+		) raw
+		WHERE day >= `+fmt.Sprintf(rawFrom, "raw.test_name")+`
+		GROUP BY test_name, variant, day`, append(args, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild aggregates: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM visitor_conversions WHERE 1 = 1 `+filter, args...)
+	if err != nil {
+		return fmt.Errorf("failed to clear aggregates: %w", err)
+	}
+
+	// Conversion events rolled up by retention were settled then and are
+	// kept in compacted_visitors
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO visitor_conversions (test_name, visitor_id, variant, events)
+		SELECT test_name, visitor_id, MAX(variant), SUM(n) FROM (
+			SELECT c.test_name, c.visitor_id, COALESCE(v.variant, cv.variant) AS variant, 1 AS n
+			FROM conversion_events c
+			LEFT JOIN events v ON v.test_name = c.test_name AND v.visitor_id = c.visitor_id
+			                    AND v.event_type = 'view'
+			LEFT JOIN compacted_visitors cv ON cv.test_name = c.test_name AND cv.visitor_id = c.visitor_id
+			WHERE `+status+` = 'attributed' `+strings.ReplaceAll(filter, "test_name", "c.test_name")+`
+			UNION ALL
+			SELECT cv.test_name, cv.visitor_id, COALESCE(cv.variant, v.variant), cv.conversion_events
+			FROM compacted_visitors cv
+			LEFT JOIN events v ON v.test_name = cv.test_name AND v.visitor_id = cv.visitor_id
+			                    AND v.event_type = 'view'
+			WHERE cv.conversion_events > 0 `+strings.ReplaceAll(filter, "test_name", "cv.test_name")+`
+		)
+		WHERE variant IS NOT NULL
+		GROUP BY test_name, visitor_id`, append(args, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild aggregates: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO settings (key, value) VALUES (?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value`, settingAggregatesVersion, aggregatesVersion); err != nil {
+		return fmt.Errorf("failed to save aggregates version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 func (s *SQLiteStore) GetEvents(ctx context.Context, testName string) ([]*Event, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, test_name, variant, event_type, visitor_id, created_at
+		`SELECT id, test_name, variant, event_type, visitor_id, COALESCE(value, 0), created_at
 		 FROM events WHERE test_name = ? ORDER BY created_at DESC`,
 		testName,
 	)
@@ -302,7 +1008,7 @@ func (s *SQLiteStore) GetEvents(ctx context.Context, testName string) ([]*Event,
 	for rows.Next() {
 		var e Event
 		var createdAt int64
-		if err := rows.Scan(&e.ID, &e.TestName, &e.Variant, &e.EventType, &e.VisitorID, &createdAt); err != nil {
+		if err := rows.Scan(&e.ID, &e.TestName, &e.Variant, &e.EventType, &e.VisitorID, &e.Value, &createdAt); err != nil {
 			return nil, fmt.Errorf("failed to scan event: %w", err)
 		}
 		e.CreatedAt = time.Unix(createdAt, 0)
@@ -312,6 +1018,17 @@ func (s *SQLiteStore) GetEvents(ctx context.Context, testName string) ([]*Event,
 	return events, nil
 }
 
+// Size returns the database size in bytes
+func (s *SQLiteStore) Size(ctx context.Context) (int64, error) {
+	var size int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get database size: %w", err)
+	}
+	return size, nil
+}
+
 // DB returns the underlying database connection for health checks
 func (s *SQLiteStore) DB() *sql.DB {
 	return s.db
@@ -361,6 +1078,17 @@ func containsUniqueConstraint(err error) bool {
 	return strings.Contains(errStr, "UNIQUE constraint") || strings.Contains(errStr, "unique constraint")
 }
 
+// CountTestsBySource returns the number of tests created from a source
+func (s *SQLiteStore) CountTestsBySource(ctx context.Context, source string) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM tests WHERE source = ?`, source).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tests: %w", err)
+	}
+	return count, nil
+}
+
 // SetSourceConflict marks a test as having a source conflict
 func (s *SQLiteStore) SetSourceConflict(ctx context.Context, name string, hasConflict bool) error {
 	conflict := 0
@@ -390,9 +1118,7 @@ func (s *SQLiteStore) SetSourceConflict(ctx context.Context, name string, hasCon
 // GetTestsByURL returns all running tests matching a URL
 func (s *SQLiteStore) GetTestsByURL(ctx context.Context, url string) ([]*Test, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, name, variants, weights, conversion_goal, state, winner_variant,
-		        source, has_source_conflict, url, conversion_url, target, cta_target,
-		        created_at, updated_at
+		`SELECT `+testColumns+`
 		 FROM tests
 		 WHERE url = ? AND state = 'running'`,
 		url)
@@ -413,6 +1139,26 @@ func (s *SQLiteStore) GetTestsByURL(ctx context.Context, url string) ([]*Test, e
 	return tests, rows.Err()
 }
 
+// GetTestsByGoal returns all running tests with the given conversion goal
+func (s *SQLiteStore) GetTestsByGoal(ctx context.Context, goal string) ([]*Test, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+testColumns+` FROM tests WHERE conversion_goal = ? AND state = 'running' ORDER BY name`, goal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tests by goal: %w", err)
+	}
+	defer rows.Close()
+
+	var tests []*Test
+	for rows.Next() {
+		test, err := scanTest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan test: %w", err)
+		}
+		tests = append(tests, test)
+	}
+	return tests, rows.Err()
+}
+
 // SetTestURLFields sets URL-related fields on a test
 func (s *SQLiteStore) SetTestURLFields(ctx context.Context, name, url, target, ctaTarget, conversionURL string) error {
 	now := time.Now().Unix()
@@ -435,6 +1181,109 @@ func (s *SQLiteStore) SetTestURLFields(ctx context.Context, name, url, target, c
 	return nil
 }
 
+// SetTestLayer assigns a test to a mutually exclusive layer ("" clears it)
+func (s *SQLiteStore) SetTestLayer(ctx context.Context, name, layer string) error {
+	now := time.Now().Unix()
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE tests SET layer = ?, updated_at = ? WHERE name = ?`,
+		nullableStringPtr(layer), now, name)
+	if err != nil {
+		return fmt.Errorf("failed to set layer: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SetTestOrigins binds a test to the origins it may receive events from
+// (nil or empty allows any origin permitted by the global allowlist)
+func (s *SQLiteStore) SetTestOrigins(ctx context.Context, name string, origins []string) error {
+	var originsJSON []byte
+	if len(origins) > 0 {
+		var err error
+		originsJSON, err = json.Marshal(origins)
+		if err != nil {
+			return fmt.Errorf("failed to marshal origins: %w", err)
+		}
+	}
+
+	now := time.Now().Unix()
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE tests SET origins = ?, updated_at = ? WHERE name = ?`,
+		nullableString(originsJSON), now, name)
+	if err != nil {
+		return fmt.Errorf("failed to set origins: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetLayers returns the running tests in each layer, ordered by test name.
+// The order is significant: visitors are bucketed by index into this list.
+func (s *SQLiteStore) GetLayers(ctx context.Context) (map[string][]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT layer, name FROM tests
+		 WHERE layer IS NOT NULL AND layer != '' AND state = 'running'
+		 ORDER BY layer, name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query layers: %w", err)
+	}
+	defer rows.Close()
+
+	layers := make(map[string][]string)
+	for rows.Next() {
+		var layer, name string
+		if err := rows.Scan(&layer, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan layer: %w", err)
+		}
+		layers[layer] = append(layers[layer], name)
+	}
+
+	return layers, rows.Err()
+}
+
+// GetHoldoutPercent returns the global holdout percentage (0 if unset)
+func (s *SQLiteStore) GetHoldoutPercent(ctx context.Context) (float64, error) {
+	value, err := s.GetSetting(ctx, SettingHoldoutPercent)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	pct, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid holdout percent %q: %w", value, err)
+	}
+	return pct, nil
+}
+
+// SetHoldoutPercent sets the share of visitors (0-100) that never see any test
+func (s *SQLiteStore) SetHoldoutPercent(ctx context.Context, pct float64) error {
+	if pct < 0 || pct > 100 {
+		return fmt.Errorf("holdout percent must be between 0 and 100, got %g", pct)
+	}
+	return s.SetSetting(ctx, SettingHoldoutPercent, strconv.FormatFloat(pct, 'f', -1, 64))
+}
+
 func nullableStringPtr(s string) sql.NullString {
 	if s == "" {
 		return sql.NullString{}
@@ -461,18 +1310,21 @@ func scanTest(s scanner) (*Test, error) {
 	var weightsJSON sql.NullString
 	var winnerVariant sql.NullInt64
 	var hasSourceConflict int64
-	var url, conversionURL, target, ctaTarget sql.NullString
+	var url, conversionURL, target, ctaTarget, layer, originsJSON, engagementJSON sql.NullString
+	var retentionDays, compactedBefore, countCap sql.NullInt64
+	var countMode sql.NullString
 	var createdAt, updatedAt int64
 
 	err := s.Scan(&test.ID, &test.Name, &variantsJSON, &weightsJSON, &test.ConversionGoal, &test.State, &winnerVariant,
 		&test.Source, &hasSourceConflict, &url, &conversionURL, &target, &ctaTarget,
-		&createdAt, &updatedAt)
+		&layer, &originsJSON, &retentionDays, &compactedBefore, &countMode, &countCap, &engagementJSON, &createdAt, &updatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := json.Unmarshal([]byte(variantsJSON), &test.Variants); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal variants: %w", err)
+	test.Variants, test.Payloads, err = decodeVariants([]byte(variantsJSON))
+	if err != nil {
+		return nil, err
 	}
 
 	if weightsJSON.Valid && weightsJSON.String != "" {
@@ -499,6 +1351,35 @@ func scanTest(s scanner) (*Test, error) {
 	if ctaTarget.Valid {
 		test.CTATarget = ctaTarget.String
 	}
+	if layer.Valid {
+		test.Layer = layer.String
+	}
+	if originsJSON.Valid && originsJSON.String != "" {
+		if err := json.Unmarshal([]byte(originsJSON.String), &test.Origins); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal origins: %w", err)
+		}
+	}
+
+	if retentionDays.Valid {
+		days := int(retentionDays.Int64)
+		test.RetentionDays = &days
+	}
+	if compactedBefore.Valid {
+		test.CompactedBefore = time.Unix(compactedBefore.Int64, 0).UTC()
+	}
+
+	test.CountMode = CountUnique
+	if countMode.Valid && countMode.String != "" {
+		test.CountMode = CountMode(countMode.String)
+	}
+	test.CountCap = int(countCap.Int64)
+
+	if engagementJSON.Valid && engagementJSON.String != "" {
+		test.Engagement = &EngagementGoal{}
+		if err := json.Unmarshal([]byte(engagementJSON.String), test.Engagement); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal engagement goal: %w", err)
+		}
+	}
 
 	test.CreatedAt = time.Unix(createdAt, 0)
 	test.UpdatedAt = time.Unix(updatedAt, 0)
@@ -531,3 +1412,32 @@ func (s *SQLiteStore) GetSetting(ctx context.Context, key string) (string, error
 	}
 	return value, nil
 }
+
+// GetSettingList retrieves a list setting stored as a JSON array (nil if unset)
+func (s *SQLiteStore) GetSettingList(ctx context.Context, key string) ([]string, error) {
+	value, err := s.GetSetting(ctx, key)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal setting %s: %w", key, err)
+	}
+	return list, nil
+}
+
+// SetSettingList stores a list setting as a JSON array
+func (s *SQLiteStore) SetSettingList(ctx context.Context, key string, list []string) error {
+	if list == nil {
+		list = []string{}
+	}
+	value, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("failed to marshal setting %s: %w", key, err)
+	}
+	return s.SetSetting(ctx, key, string(value))
+}
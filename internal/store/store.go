@@ -1,8 +1,13 @@
 package store
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
-// Store defines the interface for test storage operations
+// Store defines the interface for test storage operations. It holds what
+// the server needs to handle requests; the interfaces below add optional
+// operations the server uses when a Store implements them.
 type Store interface {
 	// Test operations
 	CreateTest(ctx context.Context, name string, variants []string, weights []float64, conversionGoal string) (*Test, error)
@@ -25,11 +30,82 @@ type Store interface {
 	// SetTestURLFields sets URL-related fields on a test
 	SetTestURLFields(ctx context.Context, name, url, target, ctaTarget, conversionURL string) error
 
+	// GetLayers returns the running tests in each layer, ordered by test name
+	GetLayers(ctx context.Context) (map[string][]string, error)
+
+	// GetHoldoutPercent returns the global holdout percentage (0 if unset)
+	GetHoldoutPercent(ctx context.Context) (float64, error)
+
 	// Event operations
 	RecordEvent(ctx context.Context, testName string, variant int, eventType string, visitorID string) error
 	GetVariantStats(ctx context.Context, testName string) ([]VariantStats, error)
 	GetEvents(ctx context.Context, testName string) ([]*Event, error)
 
+	// RecordConversion records a server-side conversion; false means duplicate
+	RecordConversion(ctx context.Context, c Conversion) (bool, error)
+
+	// GetVisitorVariant returns the variant a visitor was first shown
+	GetVisitorVariant(ctx context.Context, testName, visitorID string) (int, error)
+
+	// GetTestsByGoal returns all running tests with the given conversion goal
+	GetTestsByGoal(ctx context.Context, goal string) ([]*Test, error)
+
+	// Identity operations
+	LinkIdentity(ctx context.Context, visitorID, userID string) error
+	GetVisitorIDs(ctx context.Context, userID string) ([]string, error)
+	GetUserAssignments(ctx context.Context, userID string) (map[string]int, error)
+
+	// Settings
+	GetSetting(ctx context.Context, key string) (string, error)
+	GetSettingList(ctx context.Context, key string) ([]string, error)
+
+	// CountTestsBySource returns the number of tests created from a source
+	CountTestsBySource(ctx context.Context, source string) (int, error)
+
+	// Size returns the storage size in bytes
+	Size(ctx context.Context) (int64, error)
+
 	// Lifecycle
 	Close() error
 }
+
+// EventBatcher records a batch of events at once, keeping their CreatedAt
+// times. Without it, buffered events are recorded one by one.
+type EventBatcher interface {
+	RecordEvents(ctx context.Context, events []Event) error
+}
+
+// AllStatsReader returns the variant stats of every test in one call,
+// keyed by test name. Without it, the dashboard reads them test by test.
+type AllStatsReader interface {
+	GetAllVariantStats(ctx context.Context) (map[string][]VariantStats, error)
+}
+
+// PayloadEditor replaces a test's variants with typed payloads. Without
+// it, the dashboard can't edit variants.
+type PayloadEditor interface {
+	SetTestPayloads(ctx context.Context, name string, payloads []VariantPayload) error
+}
+
+// Maintainer rolls up expired raw events and frees the space they used.
+// Without it, scheduled retention is skipped.
+type Maintainer interface {
+	ApplyRetention(ctx context.Context, now time.Time, dryRun bool) ([]RetentionResult, error)
+	Vacuum(ctx context.Context, full bool) error
+}
+
+// Backuper writes a consistent copy of the storage to path. Without it,
+// scheduled backups are skipped.
+type Backuper interface {
+	Backup(ctx context.Context, path string, compress bool) error
+}
+
+// The built-in SQLite store implements every optional operation
+var (
+	_ Store          = (*SQLiteStore)(nil)
+	_ EventBatcher   = (*SQLiteStore)(nil)
+	_ AllStatsReader = (*SQLiteStore)(nil)
+	_ PayloadEditor  = (*SQLiteStore)(nil)
+	_ Maintainer     = (*SQLiteStore)(nil)
+	_ Backuper       = (*SQLiteStore)(nil)
+)
@@ -0,0 +1,126 @@
+// Package hlg embeds headline-goat in an existing Go HTTP server. It serves
+// the same routes as the standalone binary (hlg.js, the beacon and API
+// endpoints and the dashboard) from a single http.Handler:
+//
+//	st, err := hlg.OpenSQLite("hlg.db")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer st.Close()
+//
+//	cfg := hlg.DefaultConfig()
+//	cfg.PathPrefix = "/_hlg"
+//	cfg.Auth = func(r *http.Request) bool { return isAdmin(r) }
+//	mux.Handle("/_hlg/", hlg.NewHandler(st, cfg))
+//
+// Pages then load the script from /_hlg/hlg.js and the dashboard is at
+// /_hlg/dashboard.
+package hlg
+
+import (
+	"net/http"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+// Config configures the handler. Port and TokenFile only apply to the
+// standalone server and are ignored here.
+type Config = server.Config
+
+// Store is the storage backend. OpenSQLite returns the built-in SQLite
+// implementation; other implementations can be injected.
+type Store = store.Store
+
+// Optional Store extensions. The handler checks for them at runtime and
+// falls back (or skips the feature) when an implementation lacks them.
+type (
+	EventBatcher   = store.EventBatcher
+	AllStatsReader = store.AllStatsReader
+	PayloadEditor  = store.PayloadEditor
+	Maintainer     = store.Maintainer
+	Backuper       = store.Backuper
+)
+
+// Types used by Store implementations
+type (
+	Test            = store.Test
+	TestState       = store.TestState
+	CountMode       = store.CountMode
+	EngagementGoal  = store.EngagementGoal
+	GoalType        = store.GoalType
+	Event           = store.Event
+	VariantStats    = store.VariantStats
+	DailyStats      = store.DailyStats
+	Conversion      = store.Conversion
+	RetentionResult = store.RetentionResult
+	VariantPayload  = store.VariantPayload
+	PayloadType     = store.PayloadType
+	ElementChange   = store.ElementChange
+)
+
+// Test states
+const (
+	StateRunning   = store.StateRunning
+	StatePaused    = store.StatePaused
+	StateCompleted = store.StateCompleted
+)
+
+// Ways a test counts repeat conversions
+const (
+	CountUnique = store.CountUnique
+	CountEvery  = store.CountEvery
+	CountCapped = store.CountCapped
+)
+
+// Variant payload types
+const (
+	PayloadText  = store.PayloadText
+	PayloadHTML  = store.PayloadHTML
+	PayloadAttrs = store.PayloadAttrs
+	PayloadClass = store.PayloadClass
+	PayloadMulti = store.PayloadMulti
+)
+
+// Engagement goal types
+const (
+	GoalScroll  = store.GoalScroll
+	GoalDwell   = store.GoalDwell
+	GoalVisible = store.GoalVisible
+	GoalSubmit  = store.GoalSubmit
+)
+
+// ErrNotFound must be returned by Store implementations for missing tests
+// and settings
+var ErrNotFound = store.ErrNotFound
+
+// DefaultConfig returns the default limits used by the standalone server
+func DefaultConfig() Config {
+	return server.DefaultConfig()
+}
+
+// OpenSQLite opens (or creates) a SQLite database at path
+func OpenSQLite(path string) (Store, error) {
+	s, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Server is a headline-goat instance. Use Handler to mount it.
+type Server = server.Server
+
+// New creates a server backed by st. Without cfg.Auth the dashboard is
+// protected by a random token, available from Token. With
+// cfg.EventBufferSize set, call Close on shutdown to write buffered events.
+func New(st Store, cfg Config) *Server {
+	return server.NewWithConfig(st, cfg)
+}
+
+// NewHandler returns an http.Handler serving headline-goat from st. Mount
+// it at cfg.PathPrefix plus a trailing slash. Set cfg.Auth to reuse your
+// application's login for the dashboard.
+func NewHandler(st Store, cfg Config) http.Handler {
+	return New(st, cfg).Handler()
+}
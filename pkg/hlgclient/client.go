@@ -0,0 +1,284 @@
+// Package hlgclient is a Go client for headline-goat. It assigns variants
+// locally from a cached copy of the running tests, sends view and convert
+// events in batches, and provides net/http middleware that gives every
+// visitor a stable ID.
+//
+// The client authenticates with an API key created by `hlg apikey create`.
+//
+// Assignments made here are independent of hlg.js. The middleware's visitor
+// ID lives in an HttpOnly cookie that hlg.js can't read, and hlg.js picks
+// variants at random rather than hashing the ID, so the same visitor can
+// get different variants from the two. Run each test either server-side
+// with this package or in the browser with hlg.js, not both.
+//
+//	c := hlgclient.New(hlgclient.Config{
+//		ServerURL: "https://hlg.example.com",
+//		APIKey:    os.Getenv("HLG_API_KEY"),
+//	})
+//	defer c.Close()
+//
+//	http.Handle("/", c.Middleware(home))
+//
+//	func home(w http.ResponseWriter, r *http.Request) {
+//		headline := "Ship Faster"
+//		if v, ok := c.Expose(r.Context(), "hero"); ok && v == 1 {
+//			headline = "Build Better"
+//		}
+//		...
+//	}
+package hlgclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/assign"
+)
+
+// Config holds client settings. Zero values get the defaults noted below.
+type Config struct {
+	ServerURL  string       // Base URL of the hlg server (required)
+	APIKey     string       // API key from `hlg apikey create` (required)
+	HTTPClient *http.Client // Defaults to a client with a 10s timeout
+
+	ConfigTTL     time.Duration // How long fetched tests are cached (default 1m)
+	BatchSize     int           // Events per request (default 100)
+	FlushInterval time.Duration // Maximum time an event waits in the queue (default 5s)
+	MaxRetries    int           // Retries for a failed batch (default 3, negative for none)
+
+	CookieName string // Visitor ID cookie set by Middleware (default "hlg_vid")
+
+	// OnError is called with errors from background work, such as batches
+	// dropped after all retries. Defaults to discarding them.
+	OnError func(error)
+}
+
+// Test is a running test
+type Test struct {
+	Name     string    `json:"name"`
+	Variants []string  `json:"variants"`
+	Weights  []float64 `json:"weights,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Target   string    `json:"target,omitempty"`
+}
+
+// TestConfig is the set of running tests plus the holdout and layer rules
+// that decide which visitors take part
+type TestConfig struct {
+	Holdout float64             `json:"holdout"`
+	Layers  map[string][]string `json:"layers"`
+	Tests   []Test              `json:"tests"`
+}
+
+// Test returns the named test, if it is running
+func (tc *TestConfig) Test(name string) (*Test, bool) {
+	for i := range tc.Tests {
+		if tc.Tests[i].Name == name {
+			return &tc.Tests[i], true
+		}
+	}
+	return nil, false
+}
+
+// retryDelay is how long a failed fetch of the tests is remembered before
+// the next caller tries again
+const retryDelay = 5 * time.Second
+
+// Client talks to an hlg server. It is safe for concurrent use.
+type Client struct {
+	cfg     Config
+	baseURL string
+
+	mu        sync.Mutex
+	cached    *TestConfig
+	nextFetch time.Time  // When the cached copy should next be refreshed
+	lastErr   error      // Error of the last fetch, while nothing is cached
+	fetching  *fetchCall // The fetch in progress, if any
+
+	events *batcher
+}
+
+// New creates a client and starts its background event sender. Call Close
+// to flush queued events on shutdown.
+func New(cfg Config) *Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.ConfigTTL <= 0 {
+		cfg.ConfigTTL = time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "hlg_vid"
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	c := &Client{cfg: cfg, baseURL: strings.TrimRight(cfg.ServerURL, "/")}
+	c.events = newBatcher(c)
+	return c
+}
+
+// Tests returns the running tests, fetching them if the cached copy is
+// older than ConfigTTL. A stale copy is returned straight away while it is
+// refreshed in the background, and also kept if the refresh fails.
+// Concurrent callers share one fetch, and a failed fetch is not retried
+// for a few seconds.
+func (c *Client) Tests(ctx context.Context) (*TestConfig, error) {
+	c.mu.Lock()
+	if time.Now().Before(c.nextFetch) {
+		tc, err := c.cached, c.lastErr
+		c.mu.Unlock()
+		if tc == nil {
+			return nil, err
+		}
+		return tc, nil
+	}
+
+	call := c.fetching
+	if call == nil {
+		call = &fetchCall{done: make(chan struct{})}
+		c.fetching = call
+		go c.refresh(call)
+	}
+	stale := c.cached
+	c.mu.Unlock()
+
+	if stale != nil {
+		return stale, nil
+	}
+	select {
+	case <-call.done:
+		return call.tc, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchCall is a fetch of the running tests shared by the callers waiting
+// for it
+type fetchCall struct {
+	done chan struct{}
+	tc   *TestConfig
+	err  error
+}
+
+// refresh fetches the running tests for call. It doesn't use a caller's
+// context, since the result outlives the request that started it.
+func (c *Client) refresh(call *fetchCall) {
+	tc, err := c.fetchTests(context.Background())
+
+	c.mu.Lock()
+	if err == nil {
+		c.cached = tc
+		c.lastErr = nil
+		c.nextFetch = time.Now().Add(c.cfg.ConfigTTL)
+	} else {
+		c.lastErr = err
+		c.nextFetch = time.Now().Add(min(c.cfg.ConfigTTL, retryDelay))
+	}
+	stale := c.cached != nil
+	c.fetching = nil
+	c.mu.Unlock()
+
+	call.tc, call.err = tc, err
+	close(call.done)
+
+	// Callers that got the stale copy don't see the error
+	if err != nil && stale {
+		c.cfg.OnError(err)
+	}
+}
+
+func (c *Client) fetchTests(ctx context.Context) (*TestConfig, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/config", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tests: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch tests: server returned %s", resp.Status)
+	}
+
+	var tc TestConfig
+	if err := json.NewDecoder(resp.Body).Decode(&tc); err != nil {
+		return nil, fmt.Errorf("failed to decode tests: %w", err)
+	}
+	return &tc, nil
+}
+
+// Assign returns the variant of a running test for a visitor. ok is false
+// if the test is not running or the visitor is held out of it. Assignment
+// is deterministic, so every server instance agrees without coordination.
+func (c *Client) Assign(ctx context.Context, testName, visitorID string) (variant int, ok bool, err error) {
+	tc, err := c.Tests(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	variant, ok = tc.Assign(testName, visitorID)
+	return variant, ok, nil
+}
+
+// Assign returns the variant of a test for a visitor using this config
+func (tc *TestConfig) Assign(testName, visitorID string) (int, bool) {
+	test, ok := tc.Test(testName)
+	if !ok || !assign.Eligible(visitorID, testName, tc.Layers, tc.Holdout) {
+		return 0, false
+	}
+	return assign.Variant(testName, visitorID, len(test.Variants), test.Weights), true
+}
+
+// Assignments returns the variant of every running test the visitor takes
+// part in
+func (tc *TestConfig) Assignments(visitorID string) map[string]int {
+	assignments := make(map[string]int)
+	for _, t := range tc.Tests {
+		if v, ok := tc.Assign(t.Name, visitorID); ok {
+			assignments[t.Name] = v
+		}
+	}
+	return assignments
+}
+
+// View queues a view event
+func (c *Client) View(testName string, variant int, visitorID string) {
+	c.events.add(event{TestName: testName, Variant: variant, EventType: "view", VisitorID: visitorID})
+}
+
+// Convert queues a conversion event
+func (c *Client) Convert(testName string, variant int, visitorID string) {
+	c.events.add(event{TestName: testName, Variant: variant, EventType: "convert", VisitorID: visitorID})
+}
+
+// Flush sends all queued events now
+func (c *Client) Flush(ctx context.Context) error {
+	return c.events.flush(ctx)
+}
+
+// Close stops the background sender and flushes queued events
+func (c *Client) Close() error {
+	return c.events.close()
+}
@@ -0,0 +1,185 @@
+package hlgclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxQueuedEvents bounds memory if the server is unreachable for a while;
+// events beyond it are dropped
+const maxQueuedEvents = 10000
+
+type event struct {
+	TestName  string `json:"t"`
+	Variant   int    `json:"v"`
+	EventType string `json:"e"`
+	VisitorID string `json:"vid"`
+	Key       string `json:"key"` // Lets the server ignore the event if its batch is sent again
+}
+
+// batcher queues events and sends them to /api/events in batches, either
+// when BatchSize events are waiting or every FlushInterval
+type batcher struct {
+	c *Client
+
+	mu     sync.Mutex
+	queue  []event
+	closed bool
+
+	sendMu sync.Mutex // Serializes sends so batches go out in order
+	wake   chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newBatcher(c *Client) *batcher {
+	b := &batcher{
+		c:    c,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(e event) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	if len(b.queue) >= maxQueuedEvents {
+		b.mu.Unlock()
+		b.c.cfg.OnError(fmt.Errorf("event queue full, dropping %s event for %s", e.EventType, e.TestName))
+		return
+	}
+	e.Key = newVisitorID()
+	b.queue = append(b.queue, e)
+	full := len(b.queue) >= b.c.cfg.BatchSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *batcher) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.c.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+		if err := b.flush(context.Background()); err != nil {
+			b.c.cfg.OnError(err)
+		}
+	}
+}
+
+// flush sends queued events in batches until the queue is empty. A batch
+// that fails after all retries is dropped and its error returned.
+func (b *batcher) flush(ctx context.Context) error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	var firstErr error
+	for {
+		b.mu.Lock()
+		n := len(b.queue)
+		if n > b.c.cfg.BatchSize {
+			n = b.c.cfg.BatchSize
+		}
+		batch := append([]event(nil), b.queue[:n]...)
+		b.queue = b.queue[n:]
+		b.mu.Unlock()
+
+		if len(batch) == 0 {
+			return firstErr
+		}
+		if err := b.send(ctx, batch); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+}
+
+// send posts one batch, retrying network errors, 429s and 5xx responses
+// with exponential backoff. Each event carries an idempotency key, so a
+// retry after an ambiguous failure does not double count.
+func (b *batcher) send(ctx context.Context, batch []event) error {
+	body, err := json.Marshal(map[string][]event{"events": batch})
+	if err != nil {
+		return fmt.Errorf("failed to encode events: %w", err)
+	}
+
+	backoff := 200 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		retry, err := b.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= b.c.cfg.MaxRetries {
+			return fmt.Errorf("dropped %d events: %w", len(batch), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("dropped %d events: %w", len(batch), ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (b *batcher) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.c.baseURL+"/api/events", bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+b.c.cfg.APIKey)
+
+	resp, err := b.c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send events: %w", err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("failed to send events: server returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("failed to send events: server returned %s", resp.Status)
+	}
+}
+
+// close stops the background loop and sends whatever is still queued
+func (b *batcher) close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.done)
+	b.wg.Wait()
+	return b.flush(context.Background())
+}
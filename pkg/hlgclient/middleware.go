@@ -0,0 +1,98 @@
+package hlgclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type contextKey int
+
+const (
+	visitorIDKey contextKey = iota
+	assignmentsKey
+)
+
+const cookieMaxAge = 365 * 24 * time.Hour
+
+// Middleware gives every request a visitor ID, setting the visitor cookie
+// if it is missing, and stores the visitor's assignments for all running
+// tests in the request context. If tests cannot be loaded the request goes
+// through with no assignments, so pages fall back to their control copy.
+func (c *Client) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vid := ""
+		if cookie, err := r.Cookie(c.cfg.CookieName); err == nil && validVisitorID(cookie.Value) {
+			vid = cookie.Value
+		} else {
+			vid = newVisitorID()
+			http.SetCookie(w, &http.Cookie{
+				Name:     c.cfg.CookieName,
+				Value:    vid,
+				Path:     "/",
+				MaxAge:   int(cookieMaxAge.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		ctx := context.WithValue(r.Context(), visitorIDKey, vid)
+		if tc, err := c.Tests(r.Context()); err == nil {
+			ctx = context.WithValue(ctx, assignmentsKey, tc.Assignments(vid))
+		} else {
+			c.cfg.OnError(err)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// VisitorID returns the visitor ID stored in the context by Middleware
+func VisitorID(ctx context.Context) string {
+	vid, _ := ctx.Value(visitorIDKey).(string)
+	return vid
+}
+
+// Variant returns the variant assigned to the request's visitor. ok is false
+// outside Middleware, for tests that are not running, and for visitors held
+// out of the test.
+func Variant(ctx context.Context, testName string) (variant int, ok bool) {
+	assignments, _ := ctx.Value(assignmentsKey).(map[string]int)
+	variant, ok = assignments[testName]
+	return variant, ok
+}
+
+// Expose returns the request's variant like Variant and queues a view event
+// for it. Call it where the variant is actually rendered.
+func (c *Client) Expose(ctx context.Context, testName string) (int, bool) {
+	variant, ok := Variant(ctx, testName)
+	if ok {
+		c.View(testName, variant, VisitorID(ctx))
+	}
+	return variant, ok
+}
+
+// ConvertRequest queues a conversion for the request's visitor in a test
+// it was assigned to
+func (c *Client) ConvertRequest(ctx context.Context, testName string) {
+	if variant, ok := Variant(ctx, testName); ok {
+		c.Convert(testName, variant, VisitorID(ctx))
+	}
+}
+
+func newVisitorID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validVisitorID rejects cookie values that would be refused by the server
+func validVisitorID(vid string) bool {
+	return vid != "" && len(vid) <= 128
+}
@@ -0,0 +1,187 @@
+package embed_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/pkg/hlg"
+)
+
+func setupMounted(t *testing.T, cfg hlg.Config) (*httptest.Server, hlg.Store) {
+	t.Helper()
+	st, err := hlg.OpenSQLite(filepath.Join(t.TempDir(), "hlg.db"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	mux := http.NewServeMux()
+	mux.Handle("/_hlg/", hlg.NewHandler(st, cfg))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "app")
+	})
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts, st
+}
+
+func TestHandler_ServesUnderPrefix(t *testing.T) {
+	cfg := hlg.DefaultConfig()
+	cfg.PathPrefix = "/_hlg"
+	ts, st := setupMounted(t, cfg)
+	_, _ = st.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	resp, err := http.Get(ts.URL + "/_hlg/hlg.js")
+	if err != nil {
+		t.Fatalf("failed to fetch script: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), ts.URL+"/_hlg") {
+		t.Error("expected script to send beacons under the prefix")
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/_hlg/b", strings.NewReader(`{"t":"hero","v":1,"e":"view","vid":"v1"}`))
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send beacon: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", resp.StatusCode)
+	}
+
+	stats, _ := st.GetVariantStats(context.Background(), "hero")
+	if len(stats) != 1 || stats[0].Views != 1 {
+		t.Errorf("expected beacon to be recorded, got %+v", stats)
+	}
+
+	// The host application keeps its own routes
+	resp, _ = http.Get(ts.URL + "/")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "app" {
+		t.Errorf("expected host route to be untouched, got %q", body)
+	}
+}
+
+func TestHandler_AuthHook(t *testing.T) {
+	cfg := hlg.DefaultConfig()
+	cfg.PathPrefix = "/_hlg"
+	cfg.Auth = func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" }
+	ts, _ := setupMounted(t, cfg)
+
+	resp, _ := http.Get(ts.URL + "/_hlg/dashboard")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without auth, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/_hlg/dashboard", nil)
+	req.Header.Set("X-Admin", "yes")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 with auth, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), `href="/_hlg/dashboard?logout=1"`) {
+		t.Error("expected dashboard links to include the prefix")
+	}
+}
+
+// minimalStore hides the optional interfaces of the SQLite store so the
+// handler only sees the methods every Store must provide
+type minimalStore struct{ hlg.Store }
+
+func TestHandler_MinimalStore(t *testing.T) {
+	st, err := hlg.OpenSQLite(filepath.Join(t.TempDir(), "hlg.db"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	ctx := context.Background()
+	_, _ = st.CreateTest(ctx, "hero", []string{"Alpha", "Beta"}, nil, "")
+
+	cfg := hlg.DefaultConfig()
+	cfg.Auth = func(r *http.Request) bool { return true }
+	ts := httptest.NewServer(hlg.NewHandler(minimalStore{st}, cfg))
+	t.Cleanup(ts.Close)
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/b", strings.NewReader(`{"t":"hero","v":1,"e":"view","vid":"v1"}`))
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send beacon: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/dashboard")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected dashboard to render, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "hero") {
+		t.Error("expected dashboard to list the test")
+	}
+
+	resp, _ = http.PostForm(ts.URL+"/dashboard/test/hero/variants", map[string][]string{"payloads": {`[{"type":"text","text":"Alpha"},{"type":"text","text":"Gamma"}]`}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("expected 501 for variant edits, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_PayloadsFromPublicTypes(t *testing.T) {
+	cfg := hlg.DefaultConfig()
+	cfg.PathPrefix = "/_hlg"
+	ts, st := setupMounted(t, cfg)
+	ctx := context.Background()
+	_, _ = st.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = st.SetTestURLFields(ctx, "hero", "/", "h1", "", "")
+
+	editor, ok := st.(hlg.PayloadEditor)
+	if !ok {
+		t.Fatal("expected the SQLite store to support payload editing")
+	}
+	err := editor.SetTestPayloads(ctx, "hero", []hlg.VariantPayload{
+		{Type: hlg.PayloadText, Text: "A"},
+		{Type: hlg.PayloadMulti, Changes: []hlg.ElementChange{
+			{Selector: "h1", VariantPayload: hlg.VariantPayload{Type: hlg.PayloadText, Text: "B"}},
+			{Selector: ".cta", VariantPayload: hlg.VariantPayload{Type: hlg.PayloadClass, Add: []string{"big"}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("SetTestPayloads failed: %v", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/_hlg/api/tests?url=/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"type":"multi"`) {
+		t.Errorf("expected the multi-element payload to be served, got %s", body)
+	}
+}
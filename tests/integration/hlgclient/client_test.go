@@ -0,0 +1,203 @@
+package hlgclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/pkg/hlgclient"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func setupClient(t *testing.T) (*hlgclient.Client, *store.SQLiteStore) {
+	t.Helper()
+	s := testutil.SetupTestStore(t)
+
+	key, entry, err := server.GenerateAPIKey("sdk")
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if err := s.SetSettingList(context.Background(), store.SettingAPIKeys, []string{entry}); err != nil {
+		t.Fatalf("failed to save key: %v", err)
+	}
+
+	ts := httptest.NewServer(server.New(s, 0, "").Handler())
+	t.Cleanup(ts.Close)
+
+	c := hlgclient.New(hlgclient.Config{ServerURL: ts.URL, APIKey: key})
+	t.Cleanup(func() { c.Close() })
+	return c, s
+}
+
+func TestClient_AssignIsDeterministic(t *testing.T) {
+	c, s := setupClient(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	v1, ok, err := c.Assign(ctx, "hero", "visitor-1")
+	if err != nil || !ok {
+		t.Fatalf("Assign failed: ok=%v err=%v", ok, err)
+	}
+	v2, _, _ := c.Assign(ctx, "hero", "visitor-1")
+	if v1 != v2 {
+		t.Errorf("expected the same variant twice, got %d and %d", v1, v2)
+	}
+
+	if _, ok, _ := c.Assign(ctx, "missing", "visitor-1"); ok {
+		t.Error("expected unknown test to be unassigned")
+	}
+}
+
+func TestClient_HoldoutRespected(t *testing.T) {
+	c, s := setupClient(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetHoldoutPercent(ctx, 100)
+
+	if _, ok, _ := c.Assign(ctx, "hero", "visitor-1"); ok {
+		t.Error("expected held out visitor to be unassigned")
+	}
+}
+
+func TestClient_EventsAreFlushed(t *testing.T) {
+	c, s := setupClient(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	c.View("hero", 1, "visitor-1")
+	c.Convert("hero", 1, "visitor-1")
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 1 || stats[0].Views != 1 || stats[0].Conversions != 1 {
+		t.Errorf("expected 1 view and 1 conversion on variant 1, got %+v", stats)
+	}
+}
+
+func TestClient_BadAPIKey(t *testing.T) {
+	_, s := setupClient(t)
+	ts := httptest.NewServer(server.New(s, 0, "").Handler())
+	defer ts.Close()
+
+	c := hlgclient.New(hlgclient.Config{ServerURL: ts.URL, APIKey: "hlg_00000000_wrong"})
+	defer c.Close()
+
+	if _, err := c.Tests(context.Background()); err == nil {
+		t.Error("expected error with invalid API key")
+	}
+}
+
+func TestClient_ServesStaleTestsWhileServerIsDown(t *testing.T) {
+	var requests atomic.Int32
+	var down atomic.Bool
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			<-release
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"tests":[{"name":"hero","variants":["A","B"]}]}`))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	c := hlgclient.New(hlgclient.Config{ServerURL: ts.URL, APIKey: "key", ConfigTTL: time.Millisecond})
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, err := c.Tests(ctx); err != nil {
+		t.Fatalf("Tests failed: %v", err)
+	}
+	down.Store(true)
+	time.Sleep(5 * time.Millisecond)
+
+	// The refresh hangs, but every caller gets the cached tests at once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tc, err := c.Tests(ctx)
+			if err != nil || len(tc.Tests) != 1 {
+				t.Errorf("expected the stale tests, got %v, %v", tc, err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("callers waited on the refresh")
+	}
+
+	for deadline := time.Now().Add(time.Second); requests.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected one shared refresh, got %d requests", n-1)
+	}
+}
+
+func TestClient_FailedFetchIsNotRetriedAtOnce(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := hlgclient.New(hlgclient.Config{ServerURL: ts.URL, APIKey: "key"})
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.Tests(context.Background()); err == nil {
+			t.Fatal("expected error while the server is down")
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestMiddleware_SetsCookieAndAssignments(t *testing.T) {
+	c, s := setupClient(t)
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	var vid string
+	var assigned bool
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vid = hlgclient.VisitorID(r.Context())
+		_, assigned = c.Expose(r.Context(), "hero")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if vid == "" || !assigned {
+		t.Fatalf("expected visitor ID and assignment, got vid=%q assigned=%v", vid, assigned)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "hlg_vid" || cookies[0].Value != vid {
+		t.Errorf("expected hlg_vid cookie with %q, got %v", vid, cookies)
+	}
+
+	// Returning visitor keeps their ID
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "hlg_vid", Value: "returning"})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if vid != "returning" || len(w.Result().Cookies()) != 0 {
+		t.Errorf("expected existing cookie to be reused, got vid=%q", vid)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gkobilansky/headline-goat/internal/server"
@@ -138,3 +139,83 @@ func TestTestsAPI_CORS(t *testing.T) {
 		t.Error("expected CORS header to be set")
 	}
 }
+
+func TestTestsAPI_ReturnsEngagementGoal(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "hero", "/", "h1", "", "")
+	if err := s.SetTestEngagement(ctx, "hero", &store.EngagementGoal{Type: store.GoalScroll, Percent: 75}); err != nil {
+		t.Fatalf("SetTestEngagement failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var tests []struct {
+		Name       string                `json:"name"`
+		Engagement *store.EngagementGoal `json:"engagement"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&tests); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(tests) != 1 || tests[0].Engagement == nil ||
+		tests[0].Engagement.Type != store.GoalScroll || tests[0].Engagement.Percent != 75 {
+		t.Errorf("expected scroll goal in response, got %+v", tests)
+	}
+}
+
+func TestTestsAPI_ReturnsVariantPayloads(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "hero", "/", "img.hero", "", "")
+	err := s.SetTestPayloads(ctx, "hero", []store.VariantPayload{
+		{Type: store.PayloadText, Text: "A"},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"src": "/b.png"}},
+	})
+	if err != nil {
+		t.Fatalf("SetTestPayloads failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), `"payloads":[{"type":"text","text":"A"},{"type":"attrs","attrs":{"src":"/b.png"}}]`) {
+		t.Errorf("expected payloads in response, got %s", w.Body.String())
+	}
+}
+
+func TestTestsAPI_ReturnsMultiElementVariants(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Multi-element tests need no --target
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "landing", []string{"A", "B"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "landing", "/", "", "", "")
+	change := func(selector, text string) store.ElementChange {
+		return store.ElementChange{Selector: selector, VariantPayload: store.VariantPayload{Type: store.PayloadText, Text: text}}
+	}
+	err := s.SetTestPayloads(ctx, "landing", []store.VariantPayload{
+		{Type: store.PayloadMulti, Changes: []store.ElementChange{change("h1", "A1"), change(".sub", "A2")}},
+		{Type: store.PayloadMulti, Changes: []store.ElementChange{change("h1", "B1"), change(".sub", "B2")}},
+	})
+	if err != nil {
+		t.Fatalf("SetTestPayloads failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), `{"type":"multi","changes":[{"selector":"h1","type":"text","text":"B1"},{"selector":".sub","type":"text","text":"B2"}]}`) {
+		t.Errorf("expected multi-element payloads in response, got %s", w.Body.String())
+	}
+}
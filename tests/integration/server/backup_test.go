@@ -0,0 +1,83 @@
+package server_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestScheduledBackups_RotateOldCopies(t *testing.T) {
+	dir := t.TempDir()
+	// An old scheduled backup and an unrelated file
+	_ = os.WriteFile(filepath.Join(dir, "hlg-20000101-000000.db.gz"), nil, 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644)
+
+	// Each backup gets a distinct timestamp
+	var mu sync.Mutex
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+
+	st := testutil.SetupTestStore(t)
+	_, _ = st.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	cfg := server.DefaultConfig()
+	cfg.ListenAddr = freeAddr(t)
+	cfg.RetentionInterval = 0
+	cfg.BackupDir = dir
+	cfg.BackupInterval = 20 * time.Millisecond
+	cfg.BackupKeep = 2
+	cfg.BackupGzip = true
+	cfg.Now = now
+	srv := server.NewWithConfig(st, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	backups := func() []string {
+		matches, _ := filepath.Glob(filepath.Join(dir, "hlg-2024*.db.gz"))
+		return matches
+	}
+	var first string
+	waitFor(t, "first backup", func() bool {
+		if got := backups(); len(got) > 0 {
+			first = got[0]
+		}
+		return first != ""
+	})
+	waitFor(t, "first backup to be rotated out", func() bool {
+		_, err := os.Stat(first)
+		return os.IsNotExist(err)
+	})
+	cancel()
+	<-done
+
+	if _, err := os.Stat(filepath.Join(dir, "hlg-20000101-000000.db.gz")); !os.IsNotExist(err) {
+		t.Error("expected the oldest backup to be rotated out")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Error("expected unrelated files to be left alone")
+	}
+
+	got := backups()
+	sort.Strings(got)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 backups kept, got %v", got)
+	}
+	if err := store.VerifyBackup(context.Background(), got[1]); err != nil {
+		t.Errorf("scheduled backup failed verification: %v", err)
+	}
+}
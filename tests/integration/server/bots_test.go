@@ -0,0 +1,156 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+func sendViewBeacon(t *testing.T, srv *server.Server, extra map[string]interface{}, setup func(*http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	payload := map[string]interface{}{"t": "hero", "v": 0, "e": "view", "vid": "visitor123"}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	body, _ := json.Marshal(payload)
+
+	req := httptest.NewRequest(http.MethodPost, "/b", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if setup != nil {
+		setup(req)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func assertNoViews(t *testing.T, s *store.SQLiteStore) {
+	t.Helper()
+	stats, err := s.GetVariantStats(context.Background(), "hero")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("expected bot beacon to be dropped, got stats %v", stats)
+	}
+}
+
+func TestBeacon_DropsBotUserAgent(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	agents := []string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+		"UptimeRobot/2.0",
+		"curl/8.4.0",
+	}
+
+	for _, ua := range agents {
+		w := sendViewBeacon(t, srv, nil, func(r *http.Request) { r.Header.Set("User-Agent", ua) })
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: expected status 204, got %d", ua, w.Code)
+		}
+	}
+
+	assertNoViews(t, s)
+}
+
+func TestBeacon_AllowsBrowserUserAgent(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	ua := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15"
+	sendViewBeacon(t, srv, nil, func(r *http.Request) { r.Header.Set("User-Agent", ua) })
+
+	stats, _ := s.GetVariantStats(context.Background(), "hero")
+	if len(stats) != 1 || stats[0].Views != 1 {
+		t.Errorf("expected browser beacon to be recorded, got %v", stats)
+	}
+}
+
+func TestBeacon_AllowsServerBeaconFromHTTPLibrary(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	w := sendViewBeacon(t, srv, map[string]interface{}{"src": "server"}, func(r *http.Request) {
+		r.Header.Set("User-Agent", "Go-http-client/1.1")
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+
+	stats, _ := s.GetVariantStats(context.Background(), "hero")
+	if len(stats) != 1 || stats[0].Views != 1 {
+		t.Errorf("expected server beacon to be recorded, got %v", stats)
+	}
+}
+
+func TestBeacon_DropsWebdriver(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	sendViewBeacon(t, srv, map[string]interface{}{"wd": true}, nil)
+
+	assertNoViews(t, s)
+}
+
+func TestBeacon_DropsDenylistedCIDR(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetSettingList(ctx, store.SettingIPDenylist, []string{"198.51.100.0/24"})
+
+	sendViewBeacon(t, srv, nil, func(r *http.Request) { r.RemoteAddr = "198.51.100.23:4711" })
+
+	assertNoViews(t, s)
+}
+
+func TestBeacon_DenylistHonorsForwardedForFromLocalProxy(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetSettingList(ctx, store.SettingIPDenylist, []string{"203.0.113.7"})
+
+	sendViewBeacon(t, srv, nil, func(r *http.Request) {
+		r.RemoteAddr = "127.0.0.1:5000"
+		r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	})
+
+	assertNoViews(t, s)
+}
+
+func TestHealth_ReportsFilteredBeacons(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	sendViewBeacon(t, srv, nil, func(r *http.Request) { r.Header.Set("User-Agent", "bingbot/2.0") })
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var health server.HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatalf("failed to decode health: %v", err)
+	}
+	if health.FilteredBeacons["bot_user_agent"] != 1 {
+		t.Errorf("expected 1 filtered bot beacon, got %v", health.FilteredBeacons)
+	}
+}
@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestEventBuffer_FlushesOnClose(t *testing.T) {
+	srv, s := setupLimitedServer(t, func(c *server.Config) {
+		c.EventBufferSize = 100
+		c.EventFlushInterval = time.Hour
+	})
+
+	for _, vid := range []string{"v1", "v2", "v2"} {
+		w := postBeacon(srv, map[string]interface{}{
+			"t": "hero", "v": 0, "e": "view", "vid": vid, "variants": []string{"A", "B"},
+		})
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", w.Code)
+		}
+	}
+
+	if err := srv.Close(context.Background()); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+
+	stats, err := s.GetVariantStats(context.Background(), "hero")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats[0].Views != 2 {
+		t.Errorf("expected 2 deduplicated views after flush, got %d", stats[0].Views)
+	}
+}
+
+func TestEventBuffer_FlushesOnInterval(t *testing.T) {
+	srv, s := setupLimitedServer(t, func(c *server.Config) {
+		c.EventBufferSize = 100
+		c.EventFlushInterval = 10 * time.Millisecond
+	})
+	defer srv.Close(context.Background())
+
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 1, "e": "view", "vid": "v1", "variants": []string{"A", "B"},
+	})
+
+	waitFor(t, "buffered event to be written", func() bool {
+		events, err := s.GetEvents(context.Background(), "hero")
+		return err == nil && len(events) == 1
+	})
+}
+
+func TestEventBuffer_FullReturns503(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {
+		c.EventBufferSize = 2
+		c.EventFlushInterval = time.Hour
+	})
+	defer srv.Close(context.Background())
+
+	var codes []int
+	for _, vid := range []string{"v1", "v2", "v3"} {
+		w := postBeacon(srv, map[string]interface{}{
+			"t": "hero", "v": 0, "e": "view", "vid": vid, "variants": []string{"A", "B"},
+		})
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+			t.Error("expected Retry-After on 503")
+		}
+	}
+
+	if codes[0] != http.StatusNoContent || codes[1] != http.StatusNoContent || codes[2] != http.StatusServiceUnavailable {
+		t.Errorf("expected 204, 204, 503, got %v", codes)
+	}
+
+	body := getMetrics(srv, "").Body.String()
+	for _, want := range []string{
+		"hlg_event_buffer_depth 2",
+		"hlg_event_buffer_capacity 2",
+		`hlg_rejected_requests_total{reason="buffer_full"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestEventBuffer_RunFlushesOnShutdown(t *testing.T) {
+	st := testutil.SetupTestStore(t)
+	cfg := server.DefaultConfig()
+	cfg.ListenAddr = freeAddr(t)
+	cfg.EventBufferSize = 100
+	cfg.EventFlushInterval = time.Hour
+	srv := server.NewWithConfig(st, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1", "variants": []string{"A", "B"},
+	})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	events, err := st.GetEvents(context.Background(), "hero")
+	if err != nil || len(events) != 1 {
+		t.Errorf("expected buffered event written on shutdown, got %d (%v)", len(events), err)
+	}
+}
+
+func TestEventBuffer_ConversionSeesBufferedView(t *testing.T) {
+	srv, s := setupLimitedServer(t, func(c *server.Config) {
+		c.EventBufferSize = 100
+		c.EventFlushInterval = time.Hour
+	})
+	defer srv.Close(context.Background())
+	ctx := context.Background()
+	key := createAPIKey(t, s)
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	if w := postBeacon(srv, map[string]interface{}{"t": "hero", "v": 1, "e": "view", "vid": "v1"}); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+
+	resp := decodeConversions(t, postConversions(srv, key, map[string]interface{}{"vid": "v1", "test": "hero"}))
+	if resp.Recorded != 1 {
+		t.Fatalf("expected the buffered view to credit the conversion, got %+v", resp)
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 1 || stats[0].Variant != 1 || stats[0].Conversions != 1 {
+		t.Errorf("expected the conversion on variant 1, got %+v", stats)
+	}
+}
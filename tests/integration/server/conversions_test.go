@@ -0,0 +1,140 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+func createAPIKey(t *testing.T, s *store.SQLiteStore) string {
+	t.Helper()
+	key, entry, err := server.GenerateAPIKey("test")
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if err := s.SetSettingList(context.Background(), store.SettingAPIKeys, []string{entry}); err != nil {
+		t.Fatalf("failed to save key: %v", err)
+	}
+	return key
+}
+
+func postConversions(srv *server.Server, key string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/api/conversions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func decodeConversions(t *testing.T, w *httptest.ResponseRecorder) server.ConversionResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp server.ConversionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestConversions_RequiresAPIKey(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	createAPIKey(t, s)
+
+	payload := map[string]interface{}{"vid": "v1", "test": "hero"}
+	if w := postConversions(srv, "", payload); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without key, got %d", w.Code)
+	}
+	if w := postConversions(srv, "hlg_00000000_bogus", payload); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with wrong key, got %d", w.Code)
+	}
+}
+
+func TestConversions_CreditsViewedVariant(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	key := createAPIKey(t, s)
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v1")
+
+	resp := decodeConversions(t, postConversions(srv, key, map[string]interface{}{
+		"vid": "v1", "test": "hero", "value": 99.0, "idempotency_key": "order-1",
+	}))
+	if resp.Recorded != 1 || resp.Results[0].Status != server.ConversionRecorded {
+		t.Fatalf("expected conversion recorded, got %+v", resp)
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 1 || stats[0].Variant != 1 || stats[0].Conversions != 1 || stats[0].Value != 99 {
+		t.Errorf("expected conversion worth 99 on variant 1, got %+v", stats)
+	}
+
+	// Retried delivery is reported as a duplicate
+	resp = decodeConversions(t, postConversions(srv, key, map[string]interface{}{
+		"vid": "v1", "test": "hero", "value": 99.0, "idempotency_key": "order-1",
+	}))
+	if resp.Duplicates != 1 {
+		t.Errorf("expected duplicate, got %+v", resp)
+	}
+}
+
+func TestConversions_UserIDAndGoal(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	key := createAPIKey(t, s)
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "checkout")
+	_, _ = s.CreateTest(ctx, "pricing", []string{"A", "B"}, nil, "checkout")
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "v1")
+	_ = s.LinkIdentity(ctx, "v1", "user-42")
+
+	resp := decodeConversions(t, postConversions(srv, key, map[string]interface{}{
+		"user_id": "user-42", "goal": "checkout",
+	}))
+	result := resp.Results[0]
+	if result.Status != server.ConversionRecorded || len(result.Tests) != 1 || result.Tests[0] != "hero" {
+		t.Errorf("expected conversion recorded for hero only, got %+v", result)
+	}
+}
+
+func TestConversions_Batch(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	key := createAPIKey(t, s)
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "v1")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v2")
+
+	resp := decodeConversions(t, postConversions(srv, key, map[string]interface{}{
+		"conversions": []map[string]interface{}{
+			{"vid": "v1", "test": "hero", "timestamp": 1700000000},
+			{"vid": "v2", "test": "hero"},
+			{"vid": "never-seen", "test": "hero"},
+			{"vid": "v1", "test": "missing"},
+		},
+	}))
+
+	want := []string{server.ConversionRecorded, server.ConversionRecorded, server.ConversionNotExposed, server.ConversionError}
+	for i, status := range want {
+		if resp.Results[i].Status != status {
+			t.Errorf("item %d: got status %q, want %q", i, resp.Results[i].Status, status)
+		}
+	}
+	if resp.Recorded != 2 || resp.Errors != 1 {
+		t.Errorf("got recorded=%d errors=%d, want 2 and 1", resp.Recorded, resp.Errors)
+	}
+}
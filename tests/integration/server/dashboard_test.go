@@ -4,8 +4,11 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
 )
 
 func TestDashboard_Unauthorized(t *testing.T) {
@@ -177,3 +180,136 @@ func TestDashboardTest_NotFound(t *testing.T) {
 		t.Errorf("expected status 404, got %d", w.Code)
 	}
 }
+
+func TestDashboard_ReportsUnattributedConversions(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "v1")
+	_ = s.RecordEvent(ctx, "hero", 1, "convert", "v1") // Shown A
+	_ = s.RecordEvent(ctx, "hero", 1, "convert", "v2") // Never viewed
+
+	get := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: "ht_token", Value: srv.Token()})
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	api := get("/dashboard/api/tests")
+	if !strings.Contains(api, `"conversions":0,`) || !strings.Contains(api, `"unattributed":1,"mismatched":1`) {
+		t.Errorf("expected excluded conversions in API results, got %s", api)
+	}
+
+	detail := get("/dashboard/test/hero")
+	if !strings.Contains(detail, "1 from visitors shown another variant") {
+		t.Error("expected detail page to report the mismatched conversion")
+	}
+}
+
+func TestDashboard_ReportsEventsPerVisitor(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "cta", []string{"A", "B"}, nil, "")
+	_ = s.SetTestCounting(ctx, "cta", store.CountEvery, 0)
+	_ = s.RecordEvent(ctx, "cta", 1, "view", "v1")
+	_ = s.RecordEvent(ctx, "cta", 1, "view", "v2")
+	for i := 0; i < 3; i++ {
+		_ = s.RecordEvent(ctx, "cta", 1, "convert", "v1")
+	}
+
+	get := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: "ht_token", Value: srv.Token()})
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	api := get("/dashboard/api/tests")
+	if !strings.Contains(api, `"count_mode":"every"`) || !strings.Contains(api, `"conversions":1,`) ||
+		!strings.Contains(api, `"events":3,"events_per_visitor":1.5`) {
+		t.Errorf("expected events per visitor in API results, got %s", api)
+	}
+
+	detail := get("/dashboard/test/cta")
+	if !strings.Contains(detail, "3 events, 1.50 per visitor") {
+		t.Error("expected detail page to report events per visitor")
+	}
+}
+
+func TestDashboard_SavesVariantPayloads(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "hero", "/", "h1", "", "")
+
+	post := func(payloads, origin string) *httptest.ResponseRecorder {
+		form := url.Values{"payloads": {payloads}}
+		req := httptest.NewRequest(http.MethodPost, "/dashboard/test/hero/variants", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		req.AddCookie(&http.Cookie{Name: "ht_token", Value: srv.Token()})
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`[{"type":"text","text":"A"},{"type":"html","html":"<em>B</em>"}]`, "http://example.com")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect after saving, got %d: %s", w.Code, w.Body.String())
+	}
+	if test, _ := s.GetTest(ctx, "hero"); len(test.Payloads) != 2 || test.Payloads[1].HTML != "<em>B</em>" {
+		t.Errorf("expected payloads saved, got %+v", test.Payloads)
+	}
+
+	// Invalid payloads show the page again with the error
+	w = post(`[{"type":"text","text":"A"},{"type":"html","html":"<script>x</script>"}]`, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "&lt;script&gt; is not allowed") {
+		t.Errorf("expected validation error on the page, got %d", w.Code)
+	}
+
+	// Forms posted from other sites are refused
+	if w := post(`["A","B"]`, "https://evil.example"); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 for cross-site post, got %d", w.Code)
+	}
+}
+
+func TestDashboard_ShowsMultiElementChanges(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "landing", []string{"A", "B"}, nil, "")
+	err := s.SetTestPayloads(ctx, "landing", []store.VariantPayload{
+		{Type: store.PayloadText, Text: "A"},
+		{Type: store.PayloadMulti, Label: "Speed", Changes: []store.ElementChange{
+			{Selector: "h1", VariantPayload: store.VariantPayload{Type: store.PayloadText, Text: "Ship faster"}},
+			{Selector: ".subhead", VariantPayload: store.VariantPayload{Type: store.PayloadText, Text: "Deploy in minutes"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("SetTestPayloads failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/test/landing", nil)
+	req.AddCookie(&http.Cookie{Name: "ht_token", Value: srv.Token()})
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	for _, want := range []string{`"Speed"`, "h1: Ship faster", ".subhead: Deploy in minutes"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected detail page to contain %q", want)
+		}
+	}
+}
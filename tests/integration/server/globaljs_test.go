@@ -1,6 +1,7 @@
 package server_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -130,3 +131,35 @@ func TestGlobalJS_MethodNotAllowed(t *testing.T) {
 		t.Errorf("expected status 405, got %d", w.Code)
 	}
 }
+
+func TestGlobalJS_InlinesPageTests(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"Ship Faster", "Build Better"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "hero", "/pricing", "h1", "", "")
+	_, _ = s.CreateTest(ctx, "home", []string{"A", "B"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "home", "/", "h1", "", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/hlg.js?url=/pricing", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `"url":"/pricing","tests":[{"name":"hero","variants":["Ship Faster","Build Better"],"target":"h1"}]`) {
+		t.Errorf("expected script to inline the page's tests, got %s", body[:200])
+	}
+	if strings.Contains(body, `"name":"home"`) {
+		t.Error("expected tests for other pages not to be inlined")
+	}
+
+	// Without ?url= the script fetches tests itself
+	req = httptest.NewRequest(http.MethodGet, "/hlg.js", nil)
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if strings.Contains(w.Body.String(), `"tests":`) {
+		t.Error("expected no inlined tests without ?url=")
+	}
+}
@@ -0,0 +1,76 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestGoalBeacon_ConvertsTestsWithGoal(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "signup")
+	_, _ = s.CreateTest(ctx, "pricing", []string{"A", "B"}, nil, "signup")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v1")
+
+	w := postBeacon(srv, map[string]interface{}{"g": "signup", "e": "convert", "vid": "v1", "val": 49.5})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Credited to the viewed variant; pricing was never shown
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 1 || stats[0].Variant != 1 || stats[0].Conversions != 1 || stats[0].Value != 49.5 {
+		t.Errorf("expected one conversion worth 49.5 on variant 1, got %+v", stats)
+	}
+	if stats, _ := s.GetVariantStats(ctx, "pricing"); len(stats) != 0 {
+		t.Errorf("expected no conversions for an unseen test, got %+v", stats)
+	}
+}
+
+func TestGoalBeacon_FallsBackToTestName(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "v1")
+
+	if w := postBeacon(srv, map[string]interface{}{"g": "hero", "e": "convert", "vid": "v1"}); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 1 || stats[0].Conversions != 1 {
+		t.Errorf("expected a conversion, got %+v", stats)
+	}
+
+	if w := postBeacon(srv, map[string]interface{}{"g": "nope", "e": "convert", "vid": "v1"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown goal, got %d", w.Code)
+	}
+	if w := postBeacon(srv, map[string]interface{}{"g": "hero", "e": "view", "vid": "v1"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a goal view, got %d", w.Code)
+	}
+}
+
+func TestGoalBeacon_RequiresSignaturesWhenSigning(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "signup")
+	enableSigning(t, s)
+
+	sv := signedView(t, srv, "v1", 1)
+
+	_ = postBeacon(srv, map[string]interface{}{"g": "signup", "e": "convert", "vid": "v1"})
+	if stats, _ := s.GetVariantStats(ctx, "hero"); stats[0].Conversions != 0 {
+		t.Fatalf("expected unsigned goal to be rejected, got %+v", stats)
+	}
+
+	_ = postBeacon(srv, map[string]interface{}{
+		"g": "signup", "e": "convert", "vid": "v1",
+		"sigs": map[string]interface{}{"hero": map[string]interface{}{"v": 1, "sig": sv.Signature, "exp": sv.Expires}},
+	})
+	if stats, _ := s.GetVariantStats(ctx, "hero"); stats[0].Conversions != 1 {
+		t.Errorf("expected signed goal to be recorded, got %+v", stats)
+	}
+}
@@ -0,0 +1,60 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+)
+
+func postIdentify(srv *server.Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestIdentify_ReturnsFirstAssignments(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	// Assigned B on the phone, then logs in there
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "phone")
+	if w := postIdentify(srv, `{"vid":"phone","uid":"user-1"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	// Logs in on the laptop, which was never assigned
+	w := postIdentify(srv, `{"vid":"laptop","uid":"user-1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp server.IdentifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if v, ok := resp.Assignments["hero"]; !ok || v != 1 {
+		t.Errorf("expected hero assignment 1, got %v", resp.Assignments)
+	}
+
+	ids, _ := s.GetVisitorIDs(ctx, "user-1")
+	if len(ids) != 2 {
+		t.Errorf("expected both visitors linked, got %v", ids)
+	}
+}
+
+func TestIdentify_MissingFields(t *testing.T) {
+	srv, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if w := postIdentify(srv, `{"vid":"phone"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/assign"
+)
+
+func TestTestsAPI_LayerReturnsOneTestPerVisitor(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	for _, name := range []string{"hero", "subhead"} {
+		_, _ = s.CreateTest(ctx, name, []string{"A", "B"}, nil, "")
+		_ = s.SetTestURLFields(ctx, name, "/", "h1", "", "")
+		_ = s.SetTestLayer(ctx, name, "landing")
+	}
+
+	for i := 0; i < 20; i++ {
+		vid := fmt.Sprintf("visitor-%d", i)
+		req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/&vid="+vid, nil)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+
+		var tests []struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&tests); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(tests) != 1 {
+			t.Fatalf("visitor %s: expected 1 test, got %d", vid, len(tests))
+		}
+
+		want := assign.LayerTest("landing", []string{"hero", "subhead"}, vid)
+		if tests[0].Name != want {
+			t.Errorf("visitor %s: got test %s, want %s", vid, tests[0].Name, want)
+		}
+	}
+}
+
+func TestTestsAPI_HoldoutReturnsNoTests(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "hero", "/", "h1", "", "")
+	_ = s.SetHoldoutPercent(ctx, 100)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/&vid=visitor-1", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var tests []interface{}
+	_ = json.NewDecoder(w.Body).Decode(&tests)
+	if len(tests) != 0 {
+		t.Errorf("expected holdout visitor to get 0 tests, got %d", len(tests))
+	}
+}
+
+func TestBeacon_IgnoresIneligibleVisitor(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	for _, name := range []string{"hero", "subhead"} {
+		_, _ = s.CreateTest(ctx, name, []string{"A", "B"}, nil, "")
+		_ = s.SetTestLayer(ctx, name, "landing")
+	}
+
+	// Find a visitor assigned to subhead, then send a hero beacon for them
+	vid := ""
+	for i := 0; vid == ""; i++ {
+		candidate := fmt.Sprintf("visitor-%d", i)
+		if assign.LayerTest("landing", []string{"hero", "subhead"}, candidate) == "subhead" {
+			vid = candidate
+		}
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"t": "hero", "v": 0, "e": "view", "vid": vid})
+	req := httptest.NewRequest(http.MethodPost, "/b", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 0 {
+		t.Errorf("expected no events recorded for ineligible visitor, got %v", stats)
+	}
+}
+
+func TestGlobalJS_EmbedsLayerConfig(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetTestLayer(ctx, "hero", "landing")
+	_ = s.SetHoldoutPercent(ctx, 5)
+
+	req := httptest.NewRequest(http.MethodGet, "/hlg.js", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `"holdout":5`) {
+		t.Error("expected script to embed holdout percent")
+	}
+	if !strings.Contains(body, `"landing":["hero"]`) {
+		t.Error("expected script to embed layer membership")
+	}
+}
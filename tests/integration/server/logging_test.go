@@ -0,0 +1,96 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+)
+
+// logEntries decodes JSON log lines written to buf
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func findEntry(entries []map[string]interface{}, msg string) map[string]interface{} {
+	for _, e := range entries {
+		if e["msg"] == msg {
+			return e
+		}
+	}
+	return nil
+}
+
+func TestLogging_AccessLogAndAutoCreate(t *testing.T) {
+	var buf bytes.Buffer
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {
+		c.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+		c.AccessLog = true
+	})
+
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1", "variants": []string{"A", "B"},
+	})
+
+	entries := logEntries(t, &buf)
+
+	created := findEntry(entries, "test auto-created")
+	if created == nil || created["test"] != "hero" || created["variants"] != float64(2) {
+		t.Errorf("expected auto-creation log, got %v", entries)
+	}
+
+	access := findEntry(entries, "request")
+	if access == nil {
+		t.Fatalf("expected access log, got %v", entries)
+	}
+	if access["method"] != "POST" || access["path"] != "/b" || access["status"] != float64(204) {
+		t.Errorf("unexpected access log %v", access)
+	}
+	if _, ok := access["duration"]; !ok {
+		t.Error("expected duration in access log")
+	}
+}
+
+func TestLogging_AccessLogOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {
+		c.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	})
+
+	getMetrics(srv, "")
+
+	if strings.Contains(buf.String(), `"msg":"request"`) {
+		t.Errorf("expected no access log, got %s", buf.String())
+	}
+}
+
+func TestLogging_SourceConflict(t *testing.T) {
+	var buf bytes.Buffer
+	srv, s := setupLimitedServer(t, func(c *server.Config) {
+		c.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	})
+	if _, err := s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, ""); err != nil {
+		t.Fatalf("failed to create test: %v", err)
+	}
+
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1", "variants": []string{"A", "B"},
+	})
+
+	if e := findEntry(logEntries(t, &buf), "source conflict: server-created test received a client beacon"); e == nil || e["level"] != "WARN" {
+		t.Errorf("expected source conflict warning, got %s", buf.String())
+	}
+}
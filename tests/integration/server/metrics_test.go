@@ -0,0 +1,97 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+)
+
+func getMetrics(srv *server.Server, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestMetrics_CountsBeaconsAndRequests(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {})
+
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1", "variants": []string{"A", "B"},
+	})
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 1, "e": "convert", "vid": "v1",
+	})
+	postBeacon(srv, map[string]interface{}{
+		"t": "missing", "v": 0, "e": "view", "vid": "v1",
+	})
+
+	w := getMetrics(srv, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`hlg_beacons_total{test="hero",event="view",outcome="recorded"} 1`,
+		`hlg_beacons_total{test="hero",event="convert",outcome="recorded"} 1`,
+		`hlg_beacons_total{test="",event="view",outcome="invalid"} 1`,
+		`hlg_tests_auto_created_total 1`,
+		`hlg_http_requests_total{route="/b",code="204"} 2`,
+		`hlg_http_requests_total{route="/b",code="400"} 1`,
+		`hlg_http_request_duration_seconds_count{route="/b"} 3`,
+		`hlg_http_request_duration_seconds_bucket{route="/b",le="+Inf"} 3`,
+		`hlg_store_write_duration_seconds_count{op="record_event"} 2`,
+		`hlg_tests_running 1`,
+		`# TYPE hlg_db_size_bytes gauge`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestMetrics_CountsRejections(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {
+		c.MaxVariants = 2
+	})
+
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1", "variants": []string{"A", "B", "C"},
+	})
+
+	body := getMetrics(srv, "").Body.String()
+	for _, want := range []string{
+		`hlg_rejected_requests_total{reason="too_many_variants"} 1`,
+		`hlg_beacons_total{test="",event="view",outcome="rejected"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestMetrics_RequiresTokenWhenConfigured(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {
+		c.MetricsToken = "scrape-secret"
+	})
+
+	if w := getMetrics(srv, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", w.Code)
+	}
+	if w := getMetrics(srv, "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with wrong token, got %d", w.Code)
+	}
+	if w := getMetrics(srv, "scrape-secret"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 with token, got %d", w.Code)
+	}
+}
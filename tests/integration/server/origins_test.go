@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+func beaconFromOrigin(srv *server.Server, origin, referer string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]interface{}{"t": "hero", "v": 0, "e": "view", "vid": "visitor123"})
+	req := httptest.NewRequest(http.MethodPost, "/b", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestOrigins_AllowedOriginEchoed(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetSettingList(ctx, store.SettingOrigins, []string{"https://example.com"})
+
+	w := beaconFromOrigin(srv, "https://example.com", "")
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("expected allowed origin to be echoed, got %q", got)
+	}
+}
+
+func TestOrigins_RejectsUnlistedOrigin(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetSettingList(ctx, store.SettingOrigins, []string{"https://example.com"})
+
+	for _, tc := range []struct{ origin, referer string }{
+		{"https://evil.example", ""},
+		{"", "https://evil.example/landing"},
+		{"null", ""},
+	} {
+		w := beaconFromOrigin(srv, tc.origin, tc.referer)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("origin=%q referer=%q: expected status 403, got %d", tc.origin, tc.referer, w.Code)
+		}
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 0 {
+		t.Errorf("expected no events recorded, got %v", stats)
+	}
+}
+
+func TestOrigins_AllowsServerSideBeacons(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetSettingList(ctx, store.SettingOrigins, []string{"https://example.com"})
+
+	// Servers send neither Origin nor Referer
+	w := beaconFromOrigin(srv, "", "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no CORS headers, got %q", got)
+	}
+}
+
+func TestOrigins_AllowlistIsCached(t *testing.T) {
+	now := time.Now()
+	srv, s := setupLimitedServer(t, func(c *server.Config) {
+		c.Now = func() time.Time { return now }
+	})
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetSettingList(ctx, store.SettingOrigins, []string{"https://example.com"})
+
+	if w := beaconFromOrigin(srv, "https://shop.example.com", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", w.Code)
+	}
+
+	_ = s.SetSettingList(ctx, store.SettingOrigins, []string{"https://example.com", "https://shop.example.com"})
+	if w := beaconFromOrigin(srv, "https://shop.example.com", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected the cached allowlist to still apply, got %d", w.Code)
+	}
+
+	now = now.Add(10 * time.Second)
+	if w := beaconFromOrigin(srv, "https://shop.example.com", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected the new origin to be allowed once the cache expires, got %d", w.Code)
+	}
+}
+
+func TestOrigins_FallsBackToReferer(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetSettingList(ctx, store.SettingOrigins, []string{"https://example.com"})
+
+	w := beaconFromOrigin(srv, "", "https://Example.com/pricing?ref=1")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+}
+
+func TestOrigins_TestBoundToOrigin(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetTestURLFields(ctx, "hero", "/", "h1", "", "")
+	_ = s.SetTestOrigins(ctx, "hero", []string{"https://shop.example.com"})
+
+	if w := beaconFromOrigin(srv, "https://blog.example.com", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 from unbound origin, got %d", w.Code)
+	}
+	if w := beaconFromOrigin(srv, "https://shop.example.com", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204 from bound origin, got %d", w.Code)
+	}
+
+	// /api/tests only returns the test to its bound origin
+	req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/", nil)
+	req.Header.Set("Origin", "https://blog.example.com")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var tests []interface{}
+	_ = json.NewDecoder(w.Body).Decode(&tests)
+	if len(tests) != 0 {
+		t.Errorf("expected bound test to be hidden from other origins, got %d tests", len(tests))
+	}
+}
+
+func TestOrigins_TestBoundToOriginAcceptsServerEvents(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "signup")
+	_ = s.SetTestOrigins(ctx, "hero", []string{"https://shop.example.com"})
+
+	// Backends send neither Origin nor Referer
+	if w := beaconFromOrigin(srv, "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204 for a server beacon, got %d", w.Code)
+	}
+	if w := postBeacon(srv, map[string]interface{}{"g": "signup", "e": "convert", "vid": "visitor123"}); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204 for a server goal, got %d", w.Code)
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 1 || stats[0].Views != 1 || stats[0].Conversions != 1 {
+		t.Errorf("expected the server view and goal to be recorded, got %+v", stats)
+	}
+}
+
+func TestNormalizeOrigin(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"https://Example.com", "https://example.com", true},
+		{"https://example.com/path?q=1", "https://example.com", true},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"example.com", "", false},
+		{"ftp://example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := server.NormalizeOrigin(tt.input)
+		if (err == nil) != tt.ok {
+			t.Errorf("NormalizeOrigin(%q) error = %v, want ok=%v", tt.input, err, tt.ok)
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeOrigin(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
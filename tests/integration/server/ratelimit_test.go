@@ -0,0 +1,176 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func setupLimitedServer(t *testing.T, modify func(*server.Config)) (*server.Server, *store.SQLiteStore) {
+	t.Helper()
+	s := testutil.SetupTestStore(t)
+
+	cfg := server.DefaultConfig()
+	modify(&cfg)
+	return server.NewWithConfig(s, cfg), s
+}
+
+func postBeacon(srv *server.Server, payload map[string]interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/b", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_RejectsBurstOverflow(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {
+		c.RateLimit = 1
+		c.RateBurst = 3
+	})
+
+	var codes []int
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/", nil)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("expected Retry-After header on 429")
+		}
+	}
+
+	want := []int{200, 200, 200, 429, 429}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("got status codes %v, want %v", codes, want)
+		}
+	}
+}
+
+func TestRateLimit_PerIP(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) {
+		c.RateLimit = 1
+		c.RateBurst = 1
+	})
+
+	for _, addr := range []string{"198.51.100.1:1000", "198.51.100.2:1000"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/tests?url=/", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", addr, w.Code)
+		}
+	}
+}
+
+func TestBeacon_RejectsOversizedBody(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) { c.MaxBodyBytes = 256 })
+
+	w := postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1",
+		"variants": []string{strings.Repeat("x", 300), "B"},
+	})
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", w.Code)
+	}
+}
+
+func TestBeacon_RejectsTooManyVariants(t *testing.T) {
+	srv, s := setupLimitedServer(t, func(c *server.Config) { c.MaxVariants = 3 })
+
+	w := postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1",
+		"variants": []string{"A", "B", "C", "D"},
+	})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+	if _, err := s.GetTest(context.Background(), "hero"); err != store.ErrNotFound {
+		t.Errorf("expected test not to be created, got err %v", err)
+	}
+}
+
+func TestBeacon_CapsDistinctClientTests(t *testing.T) {
+	srv, s := setupLimitedServer(t, func(c *server.Config) { c.MaxClientTests = 2 })
+
+	for i := 0; i < 3; i++ {
+		w := postBeacon(srv, map[string]interface{}{
+			"t": fmt.Sprintf("test-%d", i), "v": 0, "e": "view", "vid": "v1",
+			"variants": []string{"A", "B"},
+		})
+		if i < 2 && w.Code != http.StatusNoContent {
+			t.Errorf("test-%d: expected status 204, got %d", i, w.Code)
+		}
+		if i == 2 && w.Code != http.StatusForbidden {
+			t.Errorf("test-%d: expected status 403, got %d", i, w.Code)
+		}
+	}
+
+	// Beacons for existing client tests are still accepted
+	w := postBeacon(srv, map[string]interface{}{
+		"t": "test-0", "v": 1, "e": "view", "vid": "v2",
+		"variants": []string{"A", "B"},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("existing test: expected status 204, got %d", w.Code)
+	}
+
+	count, _ := s.CountTestsBySource(context.Background(), "client")
+	if count != 2 {
+		t.Errorf("expected 2 client tests, got %d", count)
+	}
+}
+
+func TestBeacon_LimitsAutoCreateRatePerIP(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) { c.AutoCreateRate = 2 })
+
+	var last int
+	for i := 0; i < 3; i++ {
+		w := postBeacon(srv, map[string]interface{}{
+			"t": fmt.Sprintf("test-%d", i), "v": 0, "e": "view", "vid": "v1",
+			"variants": []string{"A", "B"},
+		})
+		last = w.Code
+	}
+
+	if last != http.StatusTooManyRequests {
+		t.Errorf("expected third auto-create to get 429, got %d", last)
+	}
+}
+
+func TestHealth_ReportsRejectedRequests(t *testing.T) {
+	srv, _ := setupLimitedServer(t, func(c *server.Config) { c.MaxVariants = 2 })
+
+	postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 0, "e": "view", "vid": "v1",
+		"variants": []string{"A", "B", "C"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var health server.HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatalf("failed to decode health: %v", err)
+	}
+	if health.RejectedRequests["too_many_variants"] != 1 {
+		t.Errorf("expected 1 too_many_variants rejection, got %v", health.RejectedRequests)
+	}
+}
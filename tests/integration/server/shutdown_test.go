@@ -0,0 +1,64 @@
+package server_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestRun_ShutdownRemovesTokenFile(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	tokenFile := filepath.Join(t.TempDir(), ".hlg-token")
+
+	cfg := server.DefaultConfig()
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.TokenFile = tokenFile
+	srv := server.NewWithConfig(s, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	// Wait for the token file to appear
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(tokenFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("token file was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	if _, err := os.Stat(tokenFile); !os.IsNotExist(err) {
+		t.Error("expected token file to be removed on shutdown")
+	}
+}
+
+func TestRun_ListenError(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	cfg := server.DefaultConfig()
+	cfg.ListenAddr = "not-an-address"
+	srv := server.NewWithConfig(s, cfg)
+
+	if err := srv.Run(context.Background()); err == nil {
+		t.Error("expected error for invalid listen address")
+	}
+}
@@ -0,0 +1,119 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+func enableSigning(t *testing.T, s *store.SQLiteStore) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.SetSetting(ctx, store.SettingBeaconSecret, strings.Repeat("ab", 32)); err != nil {
+		t.Fatalf("failed to set secret: %v", err)
+	}
+	if err := s.SetSetting(ctx, store.SettingBeaconSigning, "on"); err != nil {
+		t.Fatalf("failed to enable signing: %v", err)
+	}
+}
+
+func signedView(t *testing.T, srv *server.Server, vid string, variant int) server.SignedView {
+	t.Helper()
+	w := postBeacon(srv, map[string]interface{}{"t": "hero", "v": variant, "e": "view", "vid": vid})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected view to return 200 with signature, got %d", w.Code)
+	}
+
+	var sv server.SignedView
+	if err := json.NewDecoder(w.Body).Decode(&sv); err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+	if sv.Signature == "" || sv.Expires <= time.Now().Unix() {
+		t.Fatalf("expected a valid signature, got %+v", sv)
+	}
+	return sv
+}
+
+func TestSigning_ConversionWithSignatureAccepted(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+	enableSigning(t, s)
+
+	sv := signedView(t, srv, "visitor123", 1)
+
+	w := postBeacon(srv, map[string]interface{}{
+		"t": "hero", "v": 1, "e": "convert", "vid": "visitor123",
+		"sig": sv.Signature, "exp": sv.Expires,
+	})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	stats, _ := s.GetVariantStats(context.Background(), "hero")
+	if len(stats) != 1 || stats[0].Conversions != 1 {
+		t.Errorf("expected 1 conversion, got %v", stats)
+	}
+}
+
+func TestSigning_RejectsForgedConversions(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+	enableSigning(t, s)
+
+	sv := signedView(t, srv, "visitor123", 0)
+
+	cases := map[string]map[string]interface{}{
+		"no signature":      {"t": "hero", "v": 0, "e": "convert", "vid": "visitor123"},
+		"other variant":     {"t": "hero", "v": 1, "e": "convert", "vid": "visitor123", "sig": sv.Signature, "exp": sv.Expires},
+		"other visitor":     {"t": "hero", "v": 0, "e": "convert", "vid": "someone-else", "sig": sv.Signature, "exp": sv.Expires},
+		"tampered expiry":   {"t": "hero", "v": 0, "e": "convert", "vid": "visitor123", "sig": sv.Signature, "exp": sv.Expires + 3600},
+		"expired signature": {"t": "hero", "v": 0, "e": "convert", "vid": "visitor123", "sig": sv.Signature, "exp": 1},
+	}
+
+	for name, payload := range cases {
+		if w := postBeacon(srv, payload); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d", name, w.Code)
+		}
+	}
+
+	stats, _ := s.GetVariantStats(context.Background(), "hero")
+	for _, st := range stats {
+		if st.Conversions != 0 {
+			t.Errorf("expected no conversions recorded, got %v", stats)
+		}
+	}
+}
+
+func TestSigning_OffByDefault(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	_, _ = s.CreateTest(context.Background(), "hero", []string{"A", "B"}, nil, "")
+
+	w := postBeacon(srv, map[string]interface{}{"t": "hero", "v": 0, "e": "convert", "vid": "visitor123"})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected unsigned conversion to be accepted when signing is off, got %d", w.Code)
+	}
+}
+
+func TestSigning_ScriptConfig(t *testing.T) {
+	srv, s, cleanup := setupTestServer(t)
+	defer cleanup()
+	enableSigning(t, s)
+
+	req := httptest.NewRequest(http.MethodGet, "/hlg.js", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), `"sign":true`) {
+		t.Error("expected script config to enable signing")
+	}
+}
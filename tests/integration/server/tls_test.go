@@ -0,0 +1,169 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/server"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+// writeCert writes a self-signed certificate for 127.0.0.1 with the given
+// serial number
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "hlg-test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func servedSerial(addr string) (int64, error) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestTLS_ServesAndReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, 1)
+
+	cfg := server.DefaultConfig()
+	cfg.ListenAddr = freeAddr(t)
+	cfg.TLSCertFile = certFile
+	cfg.TLSKeyFile = keyFile
+	cfg.TLSReloadInterval = 20 * time.Millisecond
+	cfg.HTTPRedirectAddr = freeAddr(t)
+	cfg.HSTSMaxAge = 24 * time.Hour
+	srv := server.NewWithConfig(testutil.SetupTestStore(t), cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, "TLS listener", func() bool {
+		serial, err := servedSerial(cfg.ListenAddr)
+		return err == nil && serial == 1
+	})
+
+	// HSTS header over HTTPS
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("https://" + cfg.ListenAddr + "/health")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=86400; includeSubDomains" {
+		t.Errorf("got HSTS header %q", got)
+	}
+
+	// Plain HTTP listener redirects to HTTPS
+	resp, err = client.Get("http://" + cfg.HTTPRedirectAddr + "/hlg.js?x=1")
+	if err != nil {
+		t.Fatalf("HTTP request failed: %v", err)
+	}
+	resp.Body.Close()
+	_, httpsPort, _ := net.SplitHostPort(cfg.ListenAddr)
+	want := fmt.Sprintf("https://127.0.0.1:%s/hlg.js?x=1", httpsPort)
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != want {
+		t.Errorf("expected 301 to %s, got %d %s", want, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// A renewed certificate is picked up without a restart
+	time.Sleep(10 * time.Millisecond) // ensure a newer mtime
+	writeCert(t, certFile, keyFile, 2)
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(certFile, future, future)
+	waitFor(t, "certificate reload", func() bool {
+		serial, err := servedSerial(cfg.ListenAddr)
+		return err == nil && serial == 2
+	})
+}
+
+func TestGlobalJS_RespectsForwardedProtoFromLocalProxy(t *testing.T) {
+	srv, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/hlg.js", nil)
+	req.Host = "hlg.example.com"
+	req.RemoteAddr = "127.0.0.1:5000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "https://hlg.example.com") {
+		t.Error("expected https server URL behind a local proxy")
+	}
+
+	// Ignored when the peer is not a local proxy
+	req.RemoteAddr = "203.0.113.9:5000"
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "http://hlg.example.com") {
+		t.Error("expected X-Forwarded-Proto from a public peer to be ignored")
+	}
+}
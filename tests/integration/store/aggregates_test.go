@@ -0,0 +1,199 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestAggregates_ConversionOnAnotherVariantIsMismatched(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	// The conversion arrives first, tagged with B; the view then shows A
+	_, _ = s.RecordConversion(ctx, store.Conversion{TestName: "hero", Variant: 1, VisitorID: "v1", Value: 40})
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "v1")
+
+	stats, err := s.GetVariantStats(ctx, "hero")
+	if err != nil {
+		t.Fatalf("GetVariantStats failed: %v", err)
+	}
+	want := []store.VariantStats{
+		{Variant: 0, Views: 1},
+		{Variant: 1, Mismatched: 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestAggregates_MatchRebuildFromEvents(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B", "C"}, nil, "")
+
+	day1 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	_ = s.RecordEvents(ctx, []store.Event{
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "v1", CreatedAt: day1},
+		{TestName: "hero", Variant: 1, EventType: "view", VisitorID: "v2", CreatedAt: day1},
+		{TestName: "hero", Variant: 2, EventType: "convert", VisitorID: "v3", CreatedAt: day1},
+		{TestName: "hero", Variant: 0, EventType: "convert", VisitorID: "v1", CreatedAt: day2},
+		{TestName: "hero", Variant: 1, EventType: "view", VisitorID: "v2", CreatedAt: day2}, // Duplicate
+	})
+	_, _ = s.RecordConversion(ctx, store.Conversion{TestName: "hero", Variant: 1, VisitorID: "v2", Value: 12.5, Timestamp: day2})
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v3") // Shown B after converting on C
+
+	before, err := s.GetVariantStats(ctx, "hero")
+	if err != nil {
+		t.Fatalf("GetVariantStats failed: %v", err)
+	}
+	want := []store.VariantStats{
+		{Variant: 0, Views: 1, Conversions: 1},
+		{Variant: 1, Views: 2, Conversions: 1, Value: 12.5},
+		{Variant: 2, Mismatched: 1},
+	}
+	if !reflect.DeepEqual(before, want) {
+		t.Fatalf("got %+v, want %+v", before, want)
+	}
+
+	if err := s.RebuildAggregates(ctx, "hero"); err != nil {
+		t.Fatalf("RebuildAggregates failed: %v", err)
+	}
+	after, _ := s.GetVariantStats(ctx, "hero")
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("rebuild changed stats: before %+v, after %+v", before, after)
+	}
+}
+
+func TestAggregates_ViewArrivingAfterItsConversion(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetTestCounting(ctx, "hero", store.CountEvery, 0)
+
+	// A batch delivers the conversions before the view that preceded them
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	_ = s.RecordEvents(ctx, []store.Event{
+		{TestName: "hero", Variant: 1, EventType: "convert", VisitorID: "v1", CreatedAt: t0.Add(time.Minute)},
+		{TestName: "hero", Variant: 1, EventType: "convert", VisitorID: "v1", CreatedAt: t0.Add(2 * time.Minute)},
+	})
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if want := []store.VariantStats{{Variant: 1, Unattributed: 1}}; !reflect.DeepEqual(stats, want) {
+		t.Fatalf("before the view: got %+v, want %+v", stats, want)
+	}
+
+	_ = s.RecordEvents(ctx, []store.Event{{TestName: "hero", Variant: 1, EventType: "view", VisitorID: "v1", CreatedAt: t0}})
+	stats, _ = s.GetVariantStats(ctx, "hero")
+	want := []store.VariantStats{{Variant: 1, Views: 1, Conversions: 1, Events: 2, EventsSumSq: 4}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("after the view: got %+v, want %+v", stats, want)
+	}
+
+	if err := s.RebuildAggregates(ctx, "hero"); err != nil {
+		t.Fatalf("RebuildAggregates failed: %v", err)
+	}
+	if after, _ := s.GetVariantStats(ctx, "hero"); !reflect.DeepEqual(after, want) {
+		t.Errorf("rebuild changed stats: got %+v, want %+v", after, want)
+	}
+}
+
+func TestGetAllVariantStats_MatchesPerTest(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_, _ = s.CreateTest(ctx, "cta", []string{"X", "Y"}, nil, "")
+	_, _ = s.CreateTest(ctx, "empty", []string{"A", "B"}, nil, "")
+
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "mobile")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "desktop")
+	_ = s.RecordEvent(ctx, "hero", 1, "convert", "desktop")
+	_ = s.RecordEvent(ctx, "cta", 1, "view", "mobile")
+	_ = s.RecordEvent(ctx, "cta", 0, "view", "other")
+	_ = s.LinkIdentity(ctx, "mobile", "user-1")
+	_ = s.LinkIdentity(ctx, "desktop", "user-1")
+
+	all, err := s.GetAllVariantStats(ctx)
+	if err != nil {
+		t.Fatalf("GetAllVariantStats failed: %v", err)
+	}
+	if _, ok := all["empty"]; ok {
+		t.Error("expected tests without events to be omitted")
+	}
+	for _, name := range []string{"hero", "cta"} {
+		single, _ := s.GetVariantStats(ctx, name)
+		if !reflect.DeepEqual(all[name], single) {
+			t.Errorf("%s: bulk %+v, per-test %+v", name, all[name], single)
+		}
+	}
+
+	// The stitched user counts once on hero, on the first variant seen,
+	// and converting on the other one is an anomaly
+	want := []store.VariantStats{{Variant: 0, Views: 1}, {Variant: 1, Mismatched: 1}}
+	if !reflect.DeepEqual(all["hero"], want) {
+		t.Errorf("hero: got %+v, want %+v", all["hero"], want)
+	}
+}
+
+func TestAggregates_BackfilledOnOpen(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	s, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v1")
+	_ = s.RecordEvent(ctx, "hero", 1, "convert", "v1")
+	s.Close()
+
+	// Simulate a database from before aggregates existed
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.Exec(`DELETE FROM variant_daily`)
+	db.Exec(`DELETE FROM settings WHERE key = 'aggregates_version'`)
+	db.Close()
+
+	s, err = store.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer s.Close()
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	want := []store.VariantStats{{Variant: 1, Views: 1, Conversions: 1}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestDeleteTest_ClearsAggregates(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "v1")
+
+	if err := s.DeleteTest(ctx, "hero"); err != nil {
+		t.Fatalf("DeleteTest failed: %v", err)
+	}
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 0 {
+		t.Errorf("expected no stats for recreated test, got %+v", stats)
+	}
+}
@@ -0,0 +1,167 @@
+package store_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestAttribution_RequiresPriorViewOfSameVariant(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	_ = s.RecordEvents(ctx, []store.Event{
+		// Counted
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "ok", CreatedAt: t0},
+		{TestName: "hero", Variant: 0, EventType: "convert", VisitorID: "ok", CreatedAt: t0.Add(time.Hour)},
+		// Never viewed
+		{TestName: "hero", Variant: 1, EventType: "convert", VisitorID: "no-view", CreatedAt: t0},
+		// Viewed only after converting
+		{TestName: "hero", Variant: 1, EventType: "convert", VisitorID: "late-view", CreatedAt: t0},
+		{TestName: "hero", Variant: 1, EventType: "view", VisitorID: "late-view", CreatedAt: t0.Add(time.Hour)},
+		// Shown A, converted on B
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "mismatch", CreatedAt: t0},
+		{TestName: "hero", Variant: 1, EventType: "convert", VisitorID: "mismatch", CreatedAt: t0.Add(time.Hour)},
+	})
+
+	stats, err := s.GetVariantStats(ctx, "hero")
+	if err != nil {
+		t.Fatalf("GetVariantStats failed: %v", err)
+	}
+	want := []store.VariantStats{
+		{Variant: 0, Views: 2, Conversions: 1},
+		{Variant: 1, Views: 1, Unattributed: 2, Mismatched: 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestAttribution_Window(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	_ = s.RecordEvents(ctx, []store.Event{
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "fast", CreatedAt: t0},
+		{TestName: "hero", Variant: 0, EventType: "convert", VisitorID: "fast", CreatedAt: t0.Add(time.Hour)},
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "slow", CreatedAt: t0},
+		{TestName: "hero", Variant: 0, EventType: "convert", VisitorID: "slow", CreatedAt: t0.Add(72 * time.Hour)},
+	})
+
+	if err := s.SetAttributionWindow(ctx, 24*time.Hour); err != nil {
+		t.Fatalf("SetAttributionWindow failed: %v", err)
+	}
+	if window, _ := s.GetAttributionWindow(ctx); window != 24*time.Hour {
+		t.Errorf("expected 24h window, got %s", window)
+	}
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	want := []store.VariantStats{{Variant: 0, Views: 2, Conversions: 1, Unattributed: 1}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("with window: got %+v, want %+v", stats, want)
+	}
+
+	// Removing the window applies to past events too
+	_ = s.SetAttributionWindow(ctx, 0)
+	stats, _ = s.GetVariantStats(ctx, "hero")
+	want = []store.VariantStats{{Variant: 0, Views: 2, Conversions: 2}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("without window: got %+v, want %+v", stats, want)
+	}
+
+	if err := s.SetAttributionWindow(ctx, -time.Hour); err == nil {
+		t.Error("expected negative window to be rejected")
+	}
+}
+
+func TestAttribution_StitchedUsersUseTheirEarliestView(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.SetAttributionWindow(ctx, 24*time.Hour)
+
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	_ = s.RecordEvents(ctx, []store.Event{
+		// user-1 sees A on mobile, again on desktop two days later, and
+		// converts on desktop within the day
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "mobile", CreatedAt: t0},
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "desktop", CreatedAt: t0.Add(48 * time.Hour)},
+		{TestName: "hero", Variant: 0, EventType: "convert", VisitorID: "desktop", CreatedAt: t0.Add(49 * time.Hour)},
+	})
+	_ = s.LinkIdentity(ctx, "mobile", "user-1")
+	_ = s.LinkIdentity(ctx, "desktop", "user-1")
+
+	// The window runs from the user's first view, so the conversion is late
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	want := []store.VariantStats{{Variant: 0, Views: 1, Unattributed: 1}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestAttribution_WindowAppliesToRolledUpViews(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	seedRetention(t, s, now)
+
+	_ = s.SetRetentionDays(ctx, 30)
+	_, _ = s.ApplyRetention(ctx, now, false)
+
+	// old-b's view from 60 days ago was rolled up
+	_ = s.RecordEvent(ctx, "hero", 1, "convert", "old-b")
+	_ = s.SetAttributionWindow(ctx, 7*24*time.Hour)
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	want := []store.VariantStats{
+		{Variant: 0, Views: 1, Conversions: 1},
+		{Variant: 1, Views: 2, Unattributed: 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestAttribution_SettledWhenRolledUp(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	seedRetention(t, s, now)
+
+	old := now.AddDate(0, 0, -60)
+	_ = s.RecordEvents(ctx, []store.Event{
+		{TestName: "hero", Variant: 0, EventType: "convert", VisitorID: "old-b", CreatedAt: old}, // Shown B
+		{TestName: "hero", Variant: 1, EventType: "convert", VisitorID: "old-d", CreatedAt: old}, // Never viewed
+	})
+
+	before, _ := s.GetVariantStats(ctx, "hero")
+	want := []store.VariantStats{
+		{Variant: 0, Views: 1, Conversions: 1, Mismatched: 1},
+		{Variant: 1, Views: 2, Unattributed: 1},
+	}
+	if !reflect.DeepEqual(before, want) {
+		t.Fatalf("got %+v, want %+v", before, want)
+	}
+
+	_ = s.SetRetentionDays(ctx, 30)
+	if _, err := s.ApplyRetention(ctx, now, false); err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	after, _ := s.GetVariantStats(ctx, "hero")
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("retention changed results: before %+v, after %+v", before, after)
+	}
+
+	_ = s.RebuildAggregates(ctx, "")
+	rebuilt, _ := s.GetVariantStats(ctx, "hero")
+	if !reflect.DeepEqual(rebuilt, before) {
+		t.Errorf("rebuild changed results: before %+v, after %+v", before, rebuilt)
+	}
+}
@@ -0,0 +1,150 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+func openStore(t *testing.T, path string) *store.SQLiteStore {
+	t.Helper()
+	s, err := store.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestBackup_WritesVerifiableCopy(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, filepath.Join(dir, "hlg.db"))
+	ctx := context.Background()
+
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v1")
+
+	for _, name := range []string{"copy.db", "copy.db.gz"} {
+		path := filepath.Join(dir, name)
+		if err := s.Backup(ctx, path, filepath.Ext(name) == ".gz"); err != nil {
+			t.Fatalf("Backup(%s) failed: %v", name, err)
+		}
+		if err := store.VerifyBackup(ctx, path); err != nil {
+			t.Errorf("VerifyBackup(%s) failed: %v", name, err)
+		}
+		if err := s.Backup(ctx, path, false); err == nil {
+			t.Errorf("expected Backup to refuse to overwrite %s", name)
+		}
+	}
+
+	copied := openStore(t, filepath.Join(dir, "copy.db"))
+	stats, err := copied.GetVariantStats(ctx, "hero")
+	if err != nil || len(stats) != 1 || stats[0].Views != 1 {
+		t.Errorf("backup is missing data: %+v (%v)", stats, err)
+	}
+}
+
+func TestRestore_SwapsInBackupAndKeepsPrevious(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "hlg.db")
+	backupPath := filepath.Join(dir, "backup.db.gz")
+	ctx := context.Background()
+
+	s, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	if err := s.Backup(ctx, backupPath, true); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	_, _ = s.CreateTest(ctx, "later", []string{"A", "B"}, nil, "")
+	s.Close()
+
+	previous, err := store.Restore(ctx, backupPath, dbPath)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	restored := openStore(t, dbPath)
+	if _, err := restored.GetTest(ctx, "hero"); err != nil {
+		t.Errorf("expected restored test, got %v", err)
+	}
+	if _, err := restored.GetTest(ctx, "later"); err != store.ErrNotFound {
+		t.Errorf("expected test created after the backup to be gone, got %v", err)
+	}
+
+	kept := openStore(t, previous)
+	if _, err := kept.GetTest(ctx, "later"); err != nil {
+		t.Errorf("expected previous database at %s, got %v", previous, err)
+	}
+}
+
+func TestRestore_KeepsWriteAheadLogOfPrevious(t *testing.T) {
+	dir := t.TempDir()
+	livePath := filepath.Join(dir, "live.db")
+	dbPath := filepath.Join(dir, "hlg.db")
+	backupPath := filepath.Join(dir, "backup.db")
+	ctx := context.Background()
+
+	s := openStore(t, livePath)
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	if err := s.Backup(ctx, backupPath, false); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	_, _ = s.CreateTest(ctx, "later", []string{"A", "B"}, nil, "")
+
+	// Copy the files of the open database, as left by a crashed server,
+	// so "later" is only in the write-ahead log
+	for _, suffix := range []string{"", "-wal"} {
+		data, err := os.ReadFile(livePath + suffix)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", livePath+suffix, err)
+		}
+		if err := os.WriteFile(dbPath+suffix, data, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", dbPath+suffix, err)
+		}
+	}
+
+	previous, err := store.Restore(ctx, backupPath, dbPath)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := os.Stat(previous + "-wal"); err == nil {
+		t.Errorf("expected the previous database's log to be folded in, found %s-wal", previous)
+	}
+	kept := openStore(t, previous)
+	if _, err := kept.GetTest(ctx, "later"); err != nil {
+		t.Errorf("expected the previous database to keep its logged test, got %v", err)
+	}
+}
+
+func TestRestore_RejectsInvalidBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "hlg.db")
+	ctx := context.Background()
+
+	s, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	s.Close()
+
+	bad := filepath.Join(dir, "bad.db")
+	_ = os.WriteFile(bad, []byte("not a database"), 0o644)
+	if _, err := store.Restore(ctx, bad, dbPath); err == nil {
+		t.Fatal("expected Restore to reject an invalid backup")
+	}
+
+	current := openStore(t, dbPath)
+	if _, err := current.GetTest(ctx, "hero"); err != nil {
+		t.Errorf("expected database to be untouched, got %v", err)
+	}
+	if matches, _ := filepath.Glob(dbPath + ".*"); len(matches) != 0 {
+		t.Errorf("expected no leftover files, got %v", matches)
+	}
+}
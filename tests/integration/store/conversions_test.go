@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestRecordConversion_IdempotencyKey(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v1")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v2")
+
+	c := store.Conversion{TestName: "hero", Variant: 1, VisitorID: "v1", Value: 49.5, IdempotencyKey: "order-1"}
+	recorded, err := s.RecordConversion(ctx, c)
+	if err != nil {
+		t.Fatalf("RecordConversion failed: %v", err)
+	}
+	if !recorded {
+		t.Fatal("expected first conversion to be recorded")
+	}
+
+	// Same key for a different visitor is still a duplicate
+	c.VisitorID = "v2"
+	recorded, err = s.RecordConversion(ctx, c)
+	if err != nil {
+		t.Fatalf("RecordConversion failed: %v", err)
+	}
+	if recorded {
+		t.Error("expected repeated idempotency key to be ignored")
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	if len(stats) != 1 || stats[0].Conversions != 1 || stats[0].Value != 49.5 {
+		t.Errorf("got stats %+v, want one conversion worth 49.5", stats)
+	}
+}
+
+func TestGetVisitorVariant(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "v1")
+
+	variant, err := s.GetVisitorVariant(ctx, "hero", "v1")
+	if err != nil {
+		t.Fatalf("GetVisitorVariant failed: %v", err)
+	}
+	if variant != 1 {
+		t.Errorf("got variant %d, want 1", variant)
+	}
+
+	if _, err := s.GetVisitorVariant(ctx, "hero", "unknown"); err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_ = s.LinkIdentity(ctx, "laptop", "user-1")
+	_ = s.LinkIdentity(ctx, "phone", "user-1")
+	_ = s.LinkIdentity(ctx, "other", "user-2")
+	// A visitor keeps the first user it was linked to
+	_ = s.LinkIdentity(ctx, "phone", "user-2")
+
+	ids, err := s.GetVisitorIDs(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("GetVisitorIDs failed: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "laptop" || ids[1] != "phone" {
+		t.Errorf("got %v, want [laptop phone]", ids)
+	}
+}
+
+func TestGetTestsByGoal(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "checkout")
+	_, _ = s.CreateTest(ctx, "pricing", []string{"A", "B"}, nil, "checkout")
+	_, _ = s.CreateTest(ctx, "signup", []string{"A", "B"}, nil, "activation")
+	_ = s.SetWinner(ctx, "pricing", 0)
+
+	tests, err := s.GetTestsByGoal(ctx, "checkout")
+	if err != nil {
+		t.Fatalf("GetTestsByGoal failed: %v", err)
+	}
+	if len(tests) != 1 || tests[0].Name != "hero" {
+		t.Errorf("expected only running test hero, got %d tests", len(tests))
+	}
+}
@@ -0,0 +1,178 @@
+package store_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+// seedRepeats records v1 converting 3 times on A, v2 once and v3 5 times on
+// B, and v4 converting without a view
+func seedRepeats(t *testing.T, s *store.SQLiteStore, at time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.CreateTest(ctx, "cta", []string{"A", "B"}, nil, ""); err != nil {
+		t.Fatalf("failed to create test: %v", err)
+	}
+
+	events := []store.Event{
+		{TestName: "cta", Variant: 0, EventType: "view", VisitorID: "v1", CreatedAt: at},
+		{TestName: "cta", Variant: 1, EventType: "view", VisitorID: "v2", CreatedAt: at},
+		{TestName: "cta", Variant: 1, EventType: "view", VisitorID: "v3", CreatedAt: at},
+		{TestName: "cta", Variant: 1, EventType: "convert", VisitorID: "v4", CreatedAt: at},
+	}
+	repeats := map[string]int{"v1": 3, "v2": 1, "v3": 5}
+	for _, visitor := range []string{"v1", "v2", "v3"} {
+		variant := 1
+		if visitor == "v1" {
+			variant = 0
+		}
+		for i := 0; i < repeats[visitor]; i++ {
+			events = append(events, store.Event{
+				TestName: "cta", Variant: variant, EventType: "convert", VisitorID: visitor,
+				CreatedAt: at.Add(time.Duration(i+1) * time.Minute),
+			})
+		}
+	}
+	if err := s.RecordEvents(ctx, events); err != nil {
+		t.Fatalf("failed to record events: %v", err)
+	}
+}
+
+func TestCounting_Modes(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	seedRepeats(t, s, time.Now().Add(-time.Hour))
+
+	// Unique counting is unchanged by repeats
+	stats, _ := s.GetVariantStats(ctx, "cta")
+	want := []store.VariantStats{
+		{Variant: 0, Views: 1, Conversions: 1},
+		{Variant: 1, Views: 2, Conversions: 2, Unattributed: 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("unique: got %+v, want %+v", stats, want)
+	}
+
+	if err := s.SetTestCounting(ctx, "cta", store.CountEvery, 0); err != nil {
+		t.Fatalf("SetTestCounting failed: %v", err)
+	}
+	test, _ := s.GetTest(ctx, "cta")
+	if test.CountMode != store.CountEvery {
+		t.Errorf("expected count mode every, got %q", test.CountMode)
+	}
+	stats, _ = s.GetVariantStats(ctx, "cta")
+	want[0].Events, want[0].EventsSumSq = 3, 9
+	want[1].Events, want[1].EventsSumSq = 6, 1+25
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("every: got %+v, want %+v", stats, want)
+	}
+
+	_ = s.SetTestCounting(ctx, "cta", store.CountCapped, 2)
+	all, _ := s.GetAllVariantStats(ctx)
+	want[0].Events, want[0].EventsSumSq = 2, 4
+	want[1].Events, want[1].EventsSumSq = 3, 1+4
+	if !reflect.DeepEqual(all["cta"], want) {
+		t.Errorf("capped: got %+v, want %+v", all["cta"], want)
+	}
+}
+
+func TestCounting_Validation(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "cta", []string{"A", "B"}, nil, "")
+
+	if err := s.SetTestCounting(ctx, "cta", store.CountCapped, 0); err == nil {
+		t.Error("expected error for a cap below 1")
+	}
+	if err := s.SetTestCounting(ctx, "cta", "sometimes", 0); err == nil {
+		t.Error("expected error for an unknown mode")
+	}
+	if err := s.SetTestCounting(ctx, "missing", store.CountEvery, 0); err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	test, _ := s.GetTest(ctx, "cta")
+	if test.CountMode != store.CountUnique {
+		t.Errorf("expected default count mode unique, got %q", test.CountMode)
+	}
+}
+
+func TestRecordConversion_RecordsRepeats(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "checkout", []string{"A", "B"}, nil, "")
+	_ = s.SetTestCounting(ctx, "checkout", store.CountEvery, 0)
+	_ = s.RecordEvent(ctx, "checkout", 1, "view", "v1")
+
+	for _, key := range []string{"order-1", "order-2", "order-2"} {
+		_, err := s.RecordConversion(ctx, store.Conversion{
+			TestName: "checkout", Variant: 1, VisitorID: "v1", Value: 10, IdempotencyKey: key,
+		})
+		if err != nil {
+			t.Fatalf("RecordConversion failed: %v", err)
+		}
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "checkout")
+	want := []store.VariantStats{{Variant: 1, Views: 1, Conversions: 1, Value: 10, Events: 2, EventsSumSq: 4}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestRecordEvents_IgnoresRepeatedKeys(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "checkout", []string{"A", "B"}, nil, "")
+	_ = s.SetTestCounting(ctx, "checkout", store.CountEvery, 0)
+
+	batch := []store.Event{
+		{TestName: "checkout", Variant: 1, EventType: "view", VisitorID: "v1", IdempotencyKey: "k1"},
+		{TestName: "checkout", Variant: 1, EventType: "convert", VisitorID: "v1", IdempotencyKey: "k2"},
+		{TestName: "checkout", Variant: 1, EventType: "convert", VisitorID: "v1", IdempotencyKey: "k3"},
+	}
+	// The same batch sent twice, as after a retry
+	for i := 0; i < 2; i++ {
+		if err := s.RecordEvents(ctx, batch); err != nil {
+			t.Fatalf("RecordEvents failed: %v", err)
+		}
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "checkout")
+	want := []store.VariantStats{{Variant: 1, Views: 1, Conversions: 1, Events: 2, EventsSumSq: 4}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestCounting_KeptWhenRolledUp(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	seedRepeats(t, s, now.AddDate(0, 0, -60))
+	_ = s.SetTestCounting(ctx, "cta", store.CountEvery, 0)
+
+	before, _ := s.GetVariantStats(ctx, "cta")
+
+	_ = s.SetRetentionDays(ctx, 30)
+	if _, err := s.ApplyRetention(ctx, now, false); err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+
+	after, _ := s.GetVariantStats(ctx, "cta")
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("results changed: before %+v, after %+v", before, after)
+	}
+
+	// Later repeats add to the rolled-up count
+	_ = s.RecordEvent(ctx, "cta", 0, "convert", "v1")
+	after, _ = s.GetVariantStats(ctx, "cta")
+	if after[0].Events != 4 || after[0].EventsSumSq != 16 || after[0].Conversions != 1 {
+		t.Errorf("expected 4 events and 1 conversion for A, got %+v", after[0])
+	}
+}
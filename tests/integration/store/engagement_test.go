@@ -0,0 +1,62 @@
+package store_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestSetTestEngagement(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	goal := &store.EngagementGoal{Type: store.GoalVisible, Selector: "#pricing"}
+	if err := s.SetTestEngagement(ctx, "hero", goal); err != nil {
+		t.Fatalf("SetTestEngagement failed: %v", err)
+	}
+	test, _ := s.GetTest(ctx, "hero")
+	if !reflect.DeepEqual(test.Engagement, goal) {
+		t.Errorf("got %+v, want %+v", test.Engagement, goal)
+	}
+
+	if err := s.SetTestEngagement(ctx, "hero", nil); err != nil {
+		t.Fatalf("clearing engagement failed: %v", err)
+	}
+	if test, _ := s.GetTest(ctx, "hero"); test.Engagement != nil {
+		t.Errorf("expected engagement cleared, got %+v", test.Engagement)
+	}
+
+	if err := s.SetTestEngagement(ctx, "missing", goal); err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestEngagementGoal_Validate(t *testing.T) {
+	valid := []store.EngagementGoal{
+		{Type: store.GoalScroll, Percent: 75},
+		{Type: store.GoalDwell, Seconds: 30},
+		{Type: store.GoalVisible, Selector: "#pricing"},
+		{Type: store.GoalSubmit, Selector: "form.signup"},
+	}
+	for _, g := range valid {
+		if err := g.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", g, err)
+		}
+	}
+
+	invalid := []store.EngagementGoal{
+		{Type: store.GoalScroll, Percent: 120},
+		{Type: store.GoalDwell},
+		{Type: store.GoalSubmit},
+		{Type: "hover", Selector: "h1"},
+	}
+	for _, g := range invalid {
+		if err := g.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", g)
+		}
+	}
+}
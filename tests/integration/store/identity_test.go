@@ -0,0 +1,62 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestGetVariantStats_DedupesPerIdentity(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	// Same user views A on mobile first, then B on desktop, and converts
+	// on mobile
+	_ = s.RecordEvent(ctx, "hero", 0, "view", "mobile")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "desktop")
+	_ = s.RecordEvent(ctx, "hero", 0, "convert", "mobile")
+	_ = s.LinkIdentity(ctx, "mobile", "user-1")
+	_ = s.LinkIdentity(ctx, "desktop", "user-1")
+
+	// An anonymous visitor on B
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "anon")
+
+	stats, err := s.GetVariantStats(ctx, "hero")
+	if err != nil {
+		t.Fatalf("GetVariantStats failed: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 variants, got %+v", stats)
+	}
+
+	// First assignment wins: the user counts once, on A, with the conversion
+	if stats[0].Variant != 0 || stats[0].Views != 1 || stats[0].Conversions != 1 {
+		t.Errorf("variant A: got %+v, want 1 view and 1 conversion", stats[0])
+	}
+	if stats[1].Variant != 1 || stats[1].Views != 1 || stats[1].Conversions != 0 {
+		t.Errorf("variant B: got %+v, want 1 view and 0 conversions", stats[1])
+	}
+}
+
+func TestGetUserAssignments(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+	_, _ = s.CreateTest(ctx, "cta", []string{"A", "B"}, nil, "")
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "mobile")
+	_ = s.RecordEvent(ctx, "cta", 0, "view", "desktop")
+	_ = s.LinkIdentity(ctx, "mobile", "user-1")
+	_ = s.LinkIdentity(ctx, "desktop", "user-1")
+
+	got, err := s.GetUserAssignments(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("GetUserAssignments failed: %v", err)
+	}
+	if len(got) != 2 || got["hero"] != 1 || got["cta"] != 0 {
+		t.Errorf("got %v, want map[cta:0 hero:1]", got)
+	}
+}
@@ -0,0 +1,83 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestSetTestLayer(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	if err := s.SetTestLayer(ctx, "hero", "landing"); err != nil {
+		t.Fatalf("SetTestLayer failed: %v", err)
+	}
+
+	test, err := s.GetTest(ctx, "hero")
+	if err != nil {
+		t.Fatalf("GetTest failed: %v", err)
+	}
+	if test.Layer != "landing" {
+		t.Errorf("got Layer %q, want landing", test.Layer)
+	}
+}
+
+func TestSetTestLayer_NotFound(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	err := s.SetTestLayer(context.Background(), "missing", "landing")
+	if err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetLayers_OnlyRunningTestsSortedByName(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	for _, name := range []string{"subhead", "hero", "cta"} {
+		_, _ = s.CreateTest(ctx, name, []string{"A", "B"}, nil, "")
+		_ = s.SetTestLayer(ctx, name, "landing")
+	}
+	_ = s.SetWinner(ctx, "cta", 0)
+
+	layers, err := s.GetLayers(ctx)
+	if err != nil {
+		t.Fatalf("GetLayers failed: %v", err)
+	}
+
+	got := layers["landing"]
+	if len(got) != 2 || got[0] != "hero" || got[1] != "subhead" {
+		t.Errorf("got layer tests %v, want [hero subhead]", got)
+	}
+}
+
+func TestHoldoutPercent(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	pct, err := s.GetHoldoutPercent(ctx)
+	if err != nil {
+		t.Fatalf("GetHoldoutPercent failed: %v", err)
+	}
+	if pct != 0 {
+		t.Errorf("expected default holdout 0, got %g", pct)
+	}
+
+	if err := s.SetHoldoutPercent(ctx, 12.5); err != nil {
+		t.Fatalf("SetHoldoutPercent failed: %v", err)
+	}
+	pct, _ = s.GetHoldoutPercent(ctx)
+	if pct != 12.5 {
+		t.Errorf("got holdout %g, want 12.5", pct)
+	}
+
+	if err := s.SetHoldoutPercent(ctx, 150); err == nil {
+		t.Error("expected error for holdout above 100")
+	}
+}
@@ -0,0 +1,177 @@
+package store_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+func TestSetTestPayloads(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"Ship Faster", "Build Better"}, nil, "")
+
+	payloads := []store.VariantPayload{
+		{Type: store.PayloadText, Text: "Ship Faster"},
+		{Type: store.PayloadHTML, HTML: "Build <EM>better</em> &amp; faster"},
+	}
+	if err := s.SetTestPayloads(ctx, "hero", payloads); err != nil {
+		t.Fatalf("SetTestPayloads failed: %v", err)
+	}
+
+	test, _ := s.GetTest(ctx, "hero")
+	want := []store.VariantPayload{
+		{Type: store.PayloadText, Text: "Ship Faster"},
+		{Type: store.PayloadHTML, HTML: "Build <em>better</em> &amp; faster"},
+	}
+	if !reflect.DeepEqual(test.Payloads, want) {
+		t.Errorf("got payloads %+v, want %+v", test.Payloads, want)
+	}
+	if !reflect.DeepEqual(test.Variants, []string{"Ship Faster", "Build better & faster"}) {
+		t.Errorf("expected variant names from payloads, got %q", test.Variants)
+	}
+
+	// Variant count is fixed
+	if err := s.SetTestPayloads(ctx, "hero", payloads[:1]); err == nil {
+		t.Error("expected an error when changing the number of variants")
+	}
+	if err := s.SetTestPayloads(ctx, "missing", payloads); err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSetTestPayloads_NamesAndLabels(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "cta", []string{"A", "B", "C"}, nil, "")
+
+	err := s.SetTestPayloads(ctx, "cta", []store.VariantPayload{
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"src": "/b.png", "alt": "Team"}},
+		{Type: store.PayloadClass, Add: []string{"btn-green"}, Remove: []string{"btn-blue"}},
+		{Type: store.PayloadClass, Add: []string{"btn-red"}, Label: "Red"},
+	})
+	if err != nil {
+		t.Fatalf("SetTestPayloads failed: %v", err)
+	}
+
+	test, _ := s.GetTest(ctx, "cta")
+	want := []string{"alt=Team, src=/b.png", "+btn-green -btn-blue", "Red"}
+	if !reflect.DeepEqual(test.Variants, want) {
+		t.Errorf("got variant names %q, want %q", test.Variants, want)
+	}
+}
+
+func TestPlainVariants_HaveNoPayloads(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, "")
+
+	test, _ := s.GetTest(ctx, "hero")
+	if test.Payloads != nil {
+		t.Errorf("expected no payloads for plain variants, got %+v", test.Payloads)
+	}
+	want := []store.VariantPayload{{Type: store.PayloadText, Text: "A"}, {Type: store.PayloadText, Text: "B"}}
+	if !reflect.DeepEqual(test.VariantPayloads(), want) {
+		t.Errorf("got %+v, want %+v", test.VariantPayloads(), want)
+	}
+}
+
+func TestVariantPayload_Validate(t *testing.T) {
+	valid := []store.VariantPayload{
+		{Type: store.PayloadText, Text: "Ship Faster"},
+		{Type: store.PayloadHTML, HTML: `Ship <a href="/pricing" title="a > b">faster</a><br>`},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"src": "data:image/png;base64,AAAA", "style": "color: red"}},
+		{Type: store.PayloadClass, Remove: []string{"hidden"}},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", p, err)
+		}
+	}
+
+	invalid := []store.VariantPayload{
+		{Type: store.PayloadHTML, HTML: "<script>alert(1)</script>"},
+		{Type: store.PayloadHTML, HTML: `<em onclick="alert(1)">x</em>`},
+		{Type: store.PayloadHTML, HTML: `<a href="javascript:alert(1)">x</a>`},
+		{Type: store.PayloadHTML, HTML: "<em>unclosed"},
+		{Type: store.PayloadHTML, HTML: "<!-- comment -->"},
+		{Type: store.PayloadAttrs},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"onerror": "alert(1)"}},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"href": " JavaScript:alert(1)"}},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"href": "data:text/html,x"}},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"data": "javascript:alert(1)"}},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"background": "javascript:alert(1)"}},
+		{Type: store.PayloadAttrs, Attrs: map[string]string{"ping": "/track javascript:alert(1)"}},
+		{Type: store.PayloadClass},
+		{Type: store.PayloadClass, Add: []string{"two words"}},
+		{Type: "video"},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		}
+	}
+}
+
+func TestVariantPayload_LinksInNewWindowsGetNoopener(t *testing.T) {
+	tests := []struct{ html, want string }{
+		{`<a href="/a" target="_blank">x</a>`, `<a href="/a" target="_blank" rel="noopener">x</a>`},
+		{`<a target="_blank" rel="nofollow">x</a>`, `<a target="_blank" rel="nofollow noopener">x</a>`},
+		{`<a target="_blank" rel="noreferrer">x</a>`, `<a target="_blank" rel="noreferrer">x</a>`},
+		{`<a href="/a">x</a>`, `<a href="/a">x</a>`},
+	}
+	for _, tt := range tests {
+		p := store.VariantPayload{Type: store.PayloadHTML, HTML: tt.html}
+		if err := p.Validate(); err != nil {
+			t.Fatalf("expected %s to be valid, got %v", tt.html, err)
+		}
+		if p.HTML != tt.want {
+			t.Errorf("expected %s, got %s", tt.want, p.HTML)
+		}
+	}
+}
+
+func TestSetTestPayloads_MultiElement(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	_, _ = s.CreateTest(ctx, "landing", []string{"A", "B"}, nil, "")
+
+	speed := store.VariantPayload{Type: store.PayloadMulti, Changes: []store.ElementChange{
+		{Selector: "h1", VariantPayload: store.VariantPayload{Type: store.PayloadHTML, HTML: "Ship <em>faster</em>"}},
+		{Selector: ".subhead", VariantPayload: store.VariantPayload{Type: store.PayloadText, Text: "Deploy in minutes"}},
+		{Selector: "a.cta", VariantPayload: store.VariantPayload{Type: store.PayloadClass, Add: []string{"green"}}},
+	}}
+	err := s.SetTestPayloads(ctx, "landing", []store.VariantPayload{{Type: store.PayloadText, Text: "A"}, speed})
+	if err != nil {
+		t.Fatalf("SetTestPayloads failed: %v", err)
+	}
+
+	test, _ := s.GetTest(ctx, "landing")
+	if !reflect.DeepEqual(test.Payloads[1], speed) {
+		t.Errorf("got %+v, want %+v", test.Payloads[1], speed)
+	}
+	if want := "Ship faster / Deploy in minutes / +green"; test.Variants[1] != want {
+		t.Errorf("got composite name %q, want %q", test.Variants[1], want)
+	}
+
+	invalid := []store.VariantPayload{
+		{Type: store.PayloadMulti},
+		{Type: store.PayloadMulti, Changes: []store.ElementChange{
+			{VariantPayload: store.VariantPayload{Type: store.PayloadText, Text: "x"}},
+		}},
+		{Type: store.PayloadMulti, Changes: []store.ElementChange{
+			{Selector: "h1", VariantPayload: store.VariantPayload{Type: store.PayloadMulti}},
+		}},
+		{Type: store.PayloadMulti, Changes: []store.ElementChange{
+			{Selector: "h1", VariantPayload: store.VariantPayload{Type: store.PayloadHTML, HTML: "<img src=x>"}},
+		}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package store_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gkobilansky/headline-goat/internal/store"
+	"github.com/gkobilansky/headline-goat/tests/testutil"
+)
+
+// seedRetention records events 60 days and 1 day before now for "hero"
+func seedRetention(t *testing.T, s *store.SQLiteStore, now time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, ""); err != nil {
+		t.Fatalf("failed to create test: %v", err)
+	}
+
+	old := now.AddDate(0, 0, -60)
+	recent := now.AddDate(0, 0, -1)
+	err := s.RecordEvents(ctx, []store.Event{
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "old-a", CreatedAt: old},
+		{TestName: "hero", Variant: 0, EventType: "convert", VisitorID: "old-a", CreatedAt: old},
+		{TestName: "hero", Variant: 1, EventType: "view", VisitorID: "old-b", CreatedAt: old},
+		{TestName: "hero", Variant: 1, EventType: "view", VisitorID: "new-c", CreatedAt: recent},
+	})
+	if err != nil {
+		t.Fatalf("failed to record events: %v", err)
+	}
+}
+
+func TestApplyRetention_RollsUpOldEventsKeepingResults(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	seedRetention(t, s, now)
+
+	before, _ := s.GetVariantStats(ctx, "hero")
+
+	_ = s.SetRetentionDays(ctx, 30)
+	results, err := s.ApplyRetention(ctx, now, false)
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Events != 3 || results[0].Days != 30 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	events, _ := s.GetEvents(ctx, "hero")
+	if len(events) != 1 || events[0].VisitorID != "new-c" {
+		t.Errorf("expected only the recent event to remain, got %d", len(events))
+	}
+
+	after, _ := s.GetVariantStats(ctx, "hero")
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("results changed: before %+v, after %+v", before, after)
+	}
+
+	// Rebuilding keeps the rolled-up days
+	if err := s.RebuildAggregates(ctx, ""); err != nil {
+		t.Fatalf("RebuildAggregates failed: %v", err)
+	}
+	rebuilt, _ := s.GetVariantStats(ctx, "hero")
+	if !reflect.DeepEqual(rebuilt, before) {
+		t.Errorf("rebuild changed results: before %+v, after %+v", before, rebuilt)
+	}
+
+	test, _ := s.GetTest(ctx, "hero")
+	if !test.CompactedBefore.Equal(results[0].Cutoff) {
+		t.Errorf("expected compacted_before %v, got %v", results[0].Cutoff, test.CompactedBefore)
+	}
+}
+
+func TestApplyRetention_KeepsDeduplicatingCompactedVisitors(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	seedRetention(t, s, now)
+
+	_ = s.SetRetentionDays(ctx, 30)
+	if _, err := s.ApplyRetention(ctx, now, false); err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+
+	// Returning visitors are not counted again. A repeat conversion is
+	// recorded as a conversion event only.
+	_ = s.RecordEvent(ctx, "hero", 1, "view", "old-a")
+	recorded, err := s.RecordConversion(ctx, store.Conversion{TestName: "hero", Variant: 0, VisitorID: "old-a"})
+	if err != nil || !recorded {
+		t.Errorf("expected repeat conversion to be recorded, got recorded=%v err=%v", recorded, err)
+	}
+
+	// A first conversion still counts for the variant the visitor was shown
+	_ = s.RecordEvent(ctx, "hero", 1, "convert", "old-b")
+
+	variant, err := s.GetVisitorVariant(ctx, "hero", "old-b")
+	if err != nil || variant != 1 {
+		t.Errorf("expected compacted visitor variant 1, got %d (%v)", variant, err)
+	}
+
+	stats, _ := s.GetVariantStats(ctx, "hero")
+	want := []store.VariantStats{
+		{Variant: 0, Views: 1, Conversions: 1},
+		{Variant: 1, Views: 2, Conversions: 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestApplyRetention_PerTestOverrideAndPreview(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	seedRetention(t, s, now)
+	_, _ = s.CreateTest(ctx, "cta", []string{"X", "Y"}, nil, "")
+	_ = s.RecordEvents(ctx, []store.Event{
+		{TestName: "cta", Variant: 0, EventType: "view", VisitorID: "v1", CreatedAt: now.AddDate(0, 0, -60)},
+	})
+
+	_ = s.SetRetentionDays(ctx, 30)
+	keep := 0
+	if err := s.SetTestRetentionDays(ctx, "cta", &keep); err != nil {
+		t.Fatalf("SetTestRetentionDays failed: %v", err)
+	}
+	if err := s.SetTestRetentionDays(ctx, "missing", &keep); err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	preview, err := s.ApplyRetention(ctx, now, true)
+	if err != nil {
+		t.Fatalf("preview failed: %v", err)
+	}
+	if len(preview) != 1 || preview[0].TestName != "hero" || preview[0].Events != 3 {
+		t.Fatalf("unexpected preview %+v", preview)
+	}
+	if events, _ := s.GetEvents(ctx, "hero"); len(events) != 4 {
+		t.Errorf("preview must not delete events, %d left", len(events))
+	}
+
+	_, _ = s.ApplyRetention(ctx, now, false)
+	if events, _ := s.GetEvents(ctx, "cta"); len(events) != 1 {
+		t.Errorf("expected cta events kept forever, got %d", len(events))
+	}
+}
+
+func TestGetRollups_ReturnsCompactedDays(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	seedRetention(t, s, now)
+
+	if rollups, _ := s.GetRollups(ctx, "hero"); len(rollups) != 0 {
+		t.Errorf("expected no rollups before retention, got %+v", rollups)
+	}
+
+	_ = s.SetRetentionDays(ctx, 30)
+	_, _ = s.ApplyRetention(ctx, now, false)
+
+	rollups, err := s.GetRollups(ctx, "hero")
+	if err != nil {
+		t.Fatalf("GetRollups failed: %v", err)
+	}
+	day := now.AddDate(0, 0, -60).UTC().Truncate(24 * time.Hour)
+	want := []store.DailyStats{
+		{Day: day, Variant: 0, Views: 1, Conversions: 1},
+		{Day: day, Variant: 1, Views: 1},
+	}
+	if !reflect.DeepEqual(rollups, want) {
+		t.Errorf("got %+v, want %+v", rollups, want)
+	}
+}
@@ -3,6 +3,7 @@ package store_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/gkobilansky/headline-goat/internal/store"
 	"github.com/gkobilansky/headline-goat/tests/testutil"
@@ -218,6 +219,39 @@ func TestRecordEvent_Deduplication(t *testing.T) {
 	}
 }
 
+func TestRecordEvents_BatchDeduplicatesAndKeepsTimestamps(t *testing.T) {
+	s := testutil.SetupTestStore(t)
+
+	ctx := context.Background()
+	if _, err := s.CreateTest(ctx, "hero", []string{"A", "B"}, nil, ""); err != nil {
+		t.Fatalf("failed to create test: %v", err)
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := s.RecordEvents(ctx, []store.Event{
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "v1", CreatedAt: at},
+		{TestName: "hero", Variant: 0, EventType: "view", VisitorID: "v1", CreatedAt: at},
+		{TestName: "hero", Variant: 1, EventType: "view", VisitorID: "v2", CreatedAt: at},
+		{TestName: "hero", Variant: 1, EventType: "convert", VisitorID: "v2", CreatedAt: at},
+	})
+	if err != nil {
+		t.Fatalf("failed to record events: %v", err)
+	}
+
+	events, err := s.GetEvents(ctx, "hero")
+	if err != nil {
+		t.Fatalf("failed to get events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events after dedup, got %d", len(events))
+	}
+	for _, e := range events {
+		if !e.CreatedAt.Equal(at) {
+			t.Errorf("expected created_at %v, got %v", at, e.CreatedAt)
+		}
+	}
+}
+
 func TestGetVariantStats(t *testing.T) {
 	s := testutil.SetupTestStore(t)
 
@@ -0,0 +1,134 @@
+package assign_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/assign"
+)
+
+func TestHash_MatchesFNV1a(t *testing.T) {
+	// Reference values for 32-bit FNV-1a; the JS port in hlg.js must agree
+	tests := []struct {
+		input string
+		want  uint32
+	}{
+		{"", 0x811c9dc5},
+		{"a", 0xe40c292c},
+		{"foobar", 0xbf9cf968},
+	}
+
+	for _, tt := range tests {
+		if got := assign.Hash(tt.input); got != tt.want {
+			t.Errorf("Hash(%q) = %#x, want %#x", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBucket_Deterministic(t *testing.T) {
+	a := assign.Bucket("holdout", "visitor-1")
+	b := assign.Bucket("holdout", "visitor-1")
+	if a != b {
+		t.Errorf("expected same bucket, got %f and %f", a, b)
+	}
+	if a < 0 || a >= 1 {
+		t.Errorf("bucket out of range: %f", a)
+	}
+}
+
+func TestInHoldout_Proportion(t *testing.T) {
+	held := 0
+	for i := 0; i < 10000; i++ {
+		if assign.InHoldout(fmt.Sprintf("visitor-%d", i), 10) {
+			held++
+		}
+	}
+
+	// Expect roughly 10% with generous tolerance
+	if held < 800 || held > 1200 {
+		t.Errorf("expected ~1000 visitors in 10%% holdout, got %d", held)
+	}
+}
+
+func TestInHoldout_ZeroPercent(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if assign.InHoldout(fmt.Sprintf("visitor-%d", i), 0) {
+			t.Fatal("expected no visitors in 0% holdout")
+		}
+	}
+}
+
+func TestEligible_AtMostOneTestPerLayer(t *testing.T) {
+	layers := map[string][]string{"landing": {"cta", "hero", "subhead"}}
+	counts := map[string]int{}
+
+	for i := 0; i < 3000; i++ {
+		vid := fmt.Sprintf("visitor-%d", i)
+		eligible := 0
+		for _, name := range layers["landing"] {
+			if assign.Eligible(vid, name, layers, 0) {
+				eligible++
+				counts[name]++
+			}
+		}
+		if eligible != 1 {
+			t.Fatalf("visitor %s eligible for %d tests in layer, want 1", vid, eligible)
+		}
+	}
+
+	for name, n := range counts {
+		if n < 800 || n > 1200 {
+			t.Errorf("test %s got %d of 3000 visitors, expected ~1000", name, n)
+		}
+	}
+}
+
+func TestEligible_TestOutsideLayers(t *testing.T) {
+	layers := map[string][]string{"landing": {"hero", "subhead"}}
+	if !assign.Eligible("visitor-1", "pricing", layers, 0) {
+		t.Error("expected test outside any layer to be eligible")
+	}
+	if assign.Eligible("visitor-1", "pricing", layers, 100) {
+		t.Error("expected 100% holdout to exclude every test")
+	}
+}
+
+func TestTrafficShare(t *testing.T) {
+	tests := []struct {
+		holdout   float64
+		layerSize int
+		want      float64
+	}{
+		{0, 0, 1},
+		{10, 0, 0.9},
+		{0, 4, 0.25},
+		{20, 2, 0.4},
+	}
+
+	for _, tt := range tests {
+		if got := assign.TrafficShare(tt.holdout, tt.layerSize); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("TrafficShare(%g, %d) = %f, want %f", tt.holdout, tt.layerSize, got, tt.want)
+		}
+	}
+}
+
+func TestVariant_DeterministicAndInRange(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		vid := fmt.Sprintf("visitor-%d", i)
+		v := assign.Variant("hero", vid, 3, nil)
+		if v < 0 || v >= 3 {
+			t.Fatalf("Variant returned %d, want 0-2", v)
+		}
+		if again := assign.Variant("hero", vid, 3, nil); again != v {
+			t.Fatalf("Variant not deterministic for %s: %d then %d", vid, v, again)
+		}
+	}
+}
+
+func TestVariant_HonorsWeights(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if v := assign.Variant("hero", fmt.Sprintf("visitor-%d", i), 2, []float64{0, 1}); v != 1 {
+			t.Fatalf("expected all visitors on variant 1 with weights [0 1], got %d", v)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package globaljs_test
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gkobilansky/headline-goat/internal/server"
 )
@@ -113,3 +114,107 @@ func TestGenerateGlobalScript_HandlesConvertEvents(t *testing.T) {
 		t.Error("expected script to add click handlers for conversions")
 	}
 }
+
+func TestGenerateGlobalScript_ExposesIdentify(t *testing.T) {
+	script := server.GenerateGlobalScript("http://localhost:8080")
+
+	if !strings.Contains(script, "window.hlg.identify") {
+		t.Error("expected script to expose window.hlg.identify")
+	}
+	if !strings.Contains(script, "/identify") {
+		t.Error("expected identify to call the /identify endpoint")
+	}
+}
+
+func TestGenerateGlobalScript_TracksEngagementGoals(t *testing.T) {
+	script := server.GenerateGlobalScript("http://localhost:8080")
+
+	for _, want := range []string{"test.engagement", "'scroll'", "'load'", "visibilitychange", "IntersectionObserver", "'submit'", "removeEventListener"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %s", want)
+		}
+	}
+}
+
+func TestGenerateGlobalScript_ExposesPublicAPI(t *testing.T) {
+	script := server.GenerateGlobalScript("http://localhost:8080")
+
+	for _, method := range []string{"track", "getVariant", "onReady", "forceVariant", "push"} {
+		if !strings.Contains(script, "window.hlg."+method+"=") {
+			t.Errorf("expected script to expose window.hlg.%s", method)
+		}
+	}
+
+	// Calls queued before the script loaded are replayed
+	if !strings.Contains(script, "Array.isArray(window.hlg)") {
+		t.Error("expected script to replay a queued window.hlg array")
+	}
+}
+
+func TestGenerateGlobalScript_FollowsSinglePageAppRoutes(t *testing.T) {
+	script := server.GenerateGlobalScript("http://localhost:8080")
+
+	for _, want := range []string{"'pushState'", "'replaceState'", "'popstate'", "MutationObserver"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %s", want)
+		}
+	}
+
+	// Mutations are batched per frame, and the observer stops when idle
+	for _, want := range []string{"requestAnimationFrame(flush)", "observer.disconnect()", "addsTestElement"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %s", want)
+		}
+	}
+
+	// Views are sent once per test, however often a route is visited
+	if !strings.Contains(script, "if(viewed[name])return;") {
+		t.Error("expected script to deduplicate view beacons")
+	}
+}
+
+func TestAntiFlickerSnippet(t *testing.T) {
+	snippet := server.AntiFlickerSnippet("https://ab.example.com", "/pricing", []string{"h1.hero"}, 800*time.Millisecond)
+
+	for _, want := range []string{
+		`<style id="hlg-hide">[data-hlg-name],[data-hlg-convert-variants],h1.hero{visibility:hidden !important}</style>`,
+		"},800)</script>",
+		`<script src="https://ab.example.com/hlg.js?url=%2Fpricing"></script>`,
+	} {
+		if !strings.Contains(snippet, want) {
+			t.Errorf("expected snippet to contain %s, got:\n%s", want, snippet)
+		}
+	}
+
+	// The script reveals hidden elements once tests are applied
+	script := server.GenerateGlobalScript("http://localhost:8080")
+	if !strings.Contains(script, "getElementById('hlg-hide')") {
+		t.Error("expected script to remove the anti-flicker style")
+	}
+}
+
+func TestAntiFlickerSnippet_DefersScriptWithoutURL(t *testing.T) {
+	snippet := server.AntiFlickerSnippet("http://localhost:8080", "", nil, time.Second)
+
+	if !strings.Contains(snippet, `<script src="http://localhost:8080/hlg.js" defer></script>`) {
+		t.Errorf("expected a deferred script tag, got:\n%s", snippet)
+	}
+}
+
+func TestGenerateGlobalScript_AppliesVariantPayloads(t *testing.T) {
+	script := server.GenerateGlobalScript("http://localhost:8080")
+
+	for _, want := range []string{"test.payloads", "innerHTML=p.html", "setAttribute(k,p.attrs[k])", "classList.add(c)", "classList.remove(c)"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %s", want)
+		}
+	}
+}
+
+func TestGenerateGlobalScript_AppliesMultiElementVariants(t *testing.T) {
+	script := server.GenerateGlobalScript("http://localhost:8080")
+
+	if !strings.Contains(script, "p.type==='multi'") || !strings.Contains(script, "p.changes[i].selector") {
+		t.Error("expected script to apply multi-element variants")
+	}
+}
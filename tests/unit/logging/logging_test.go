@@ -0,0 +1,94 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/logging"
+)
+
+func TestRotatingFile_RotatesPastMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hlg.log")
+	f, err := logging.OpenRotatingFile(path, 20, 2)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first line 1234\n", "second line 123\n", "third line 1234\n", "fourth line 123\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "fourth line 123\n",
+		path + ".1": "third line 1234\n",
+		path + ".2": "second line 123\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q", filepath.Base(name), content, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected only 2 backups to be kept")
+	}
+}
+
+func TestRotatingFile_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hlg.log")
+	os.WriteFile(path, []byte("old\n"), 0644)
+
+	f, err := logging.OpenRotatingFile(path, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	f.Write([]byte("new\n"))
+	f.Close()
+
+	got, _ := os.ReadFile(path)
+	if string(got) != "old\nnew\n" {
+		t.Errorf("expected appended content, got %q", got)
+	}
+}
+
+func TestNew_JSONToFileRespectsLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hlg.log")
+	logger, closer, err := logging.New(logging.Options{Level: "warn", Format: "json", File: path})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	logger.Info("ignored")
+	logger.Warn("kept", "test", "hero")
+	closer.Close()
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d: %q", len(lines), data)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("expected JSON, got %q", lines[0])
+	}
+	if entry["msg"] != "kept" || entry["test"] != "hero" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestNew_RejectsInvalidOptions(t *testing.T) {
+	if _, _, err := logging.New(logging.Options{Level: "loud"}); err == nil {
+		t.Error("expected error for invalid level")
+	}
+	if _, _, err := logging.New(logging.Options{Format: "xml"}); err == nil {
+		t.Error("expected error for invalid format")
+	}
+}
@@ -0,0 +1,80 @@
+package stats_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gkobilansky/headline-goat/internal/stats"
+	"github.com/gkobilansky/headline-goat/internal/store"
+)
+
+func TestMeanInterval(t *testing.T) {
+	// Visitors with 0, 0, 1, 2 and 7 events: mean 2, sample variance 8.5
+	mean, lower, upper := stats.MeanInterval(10, 54, 5, 0.95)
+
+	if mean != 2 {
+		t.Errorf("expected mean 2, got %f", mean)
+	}
+	spread := 1.96 * math.Sqrt(8.5/5)
+	if math.Abs(upper-(2+spread)) > 1e-9 {
+		t.Errorf("expected upper %f, got %f", 2+spread, upper)
+	}
+	if lower != 0 {
+		t.Errorf("expected lower bound clamped to 0, got %f", lower)
+	}
+}
+
+func TestMeanInterval_NoVisitors(t *testing.T) {
+	mean, lower, upper := stats.MeanInterval(0, 0, 0, 0.95)
+	if mean != 0 || lower != 0 || upper != 0 {
+		t.Errorf("expected zeros, got %f [%f, %f]", mean, lower, upper)
+	}
+}
+
+func TestMeanSignificanceTest(t *testing.T) {
+	// 1000 visitors each: A averages 1.5 events, B 1.0, both with variance 1
+	confidence := stats.MeanSignificanceTest(1500, 1000*(1+1.5*1.5), 1000, 1000, 1000*(1+1), 1000)
+	if confidence < 0.99 {
+		t.Errorf("expected high confidence, got %f", confidence)
+	}
+
+	confidence = stats.MeanSignificanceTest(1000, 2000, 1000, 1000, 2000, 1000)
+	if math.Abs(confidence-0.5) > 1e-9 {
+		t.Errorf("expected 0.5 for equal means, got %f", confidence)
+	}
+
+	if confidence := stats.MeanSignificanceTest(10, 20, 10, 0, 0, 0); confidence != 0.5 {
+		t.Errorf("expected 0.5 without data for B, got %f", confidence)
+	}
+}
+
+func TestAnalyze_EventsPerVisitor(t *testing.T) {
+	test := &store.Test{
+		Name:      "cta",
+		Variants:  []string{"A", "B"},
+		CountMode: store.CountEvery,
+	}
+	variantStats := []store.VariantStats{
+		{Variant: 0, Views: 100, Conversions: 20, Events: 30, EventsSumSq: 60},
+		{Variant: 1, Views: 100, Conversions: 20, Events: 80, EventsSumSq: 400},
+	}
+
+	result := stats.Analyze(test, variantStats)
+
+	if result.Variants[1].Events != 80 || result.Variants[1].EventsPerVisitor != 0.8 {
+		t.Errorf("unexpected events for B: %+v", result.Variants[1])
+	}
+	if result.EventsLeadingVariant != 1 {
+		t.Errorf("expected B to lead on events, got %d", result.EventsLeadingVariant)
+	}
+	if result.EventsConfidenceLevel < 0.95 {
+		t.Errorf("expected B to beat control on events, got %f", result.EventsConfidenceLevel)
+	}
+
+	// Unique-counting tests don't report events
+	test.CountMode = store.CountUnique
+	result = stats.Analyze(test, variantStats)
+	if result.Variants[1].EventsPerVisitor != 0 || result.EventsConfidenceLevel != 0 {
+		t.Errorf("expected no event analysis, got %+v", result)
+	}
+}